@@ -31,6 +31,14 @@ type CustomClusterSpec struct {
 	PublishIps            []string `json:"publishIPs,omitempty"`
 	PrivateIps            []string `json:"privateIPs,omitempty"`
 	EnablePrivateIP       bool     `json:"enablePrivateIP"`
+
+	// IngressDomain is the base domain of http endpoints, the first endpoint of experiment is routed
+	// by <expr>.<namespace>.<domain> and the others by <endpoint>.<expr>.<namespace>.<domain>
+	IngressDomain string `json:"ingressDomain,omitempty"`
+	// IngressClass selects the ingress controller serving http endpoints
+	IngressClass string `json:"ingressClass,omitempty"`
+	// IngressTLSSecret is a wildcard certificate of ingress domain in experiment namespace, http is used if empty
+	IngressTLSSecret string `json:"ingressTLSSecret,omitempty"`
 }
 
 type ClusterStatus string
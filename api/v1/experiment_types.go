@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -25,15 +27,113 @@ type ExperimentSpec struct {
 	Pause       bool   `json:"pause"`
 	Template    string `json:"template"`
 	ClusterName string `json:"clusterName"`
+
+	// Source is used to populate the data volume of a new experiment
+	Source *ExperimentSource `json:"source,omitempty"`
+	// DataVolumeSize overrides the data volume size of template, limited by template max size
+	DataVolumeSize *resource.Quantity `json:"dataVolumeSize,omitempty"`
+	// TemplateRevision pins experiment to a revision of template, the latest template data is used if empty
+	TemplateRevision string `json:"templateRevision,omitempty"`
+	// Resources overrides template resources, limited by namespace LimitRange
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// CredentialsRotation regenerates passwords and recreates env pod when increased
+	CredentialsRotation int64 `json:"credentialsRotation,omitempty"`
+	// RestartGeneration recreates env pod and keeps data when increased
+	RestartGeneration int64 `json:"restartGeneration,omitempty"`
+	// ResetGeneration wipes data volume and seeds it from template again when increased
+	ResetGeneration int64 `json:"resetGeneration,omitempty"`
+	// AuthorizedKeys are public keys installed as authorized_keys of ssh endpoints,
+	// changes take effect when env pod recreated
+	AuthorizedKeys []AuthorizedKeySource `json:"authorizedKeys,omitempty"`
+	// Owner is the user or team the experiment belongs to, owner and mentors may connect through gateway.
+	// With the access webhook enabled, they are also granted to read experiment and its credentials,
+	// and users not allowed to bind experiments can only set themselves as owner on creation
+	Owner *ExperimentSubject `json:"owner,omitempty"`
+	// Mentors have the same access as owner
+	Mentors []ExperimentSubject `json:"mentors,omitempty"`
+}
+
+// ExperimentSubject is a user, group or service account identity of kubernetes authentication
+type ExperimentSubject struct {
+	// +kubebuilder:validation:Enum=User;Group;ServiceAccount
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Namespace of service account, experiment namespace if empty
+	Namespace string `json:"namespace,omitempty"`
+}
+
+const (
+	ExperimentSubjectUser           = "User"
+	ExperimentSubjectGroup          = "Group"
+	ExperimentSubjectServiceAccount = "ServiceAccount"
+)
+
+// Subjects returns owner and mentors of experiment
+func (e *Experiment) Subjects() []ExperimentSubject {
+	subjects := make([]ExperimentSubject, 0)
+	if e.Spec.Owner != nil {
+		subjects = append(subjects, *e.Spec.Owner)
+	}
+	return append(subjects, e.Spec.Mentors...)
+}
+
+// Authorized reports whether the authenticated user is owner or mentor of experiment,
+// experiment without owner and mentors can not be accessed by anyone
+func (e *Experiment) Authorized(username string, groups []string) bool {
+	for _, s := range e.Subjects() {
+		switch s.Kind {
+		case ExperimentSubjectUser:
+			if s.Name == username {
+				return true
+			}
+		case ExperimentSubjectGroup:
+			for _, g := range groups {
+				if s.Name == g {
+					return true
+				}
+			}
+		case ExperimentSubjectServiceAccount:
+			namespace := s.Namespace
+			if namespace == "" {
+				namespace = e.Namespace
+			}
+			if username == "system:serviceaccount:"+namespace+":"+s.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuthorizedKeySource is an inline public key or a secret key holding public keys,
+// only one of Key and SecretKeyRef should be set. There is no user resource in this api group,
+// platforms keeping keys of participants publish them through secrets referenced by SecretKeyRef
+type AuthorizedKeySource struct {
+	Key          string                    `json:"key,omitempty"`
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// ExperimentSource describes where the data of a cloned experiment comes from,
+// only one of Experiment and Snapshot should be set
+type ExperimentSource struct {
+	// Experiment is the name of an experiment in the same namespace
+	Experiment string `json:"experiment,omitempty"`
+	// Snapshot is the name of a VolumeSnapshot in the same namespace,
+	// restoring from snapshot requires a CSI storage class
+	Snapshot string `json:"snapshot,omitempty"`
 }
 
 type ExperimentEnvStatus string
 
 const (
-	ExperimentCreated ExperimentEnvStatus = "Created"
-	ExperimentRunning ExperimentEnvStatus = "Running"
+	ExperimentCreated      ExperimentEnvStatus = "Created"
+	ExperimentProvisioning ExperimentEnvStatus = "Provisioning"
+	ExperimentRunning      ExperimentEnvStatus = "Running"
+	ExperimentPaused       ExperimentEnvStatus = "Paused"
+	ExperimentError        ExperimentEnvStatus = "Error"
+	ExperimentTerminating  ExperimentEnvStatus = "Terminating"
+	// ExperimentStopped is replaced by ExperimentPaused, it is only kept for existing experiments
 	ExperimentStopped ExperimentEnvStatus = "Stopped"
-	ExperimentError   ExperimentEnvStatus = "Error"
 )
 
 type ExperimentConditionStatus string
@@ -47,10 +147,21 @@ const (
 type ExperimentConditionType string
 
 const (
-	ExperimentInitialized   ExperimentConditionType = "Initialized"
-	ExperimentPodReady      ExperimentConditionType = "PodReady"
-	ExperimentVolumeCreated ExperimentConditionType = "VolumeCreated"
-	ExperimentReady         ExperimentConditionType = "Ready"
+	ExperimentInitialized    ExperimentConditionType = "Initialized"
+	ExperimentPodReady       ExperimentConditionType = "PodReady"
+	ExperimentVolumeCreated  ExperimentConditionType = "VolumeCreated"
+	ExperimentDataSeeded     ExperimentConditionType = "DataSeeded"
+	ExperimentVolumeRetained ExperimentConditionType = "VolumeRetained"
+	// ExperimentVolumeExpiring is True when the retained data volume of deleted experiment is about to be reclaimed
+	ExperimentVolumeExpiring ExperimentConditionType = "VolumeExpiring"
+	ExperimentVolumeExpanded ExperimentConditionType = "VolumeExpanded"
+	// ExperimentRevisionResolved is False if the pinned template revision can not be used
+	ExperimentRevisionResolved ExperimentConditionType = "RevisionResolved"
+	ExperimentUpdatePending    ExperimentConditionType = "UpdatePending"
+	ExperimentOutOfResource    ExperimentConditionType = "OutOfResource"
+	ExperimentRestarted        ExperimentConditionType = "Restarted"
+	ExperimentDataReset        ExperimentConditionType = "DataReset"
+	ExperimentReady            ExperimentConditionType = "Ready"
 )
 
 type ExperimentCondition struct {
@@ -67,20 +178,89 @@ type ExperimentIngressProtocol string
 const (
 	ExperimentIngressSSH = "ssh"
 	ExperimentIngressVNC = "vnc"
+	// ExperimentIngressHTTP is served by ingress controller with a hostname per experiment
+	ExperimentIngressHTTP = "http"
 )
 
 // ExperimentStatus defines the observed state of Experiment
 type ExperimentStatus struct {
+	// +kubebuilder:validation:Enum=Created;Provisioning;Running;Paused;Error;Terminating;Stopped
 	Status      ExperimentEnvStatus       `json:"status,omitempty"`
 	IngressIPs  []string                  `json:"ingressIPs,omitempty"`
 	IngressPort int32                     `json:"ingressPort,omitempty"`
 	Protocol    ExperimentIngressProtocol `json:"protocol,omitempty"`
 	Cluster     string                    `json:"cluster,omitempty"`
 	ClusterSync bool                      `json:"clusterSync,omitempty"`
-	Conditions  []ExperimentCondition     `json:"conditions,omitempty"`
+	// TemplateRevision is the revision which env pod is created from
+	TemplateRevision string                `json:"templateRevision,omitempty"`
+	Conditions       []ExperimentCondition `json:"conditions,omitempty"`
+
+	// VNC and SSH only contain usernames, passwords are in the credentials secret
+	VNC *VNCConfig `json:"vnc,omitempty"`
+	SSH *SSHConfig `json:"ssh,omitempty"`
+
+	// CredentialsSecret stores credentials of all endpoints
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// ObservedCredentialsRotation is the last credentials rotation carried out
+	ObservedCredentialsRotation int64 `json:"observedCredentialsRotation,omitempty"`
+	// ObservedRestartGeneration is the last restart carried out
+	ObservedRestartGeneration int64 `json:"observedRestartGeneration,omitempty"`
+	// ObservedResetGeneration is the last reset carried out, successfully or not
+	ObservedResetGeneration int64 `json:"observedResetGeneration,omitempty"`
+
+	// URL of the first http endpoint
+	URL string `json:"url,omitempty"`
+
+	// Endpoints of experiment, the legacy ingress fields above are copied from the first endpoint
+	Endpoints []ExperimentEndpointStatus `json:"endpoints,omitempty"`
+
+	DataVolume *ExperimentDataVolumeStatus `json:"dataVolume,omitempty"`
+}
+
+type ExperimentEndpointStatus struct {
+	Name       string                    `json:"name"`
+	Protocol   ExperimentIngressProtocol `json:"protocol"`
+	IngressIPs []string                  `json:"ingressIPs,omitempty"`
+	// IngressPort is the node port of endpoint, zero if service not ready
+	IngressPort int32 `json:"ingressPort,omitempty"`
+	// Service and Port are the cluster internal address of endpoint
+	Service string `json:"service,omitempty"`
+	Port    int32  `json:"port,omitempty"`
+	// URL of http endpoint, empty if cluster ingress domain not configured.
+	// Signed gateway urls of vnc and ssh endpoints are returned by the credentials api of gateway
+	URL string `json:"url,omitempty"`
 
 	VNC *VNCConfig `json:"vnc,omitempty"`
 	SSH *SSHConfig `json:"ssh,omitempty"`
+	// Credentials refers to the secret keys of endpoint credentials
+	Credentials *CredentialsReference `json:"credentials,omitempty"`
+	// Connection is formatted from ingress address and credentials, empty if endpoint not exposed
+	Connection *EndpointConnection `json:"connection,omitempty"`
+}
+
+type EndpointConnection struct {
+	// URI such as vnc://user@host:port
+	URI string `json:"uri,omitempty"`
+	// Command such as ssh user@host -p port
+	Command string `json:"command,omitempty"`
+	// URL opened in browser
+	URL string `json:"url,omitempty"`
+	// ClientConfig is the content of ClientConfigFile, such as a .vnc file or ssh_config snippet
+	ClientConfig     string `json:"clientConfig,omitempty"`
+	ClientConfigFile string `json:"clientConfigFile,omitempty"`
+}
+
+type CredentialsReference struct {
+	SecretName  string `json:"secretName"`
+	UsernameKey string `json:"usernameKey,omitempty"`
+	PasswordKey string `json:"passwordKey,omitempty"`
+	KeyKey      string `json:"keyKey,omitempty"`
+}
+
+type ExperimentDataVolumeStatus struct {
+	Backend DataVolumeBackend `json:"backend"`
+	// Node where the data is stored, empty if volume is not bound to node
+	Node string `json:"node,omitempty"`
 }
 
 func NewExperimentCondition(conditionType ExperimentConditionType, status ExperimentConditionStatus, reason, message string) ExperimentCondition {
@@ -115,11 +295,16 @@ func CheckExperimentCondition(conditions []ExperimentCondition, conditionType Ex
 	return cond.Status == status
 }
 
+// UpdateExperimentConditions replaces the condition of same type,
+// LastTransitionTime is kept if the condition status not changed
 func UpdateExperimentConditions(conditions []ExperimentCondition, condition ExperimentCondition) []ExperimentCondition {
 	isFound := false
 	for i := range conditions {
 		if conditions[i].Type == condition.Type {
 			isFound = true
+			if conditions[i].Status == condition.Status {
+				condition.LastTransitionTime = conditions[i].LastTransitionTime
+			}
 			conditions[i] = condition
 		}
 	}
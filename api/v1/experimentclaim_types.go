@@ -0,0 +1,85 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExperimentClaimSpec defines the desired state of ExperimentClaim
+type ExperimentClaimSpec struct {
+	// Pool is the name of ExperimentPool in the same namespace
+	Pool string `json:"pool"`
+	// Labels are added to the bound experiment, such as owner label of quota
+	Labels map[string]string `json:"labels,omitempty"`
+	// AuthorizedKeys replace the authorized keys of bound experiment
+	AuthorizedKeys []AuthorizedKeySource `json:"authorizedKeys,omitempty"`
+	// Owner and Mentors replace those of bound experiment
+	Owner   *ExperimentSubject  `json:"owner,omitempty"`
+	Mentors []ExperimentSubject `json:"mentors,omitempty"`
+}
+
+type ExperimentClaimPhase string
+
+const (
+	ExperimentClaimPending ExperimentClaimPhase = "Pending"
+	ExperimentClaimBound   ExperimentClaimPhase = "Bound"
+	// ExperimentClaimLost means the bound experiment was deleted
+	ExperimentClaimLost ExperimentClaimPhase = "Lost"
+)
+
+// ExperimentClaimStatus defines the observed state of ExperimentClaim
+type ExperimentClaimStatus struct {
+	// +kubebuilder:validation:Enum=Pending;Bound;Lost
+	Phase ExperimentClaimPhase `json:"phase,omitempty"`
+	// Experiment is the name of bound experiment, it is owned by claim and deleted with claim
+	Experiment string       `json:"experiment,omitempty"`
+	BoundTime  *metav1.Time `json:"boundTime,omitempty"`
+	// Status and URL are copied from bound experiment. Credentials of experiment are rotated on binding,
+	// which recreates its env pod, so status is Provisioning until the new env pod is ready
+	Status ExperimentEnvStatus `json:"status,omitempty"`
+	URL    string              `json:"url,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentClaim is the Schema for the experimentclaims API
+// +kubebuilder:printcolumn:name="Pool",type=string,JSONPath=`.spec.pool`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Experiment",type=string,JSONPath=`.status.experiment`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
+type ExperimentClaim struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ExperimentClaimSpec   `json:"spec,omitempty"`
+	Status ExperimentClaimStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentClaimList contains a list of ExperimentClaim
+type ExperimentClaimList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ExperimentClaim `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ExperimentClaim{}, &ExperimentClaimList{})
+}
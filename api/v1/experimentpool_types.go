@@ -0,0 +1,75 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExperimentPoolSpec defines the desired state of ExperimentPool
+type ExperimentPoolSpec struct {
+	// Size is the number of unassigned experiments kept in pool
+	// +kubebuilder:validation:Minimum=0
+	Size int32 `json:"size"`
+	// Template of pooled experiments, experiments are replaced once they are claimed or template changes
+	Template ExperimentTemplateSpec `json:"template"`
+}
+
+// ExperimentPoolStatus defines the observed state of ExperimentPool
+type ExperimentPoolStatus struct {
+	// Size is the number of unassigned experiments matching current template
+	Size int32 `json:"size"`
+	// Ready is the number of unassigned experiments which can be claimed
+	Ready int32 `json:"ready"`
+	// Claimed is the number of experiments of pool bound to claims
+	Claimed int32 `json:"claimed,omitempty"`
+
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentPool is the Schema for the experimentpools API.
+// Pooled experiments have their data volume provisioned and image pulled before they are claimed,
+// but binding rotates credentials which recreates the env pod, so a claim is ready once the new
+// env pod starts and its endpoints answer, usually seconds rather than instantly
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Claimed",type=integer,JSONPath=`.status.claimed`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.size
+type ExperimentPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ExperimentPoolSpec   `json:"spec,omitempty"`
+	Status ExperimentPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentPoolList contains a list of ExperimentPool
+type ExperimentPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ExperimentPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ExperimentPool{}, &ExperimentPoolList{})
+}
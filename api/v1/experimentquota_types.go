@@ -0,0 +1,93 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExperimentQuotaLimits are upper bounds of experiments, unset fields are unlimited
+type ExperimentQuotaLimits struct {
+	// +kubebuilder:validation:Minimum=0
+	Experiments *int32 `json:"experiments,omitempty"`
+	// CPU and Memory are the sum of container requests of running experiments
+	CPU    *resource.Quantity `json:"cpu,omitempty"`
+	Memory *resource.Quantity `json:"memory,omitempty"`
+	// DataVolume is the sum of data volume sizes
+	DataVolume *resource.Quantity `json:"dataVolume,omitempty"`
+}
+
+// ExperimentQuotaSpec defines the desired state of ExperimentQuota
+type ExperimentQuotaSpec struct {
+	// Hard limits the total usage of namespace
+	Hard ExperimentQuotaLimits `json:"hard,omitempty"`
+	// PerOwner limits the usage of each owner, the owner is read from owner label or else spec owner,
+	// experiments without owner are not limited
+	PerOwner ExperimentQuotaLimits `json:"perOwner,omitempty"`
+	// OwnerLabel is the experiment label key of owner, default hackathon.kaiyuanshe.cn/owner
+	OwnerLabel string `json:"ownerLabel,omitempty"`
+}
+
+type ExperimentQuotaUsage struct {
+	Experiments int32             `json:"experiments"`
+	CPU         resource.Quantity `json:"cpu"`
+	Memory      resource.Quantity `json:"memory"`
+	DataVolume  resource.Quantity `json:"dataVolume"`
+}
+
+type OwnerQuotaUsage struct {
+	Owner string               `json:"owner"`
+	Used  ExperimentQuotaUsage `json:"used"`
+}
+
+// ExperimentQuotaStatus defines the observed state of ExperimentQuota
+type ExperimentQuotaStatus struct {
+	Used ExperimentQuotaUsage `json:"used,omitempty"`
+	// Owners is the usage of each owner, sorted by owner
+	Owners []OwnerQuotaUsage `json:"owners,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentQuota is the Schema for the experimentquotas API
+// +kubebuilder:resource:path=experimentquotas
+// +kubebuilder:printcolumn:name="Experiments",type=integer,JSONPath=`.status.used.experiments`
+// +kubebuilder:printcolumn:name="CPU",type=string,JSONPath=`.status.used.cpu`
+// +kubebuilder:printcolumn:name="Memory",type=string,JSONPath=`.status.used.memory`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
+type ExperimentQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ExperimentQuotaSpec   `json:"spec,omitempty"`
+	Status ExperimentQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentQuotaList contains a list of ExperimentQuota
+type ExperimentQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ExperimentQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ExperimentQuota{}, &ExperimentQuotaList{})
+}
@@ -0,0 +1,127 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ExperimentSetSpec defines the desired state of ExperimentSet,
+// an experiment named <set>-<team> is created for each team
+type ExperimentSetSpec struct {
+	// Replicas creates teams named by index from 0, it is ignored if Teams is set
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Teams creates an experiment for each listed team
+	Teams []ExperimentSetTeam `json:"teams,omitempty"`
+	// Template of child experiments
+	Template ExperimentTemplateSpec `json:"template"`
+	// Rollout limits how many children are provisioned or updated at the same time
+	Rollout *ExperimentSetRollout `json:"rollout,omitempty"`
+}
+
+type ExperimentTemplateSpec struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Spec        ExperimentSpec    `json:"spec"`
+}
+
+type ExperimentSetTeam struct {
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Override replaces fields of template spec for the team
+	Override *ExperimentOverride `json:"override,omitempty"`
+}
+
+// ExperimentOverride replaces the set fields of experiment spec
+type ExperimentOverride struct {
+	Pause          *bool                        `json:"pause,omitempty"`
+	Source         *ExperimentSource            `json:"source,omitempty"`
+	DataVolumeSize *resource.Quantity           `json:"dataVolumeSize,omitempty"`
+	Resources      *corev1.ResourceRequirements `json:"resources,omitempty"`
+	AuthorizedKeys []AuthorizedKeySource        `json:"authorizedKeys,omitempty"`
+	Owner          *ExperimentSubject           `json:"owner,omitempty"`
+	Mentors        []ExperimentSubject          `json:"mentors,omitempty"`
+}
+
+type ExperimentSetRollout struct {
+	// MaxSurge is the max number of new children provisioning at the same time, default 25%
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// MaxUnavailable is the max number of children unavailable because of update, default 25%.
+	// Children already unavailable are updated regardless of it.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ExperimentSetStatus defines the observed state of ExperimentSet
+type ExperimentSetStatus struct {
+	Replicas int32 `json:"replicas"`
+	// Ready children are running, or paused if paused by spec
+	Ready int32 `json:"ready"`
+	// Updated children match the current set spec
+	Updated int32 `json:"updated"`
+	Failed  int32 `json:"failed"`
+
+	ObservedGeneration int64                     `json:"observedGeneration,omitempty"`
+	Teams              []ExperimentSetTeamStatus `json:"teams,omitempty"`
+}
+
+type ExperimentSetTeamStatus struct {
+	Name       string              `json:"name"`
+	Experiment string              `json:"experiment"`
+	Status     ExperimentEnvStatus `json:"status,omitempty"`
+	Ready      bool                `json:"ready"`
+	Updated    bool                `json:"updated"`
+	URL        string              `json:"url,omitempty"`
+	// Conflict is set if experiment name of team is used by an experiment not controlled by set,
+	// experiment of team is not created until the name is released
+	Conflict bool `json:"conflict,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentSet is the Schema for the experimentsets API
+// +kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.status.replicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Updated",type=integer,JSONPath=`.status.updated`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas
+type ExperimentSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ExperimentSetSpec   `json:"spec,omitempty"`
+	Status ExperimentSetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExperimentSetList contains a list of ExperimentSet
+type ExperimentSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ExperimentSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ExperimentSet{}, &ExperimentSetList{})
+}
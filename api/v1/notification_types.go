@@ -0,0 +1,99 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotificationEventType is the lifecycle event delivered to webhooks,
+// experiment.expiring is sent when the retained data volume of deleted experiment is about to be reclaimed
+// +kubebuilder:validation:Enum=experiment.ready;experiment.error;experiment.expiring;cluster.lost
+type NotificationEventType string
+
+const (
+	NotificationExperimentReady    NotificationEventType = "experiment.ready"
+	NotificationExperimentError    NotificationEventType = "experiment.error"
+	NotificationExperimentExpiring NotificationEventType = "experiment.expiring"
+	NotificationClusterLost        NotificationEventType = "cluster.lost"
+)
+
+// NotificationSpec defines the webhook receiving lifecycle events of the namespace
+type NotificationSpec struct {
+	// URL receives events by http POST in CloudEvents structured mode, it must be an https url
+	// of a public address unless controller allows insecure or private webhooks
+	URL string `json:"url"`
+	// Events subscribed by webhook, all events are delivered if empty
+	Events []NotificationEventType `json:"events,omitempty"`
+	// SecretRef refers to the key signing payload with HMAC-SHA256, payload is not signed if empty
+	SecretRef *corev1.SecretKeySelector `json:"secretRef,omitempty"`
+	// MaxRetries of a failed delivery before it is written to dead-letter log, default 3
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+}
+
+// NotificationStatus defines the observed state of Notification
+type NotificationStatus struct {
+	Delivered        int64        `json:"delivered,omitempty"`
+	Failed           int64        `json:"failed,omitempty"`
+	LastDeliveryTime *metav1.Time `json:"lastDeliveryTime,omitempty"`
+	// LastError is the error of last failed delivery
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Subscribed reports whether the notification receives the event type
+func (n *Notification) Subscribed(eventType NotificationEventType) bool {
+	if len(n.Spec.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Spec.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// +kubebuilder:object:root=true
+
+// Notification is the Schema for the notifications API
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
+// +kubebuilder:printcolumn:name="Delivered",type=integer,JSONPath=`.status.delivered`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
+type Notification struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NotificationSpec   `json:"spec,omitempty"`
+	Status NotificationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NotificationList contains a list of Notification
+type NotificationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Notification `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Notification{}, &NotificationList{})
+}
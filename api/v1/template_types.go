@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,30 +29,155 @@ const (
 )
 
 type PodTemplate struct {
-	Image   string            `json:"image"`
+	// Image of the main experiment container, it can be empty if Containers is set
+	Image   string            `json:"image,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
 	Command []string          `json:"command,omitempty"`
+	// Resources of experiment container, the defaults of namespace LimitRange are used if empty
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Containers are sidecars running beside the main experiment container
+	Containers []ContainerTemplate `json:"containers,omitempty"`
+	// InitContainers run in order after data volume seeded
+	InitContainers []ContainerTemplate `json:"initContainers,omitempty"`
+}
+
+// ContainerTemplate describes an extra container of experiment pod,
+// the data volume is mounted into every container
+type ContainerTemplate struct {
+	Name      string                       `json:"name"`
+	Image     string                       `json:"image"`
+	Env       map[string]string            `json:"env,omitempty"`
+	Command   []string                     `json:"command,omitempty"`
+	Args      []string                     `json:"args,omitempty"`
+	Ports     []corev1.ContainerPort       `json:"ports,omitempty"`
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// VolumeMounts can mount the data volume named "data-volume" at other paths
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// Essential containers must be ready before experiment becomes running,
+	// the main experiment container is always essential
+	Essential bool `json:"essential,omitempty"`
 }
 
+type TemplateUpdatePolicy string
+
+const (
+	// UpdateImmediate recreates running env pods as soon as template changed
+	UpdateImmediate TemplateUpdatePolicy = "Immediate"
+	// UpdateOnResume applies template changes when paused experiments resume
+	UpdateOnResume TemplateUpdatePolicy = "OnResume"
+	// UpdateNever keeps env pods as they were created
+	UpdateNever TemplateUpdatePolicy = "Never"
+)
+
 // TemplateData defines the desired state of Template
 type TemplateData struct {
-	Type            TemplateType              `json:"type"`
-	PodTemplate     *PodTemplate              `json:"podTemplate"`
-	IngressProtocol ExperimentIngressProtocol `json:"ingressProtocol"`
-	IngressPort     int32                     `json:"ingressPort"`
+	Type        TemplateType `json:"type"`
+	PodTemplate *PodTemplate `json:"podTemplate"`
+	// IngressProtocol and IngressPort define a single endpoint named by protocol,
+	// they are ignored if Endpoints is set
+	IngressProtocol ExperimentIngressProtocol `json:"ingressProtocol,omitempty"`
+	IngressPort     int32                     `json:"ingressPort,omitempty"`
 
 	VNC *VNCConfig `json:"vnc,omitempty"`
 	SSH *SSHConfig `json:"ssh,omitempty"`
+
+	// Endpoints exposed by experiment, each endpoint has its own protocol, port and credentials
+	Endpoints []EndpointTemplate `json:"endpoints,omitempty"`
+
+	// DataSource is unpacked into the data volume once per experiment
+	DataSource *DataSource `json:"dataSource,omitempty"`
+	// DataVolume configures the data volume mounted into experiment
+	DataVolume *DataVolumeTemplate `json:"dataVolume,omitempty"`
+	// UpdatePolicy decides how template changes reach running experiments, OnResume by default
+	// +kubebuilder:validation:Enum=Immediate;OnResume;Never
+	UpdatePolicy TemplateUpdatePolicy `json:"updatePolicy,omitempty"`
+}
+
+type DataVolumeBackend string
+
+const (
+	// HostPathDataVolume creates volume in host directory, only for single node cluster
+	HostPathDataVolume DataVolumeBackend = "HostPath"
+	// LocalDataVolume creates volume in host directory and pins experiment to the node
+	LocalDataVolume DataVolumeBackend = "Local"
+	// DynamicDataVolume lets the storage class provision volume
+	DynamicDataVolume DataVolumeBackend = "Dynamic"
+)
+
+type DataVolumeTemplate struct {
+	// Backend of data volume, the controller default is used if empty
+	// +kubebuilder:validation:Enum=HostPath;Local;Dynamic
+	Backend DataVolumeBackend `json:"backend,omitempty"`
+	// Size of data volume, 10Gi by default
+	Size *resource.Quantity `json:"size,omitempty"`
+	// MaxSize limits the size an experiment can request,
+	// experiments can not request more than Size if MaxSize is empty
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// StorageClassName overrides the storage class configured by controller
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	// MountPath of data volume in experiment container, /data by default
+	MountPath string `json:"mountPath,omitempty"`
+	// RetentionPeriod keeps the data volume after experiment deleted,
+	// the controller default is used if empty
+	RetentionPeriod *metav1.Duration `json:"retentionPeriod,omitempty"`
+}
+
+// DataSource describes the starter content of experiment data volume,
+// only one of Git, Archive and ConfigMap should be set
+type DataSource struct {
+	Git       *GitDataSource       `json:"git,omitempty"`
+	Archive   *ArchiveDataSource   `json:"archive,omitempty"`
+	ConfigMap *ConfigMapDataSource `json:"configMap,omitempty"`
+}
+
+type GitDataSource struct {
+	URL string `json:"url"`
+	// Ref is a branch, tag or commit, the default branch is used if empty
+	Ref string `json:"ref,omitempty"`
+	// KeepHistory copies the .git directory into data volume, only the work tree is copied by default
+	KeepHistory bool `json:"keepHistory,omitempty"`
+}
+
+type ArchiveDataSource struct {
+	// URL of a .tar, .tar.gz, .tgz or .zip file
+	URL string `json:"url"`
+}
+
+type ConfigMapDataSource struct {
+	// Name of a ConfigMap in the same namespace, every key is written as a file
+	Name string `json:"name"`
+}
+
+// TemplateStatus defines the observed state of Template
+type TemplateStatus struct {
+	// CurrentRevision is the name of revision matching current template data
+	CurrentRevision string                   `json:"currentRevision,omitempty"`
+	Revisions       []TemplateRevisionStatus `json:"revisions,omitempty"`
+}
+
+type TemplateRevisionStatus struct {
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+	// Experiments is the count of experiments running this revision
+	Experiments int32 `json:"experiments"`
 }
 
 // +kubebuilder:object:root=true
 
-// Template is the Schema for the templates API
+// Template is the Schema for the templates API.
+// When experiments have authorized keys, the image of every container serving an ssh endpoint
+// must provide sh, cp, chmod and chown, they install the keys in an init container running as root.
+// The ssh user should exist in the image, the keys file is left owned by root otherwise
+// +kubebuilder:printcolumn:name="Revision",type=string,JSONPath=`.status.currentRevision`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
 type Template struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Data TemplateData `json:"data,omitempty"`
+	Data   TemplateData   `json:"data,omitempty"`
+	Status TemplateStatus `json:"status,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -62,15 +189,39 @@ type TemplateList struct {
 	Items           []Template `json:"items"`
 }
 
+type EndpointTemplate struct {
+	// Name is used as service port name, must be unique in template
+	Name     string                    `json:"name"`
+	Protocol ExperimentIngressProtocol `json:"protocol"`
+	// Port is the container port of endpoint
+	Port int32 `json:"port"`
+	// Service groups endpoints into one ingress service, every endpoint has its own service if empty
+	Service string `json:"service,omitempty"`
+
+	VNC *VNCConfig `json:"vnc,omitempty"`
+	SSH *SSHConfig `json:"ssh,omitempty"`
+}
+
 type VNCConfig struct {
 	Username string `json:"username"`
-	Password string `json:"password"`
+	// Password is ignored with a warning, every experiment gets a generated password in PasswordEnv
+	Password string `json:"password,omitempty"`
+	// PasswordEnv is the env name receiving the random password generated for each experiment,
+	// <ENDPOINT>_PASSWORD by default
+	PasswordEnv string `json:"passwordEnv,omitempty"`
 }
 
 type SSHConfig struct {
 	Username string `json:"username"`
+	// Password is ignored with a warning, every experiment gets a generated password in PasswordEnv
 	Password string `json:"password,omitempty"`
 	Key      string `json:"key,omitempty"`
+	// PasswordEnv is the env name receiving the random password generated for each experiment,
+	// <ENDPOINT>_PASSWORD by default
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	// AuthorizedKeysPath is where experiment authorized keys are mounted, ~username/.ssh/authorized_keys by default.
+	// Username must be a portable unix user name for keys to be installed
+	AuthorizedKeysPath string `json:"authorizedKeysPath,omitempty"`
 }
 
 func init() {
@@ -0,0 +1,54 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+
+// TemplateRevision is an immutable snapshot of Template data, it is created
+// by controller whenever template data changes. Updates of the snapshot are rejected
+// by validating webhook, and experiments refuse revisions whose data does not match hash.
+// Revisions not referenced by experiments, experiment sets or pools are pruned beyond the
+// history limit of controller
+// +kubebuilder:printcolumn:name="Template",type=string,JSONPath=`.template`
+// +kubebuilder:printcolumn:name="Revision",type=integer,JSONPath=`.revision`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type TemplateRevision struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Template string       `json:"template"`
+	Revision int64        `json:"revision"`
+	Hash     string       `json:"hash"`
+	Data     TemplateData `json:"data"`
+}
+
+// +kubebuilder:object:root=true
+
+// TemplateRevisionList contains a list of TemplateRevision
+type TemplateRevisionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TemplateRevision `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TemplateRevision{}, &TemplateRevisionList{})
+}
@@ -21,9 +21,47 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArchiveDataSource) DeepCopyInto(out *ArchiveDataSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArchiveDataSource.
+func (in *ArchiveDataSource) DeepCopy() *ArchiveDataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ArchiveDataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthorizedKeySource) DeepCopyInto(out *AuthorizedKeySource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthorizedKeySource.
+func (in *AuthorizedKeySource) DeepCopy() *AuthorizedKeySource {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthorizedKeySource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterCondition) DeepCopyInto(out *ClusterCondition) {
 	*out = *in
@@ -41,6 +79,85 @@ func (in *ClusterCondition) DeepCopy() *ClusterCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapDataSource) DeepCopyInto(out *ConfigMapDataSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapDataSource.
+func (in *ConfigMapDataSource) DeepCopy() *ConfigMapDataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapDataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerTemplate) DeepCopyInto(out *ContainerTemplate) {
+	*out = *in
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]corev1.ContainerPort, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerTemplate.
+func (in *ContainerTemplate) DeepCopy() *ContainerTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsReference) DeepCopyInto(out *CredentialsReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsReference.
+func (in *CredentialsReference) DeepCopy() *CredentialsReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomCluster) DeepCopyInto(out *CustomCluster) {
 	*out = *in
@@ -55,119 +172,1116 @@ func (in *CustomCluster) DeepCopy() *CustomCluster {
 	if in == nil {
 		return nil
 	}
-	out := new(CustomCluster)
+	out := new(CustomCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CustomCluster) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomClusterList) DeepCopyInto(out *CustomClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CustomCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomClusterList.
+func (in *CustomClusterList) DeepCopy() *CustomClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CustomClusterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomClusterSpec) DeepCopyInto(out *CustomClusterSpec) {
+	*out = *in
+	if in.PublishIps != nil {
+		in, out := &in.PublishIps, &out.PublishIps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrivateIps != nil {
+		in, out := &in.PrivateIps, &out.PrivateIps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomClusterSpec.
+func (in *CustomClusterSpec) DeepCopy() *CustomClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomClusterStatus) DeepCopyInto(out *CustomClusterStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ClusterCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomClusterStatus.
+func (in *CustomClusterStatus) DeepCopy() *CustomClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataSource) DeepCopyInto(out *DataSource) {
+	*out = *in
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		*out = new(GitDataSource)
+		**out = **in
+	}
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(ArchiveDataSource)
+		**out = **in
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ConfigMapDataSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataSource.
+func (in *DataSource) DeepCopy() *DataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(DataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataVolumeTemplate) DeepCopyInto(out *DataVolumeTemplate) {
+	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.RetentionPeriod != nil {
+		in, out := &in.RetentionPeriod, &out.RetentionPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataVolumeTemplate.
+func (in *DataVolumeTemplate) DeepCopy() *DataVolumeTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(DataVolumeTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointConnection) DeepCopyInto(out *EndpointConnection) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointConnection.
+func (in *EndpointConnection) DeepCopy() *EndpointConnection {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointConnection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointTemplate) DeepCopyInto(out *EndpointTemplate) {
+	*out = *in
+	if in.VNC != nil {
+		in, out := &in.VNC, &out.VNC
+		*out = new(VNCConfig)
+		**out = **in
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointTemplate.
+func (in *EndpointTemplate) DeepCopy() *EndpointTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Experiment) DeepCopyInto(out *Experiment) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Experiment.
+func (in *Experiment) DeepCopy() *Experiment {
+	if in == nil {
+		return nil
+	}
+	out := new(Experiment)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Experiment) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentClaim) DeepCopyInto(out *ExperimentClaim) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentClaim.
+func (in *ExperimentClaim) DeepCopy() *ExperimentClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentClaim) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentClaimList) DeepCopyInto(out *ExperimentClaimList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ExperimentClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentClaimList.
+func (in *ExperimentClaimList) DeepCopy() *ExperimentClaimList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentClaimList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentClaimList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentClaimSpec) DeepCopyInto(out *ExperimentClaimSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AuthorizedKeys != nil {
+		in, out := &in.AuthorizedKeys, &out.AuthorizedKeys
+		*out = make([]AuthorizedKeySource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Owner != nil {
+		in, out := &in.Owner, &out.Owner
+		*out = new(ExperimentSubject)
+		**out = **in
+	}
+	if in.Mentors != nil {
+		in, out := &in.Mentors, &out.Mentors
+		*out = make([]ExperimentSubject, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentClaimSpec.
+func (in *ExperimentClaimSpec) DeepCopy() *ExperimentClaimSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentClaimSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentClaimStatus) DeepCopyInto(out *ExperimentClaimStatus) {
+	*out = *in
+	if in.BoundTime != nil {
+		in, out := &in.BoundTime, &out.BoundTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentClaimStatus.
+func (in *ExperimentClaimStatus) DeepCopy() *ExperimentClaimStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentClaimStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentCondition) DeepCopyInto(out *ExperimentCondition) {
+	*out = *in
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentCondition.
+func (in *ExperimentCondition) DeepCopy() *ExperimentCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentDataVolumeStatus) DeepCopyInto(out *ExperimentDataVolumeStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentDataVolumeStatus.
+func (in *ExperimentDataVolumeStatus) DeepCopy() *ExperimentDataVolumeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentDataVolumeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentEndpointStatus) DeepCopyInto(out *ExperimentEndpointStatus) {
+	*out = *in
+	if in.IngressIPs != nil {
+		in, out := &in.IngressIPs, &out.IngressIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.VNC != nil {
+		in, out := &in.VNC, &out.VNC
+		*out = new(VNCConfig)
+		**out = **in
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHConfig)
+		**out = **in
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(CredentialsReference)
+		**out = **in
+	}
+	if in.Connection != nil {
+		in, out := &in.Connection, &out.Connection
+		*out = new(EndpointConnection)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentEndpointStatus.
+func (in *ExperimentEndpointStatus) DeepCopy() *ExperimentEndpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentEndpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentList) DeepCopyInto(out *ExperimentList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Experiment, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentList.
+func (in *ExperimentList) DeepCopy() *ExperimentList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentOverride) DeepCopyInto(out *ExperimentOverride) {
+	*out = *in
+	if in.Pause != nil {
+		in, out := &in.Pause, &out.Pause
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(ExperimentSource)
+		**out = **in
+	}
+	if in.DataVolumeSize != nil {
+		in, out := &in.DataVolumeSize, &out.DataVolumeSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AuthorizedKeys != nil {
+		in, out := &in.AuthorizedKeys, &out.AuthorizedKeys
+		*out = make([]AuthorizedKeySource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Owner != nil {
+		in, out := &in.Owner, &out.Owner
+		*out = new(ExperimentSubject)
+		**out = **in
+	}
+	if in.Mentors != nil {
+		in, out := &in.Mentors, &out.Mentors
+		*out = make([]ExperimentSubject, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentOverride.
+func (in *ExperimentOverride) DeepCopy() *ExperimentOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentPool) DeepCopyInto(out *ExperimentPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentPool.
+func (in *ExperimentPool) DeepCopy() *ExperimentPool {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentPoolList) DeepCopyInto(out *ExperimentPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ExperimentPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentPoolList.
+func (in *ExperimentPoolList) DeepCopy() *ExperimentPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentPoolSpec) DeepCopyInto(out *ExperimentPoolSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentPoolSpec.
+func (in *ExperimentPoolSpec) DeepCopy() *ExperimentPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentPoolStatus) DeepCopyInto(out *ExperimentPoolStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentPoolStatus.
+func (in *ExperimentPoolStatus) DeepCopy() *ExperimentPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentQuota) DeepCopyInto(out *ExperimentQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentQuota.
+func (in *ExperimentQuota) DeepCopy() *ExperimentQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentQuotaLimits) DeepCopyInto(out *ExperimentQuotaLimits) {
+	*out = *in
+	if in.Experiments != nil {
+		in, out := &in.Experiments, &out.Experiments
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.DataVolume != nil {
+		in, out := &in.DataVolume, &out.DataVolume
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentQuotaLimits.
+func (in *ExperimentQuotaLimits) DeepCopy() *ExperimentQuotaLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentQuotaLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentQuotaList) DeepCopyInto(out *ExperimentQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ExperimentQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentQuotaList.
+func (in *ExperimentQuotaList) DeepCopy() *ExperimentQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentQuotaSpec) DeepCopyInto(out *ExperimentQuotaSpec) {
+	*out = *in
+	in.Hard.DeepCopyInto(&out.Hard)
+	in.PerOwner.DeepCopyInto(&out.PerOwner)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentQuotaSpec.
+func (in *ExperimentQuotaSpec) DeepCopy() *ExperimentQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentQuotaStatus) DeepCopyInto(out *ExperimentQuotaStatus) {
+	*out = *in
+	in.Used.DeepCopyInto(&out.Used)
+	if in.Owners != nil {
+		in, out := &in.Owners, &out.Owners
+		*out = make([]OwnerQuotaUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentQuotaStatus.
+func (in *ExperimentQuotaStatus) DeepCopy() *ExperimentQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentQuotaUsage) DeepCopyInto(out *ExperimentQuotaUsage) {
+	*out = *in
+	out.CPU = in.CPU.DeepCopy()
+	out.Memory = in.Memory.DeepCopy()
+	out.DataVolume = in.DataVolume.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentQuotaUsage.
+func (in *ExperimentQuotaUsage) DeepCopy() *ExperimentQuotaUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentQuotaUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSet) DeepCopyInto(out *ExperimentSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSet.
+func (in *ExperimentSet) DeepCopy() *ExperimentSet {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSetList) DeepCopyInto(out *ExperimentSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ExperimentSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSetList.
+func (in *ExperimentSetList) DeepCopy() *ExperimentSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExperimentSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSetRollout) DeepCopyInto(out *ExperimentSetRollout) {
+	*out = *in
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSetRollout.
+func (in *ExperimentSetRollout) DeepCopy() *ExperimentSetRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSetRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSetSpec) DeepCopyInto(out *ExperimentSetSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Teams != nil {
+		in, out := &in.Teams, &out.Teams
+		*out = make([]ExperimentSetTeam, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Template.DeepCopyInto(&out.Template)
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(ExperimentSetRollout)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSetSpec.
+func (in *ExperimentSetSpec) DeepCopy() *ExperimentSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSetStatus) DeepCopyInto(out *ExperimentSetStatus) {
+	*out = *in
+	if in.Teams != nil {
+		in, out := &in.Teams, &out.Teams
+		*out = make([]ExperimentSetTeamStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSetStatus.
+func (in *ExperimentSetStatus) DeepCopy() *ExperimentSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSetTeam) DeepCopyInto(out *ExperimentSetTeam) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Override != nil {
+		in, out := &in.Override, &out.Override
+		*out = new(ExperimentOverride)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSetTeam.
+func (in *ExperimentSetTeam) DeepCopy() *ExperimentSetTeam {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSetTeam)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSetTeamStatus) DeepCopyInto(out *ExperimentSetTeamStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSetTeamStatus.
+func (in *ExperimentSetTeamStatus) DeepCopy() *ExperimentSetTeamStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSetTeamStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSource) DeepCopyInto(out *ExperimentSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSource.
+func (in *ExperimentSource) DeepCopy() *ExperimentSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSpec) DeepCopyInto(out *ExperimentSpec) {
+	*out = *in
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(ExperimentSource)
+		**out = **in
+	}
+	if in.DataVolumeSize != nil {
+		in, out := &in.DataVolumeSize, &out.DataVolumeSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AuthorizedKeys != nil {
+		in, out := &in.AuthorizedKeys, &out.AuthorizedKeys
+		*out = make([]AuthorizedKeySource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Owner != nil {
+		in, out := &in.Owner, &out.Owner
+		*out = new(ExperimentSubject)
+		**out = **in
+	}
+	if in.Mentors != nil {
+		in, out := &in.Mentors, &out.Mentors
+		*out = make([]ExperimentSubject, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSpec.
+func (in *ExperimentSpec) DeepCopy() *ExperimentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExperimentSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CustomCluster) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CustomClusterList) DeepCopyInto(out *CustomClusterList) {
+func (in *ExperimentStatus) DeepCopyInto(out *ExperimentStatus) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]CustomCluster, len(*in))
+	if in.IngressIPs != nil {
+		in, out := &in.IngressIPs, &out.IngressIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ExperimentCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VNC != nil {
+		in, out := &in.VNC, &out.VNC
+		*out = new(VNCConfig)
+		**out = **in
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHConfig)
+		**out = **in
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]ExperimentEndpointStatus, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.DataVolume != nil {
+		in, out := &in.DataVolume, &out.DataVolume
+		*out = new(ExperimentDataVolumeStatus)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomClusterList.
-func (in *CustomClusterList) DeepCopy() *CustomClusterList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentStatus.
+func (in *ExperimentStatus) DeepCopy() *ExperimentStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(CustomClusterList)
+	out := new(ExperimentStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CustomClusterList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExperimentSubject) DeepCopyInto(out *ExperimentSubject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSubject.
+func (in *ExperimentSubject) DeepCopy() *ExperimentSubject {
+	if in == nil {
+		return nil
 	}
-	return nil
+	out := new(ExperimentSubject)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CustomClusterSpec) DeepCopyInto(out *CustomClusterSpec) {
+func (in *ExperimentTemplateSpec) DeepCopyInto(out *ExperimentTemplateSpec) {
 	*out = *in
-	if in.PublishIps != nil {
-		in, out := &in.PublishIps, &out.PublishIps
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
 	}
-	if in.PrivateIps != nil {
-		in, out := &in.PrivateIps, &out.PrivateIps
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
 	}
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomClusterSpec.
-func (in *CustomClusterSpec) DeepCopy() *CustomClusterSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentTemplateSpec.
+func (in *ExperimentTemplateSpec) DeepCopy() *ExperimentTemplateSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(CustomClusterSpec)
+	out := new(ExperimentTemplateSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CustomClusterStatus) DeepCopyInto(out *CustomClusterStatus) {
+func (in *GitDataSource) DeepCopyInto(out *GitDataSource) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]ClusterCondition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomClusterStatus.
-func (in *CustomClusterStatus) DeepCopy() *CustomClusterStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitDataSource.
+func (in *GitDataSource) DeepCopy() *GitDataSource {
 	if in == nil {
 		return nil
 	}
-	out := new(CustomClusterStatus)
+	out := new(GitDataSource)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Experiment) DeepCopyInto(out *Experiment) {
+func (in *Notification) DeepCopyInto(out *Notification) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Experiment.
-func (in *Experiment) DeepCopy() *Experiment {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notification.
+func (in *Notification) DeepCopy() *Notification {
 	if in == nil {
 		return nil
 	}
-	out := new(Experiment)
+	out := new(Notification)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *Experiment) DeepCopyObject() runtime.Object {
+func (in *Notification) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -175,48 +1289,31 @@ func (in *Experiment) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ExperimentCondition) DeepCopyInto(out *ExperimentCondition) {
-	*out = *in
-	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentCondition.
-func (in *ExperimentCondition) DeepCopy() *ExperimentCondition {
-	if in == nil {
-		return nil
-	}
-	out := new(ExperimentCondition)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ExperimentList) DeepCopyInto(out *ExperimentList) {
+func (in *NotificationList) DeepCopyInto(out *NotificationList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]Experiment, len(*in))
+		*out = make([]Notification, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentList.
-func (in *ExperimentList) DeepCopy() *ExperimentList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationList.
+func (in *NotificationList) DeepCopy() *NotificationList {
 	if in == nil {
 		return nil
 	}
-	out := new(ExperimentList)
+	out := new(NotificationList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *ExperimentList) DeepCopyObject() runtime.Object {
+func (in *NotificationList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -224,53 +1321,66 @@ func (in *ExperimentList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ExperimentSpec) DeepCopyInto(out *ExperimentSpec) {
+func (in *NotificationSpec) DeepCopyInto(out *NotificationSpec) {
 	*out = *in
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]NotificationEventType, len(*in))
+		copy(*out, *in)
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxRetries != nil {
+		in, out := &in.MaxRetries, &out.MaxRetries
+		*out = new(int32)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentSpec.
-func (in *ExperimentSpec) DeepCopy() *ExperimentSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationSpec.
+func (in *NotificationSpec) DeepCopy() *NotificationSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(ExperimentSpec)
+	out := new(NotificationSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ExperimentStatus) DeepCopyInto(out *ExperimentStatus) {
+func (in *NotificationStatus) DeepCopyInto(out *NotificationStatus) {
 	*out = *in
-	if in.IngressIPs != nil {
-		in, out := &in.IngressIPs, &out.IngressIPs
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]ExperimentCondition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.LastDeliveryTime != nil {
+		in, out := &in.LastDeliveryTime, &out.LastDeliveryTime
+		*out = (*in).DeepCopy()
 	}
-	if in.VNC != nil {
-		in, out := &in.VNC, &out.VNC
-		*out = new(VNCConfig)
-		**out = **in
-	}
-	if in.SSH != nil {
-		in, out := &in.SSH, &out.SSH
-		*out = new(SSHConfig)
-		**out = **in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationStatus.
+func (in *NotificationStatus) DeepCopy() *NotificationStatus {
+	if in == nil {
+		return nil
 	}
+	out := new(NotificationStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExperimentStatus.
-func (in *ExperimentStatus) DeepCopy() *ExperimentStatus {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OwnerQuotaUsage) DeepCopyInto(out *OwnerQuotaUsage) {
+	*out = *in
+	in.Used.DeepCopyInto(&out.Used)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OwnerQuotaUsage.
+func (in *OwnerQuotaUsage) DeepCopy() *OwnerQuotaUsage {
 	if in == nil {
 		return nil
 	}
-	out := new(ExperimentStatus)
+	out := new(OwnerQuotaUsage)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -290,6 +1400,25 @@ func (in *PodTemplate) DeepCopyInto(out *PodTemplate) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]ContainerTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InitContainers != nil {
+		in, out := &in.InitContainers, &out.InitContainers
+		*out = make([]ContainerTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodTemplate.
@@ -323,6 +1452,7 @@ func (in *Template) DeepCopyInto(out *Template) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Data.DeepCopyInto(&out.Data)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Template.
@@ -361,6 +1491,23 @@ func (in *TemplateData) DeepCopyInto(out *TemplateData) {
 		*out = new(SSHConfig)
 		**out = **in
 	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]EndpointTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DataSource != nil {
+		in, out := &in.DataSource, &out.DataSource
+		*out = new(DataSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DataVolume != nil {
+		in, out := &in.DataVolume, &out.DataVolume
+		*out = new(DataVolumeTemplate)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateData.
@@ -405,6 +1552,99 @@ func (in *TemplateList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRevision) DeepCopyInto(out *TemplateRevision) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Data.DeepCopyInto(&out.Data)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRevision.
+func (in *TemplateRevision) DeepCopy() *TemplateRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TemplateRevision) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRevisionList) DeepCopyInto(out *TemplateRevisionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TemplateRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRevisionList.
+func (in *TemplateRevisionList) DeepCopy() *TemplateRevisionList {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRevisionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TemplateRevisionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRevisionStatus) DeepCopyInto(out *TemplateRevisionStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRevisionStatus.
+func (in *TemplateRevisionStatus) DeepCopy() *TemplateRevisionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRevisionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateStatus) DeepCopyInto(out *TemplateStatus) {
+	*out = *in
+	if in.Revisions != nil {
+		in, out := &in.Revisions, &out.Revisions
+		*out = make([]TemplateRevisionStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateStatus.
+func (in *TemplateStatus) DeepCopy() *TemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VNCConfig) DeepCopyInto(out *VNCConfig) {
 	*out = *in
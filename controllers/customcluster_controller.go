@@ -128,6 +128,7 @@ func (r *CustomClusterReconciler) isMarkedForDeletion(cluster *hackathonv1.Custo
 }
 
 func (r *CustomClusterReconciler) updateStatus(ctx context.Context, status *customcluster.Status) error {
+	lost := status.Cluster.Status.Status != hackathonv1.ClusterLost && status.Status.Status == hackathonv1.ClusterLost
 	events, crt := status.Apply()
 	if crt == nil {
 		return nil
@@ -141,7 +142,13 @@ func (r *CustomClusterReconciler) updateStatus(ctx context.Context, status *cust
 		"namespace", crt.Namespace,
 		"name", crt.Name,
 	)
-	return r.Client.Status().Update(ctx, crt)
+	if err := r.Client.Status().Update(ctx, crt); err != nil {
+		return err
+	}
+	if lost {
+		eventbus.Publish(eventbus.CustomClusterLostTopic, crt.DeepCopy())
+	}
+	return nil
 }
 
 func (r *CustomClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -21,8 +21,12 @@ import (
 	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
 	"github.com/kaiyuanshe/cloudengine/pkg/eventbus"
 	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/collection"
 	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
@@ -31,6 +35,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
 )
@@ -38,20 +45,31 @@ import (
 // ExperimentReconciler reconciles a Experiment object
 type ExperimentReconciler struct {
 	client.Client
-	Recorder record.EventRecorder
-	Log      logr.Logger
-	Scheme   *runtime.Scheme
+	// APIReader reads pod events without caching all events of cluster
+	APIReader client.Reader
+	Recorder  record.EventRecorder
+	Log       logr.Logger
+	Scheme    *runtime.Scheme
 }
 
 // +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experiments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experiments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experiments/finalizers,verbs=update
 // +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=templates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=templates/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;delete;patch;update
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;delete;patch;update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;delete;patch;update
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;delete;patch;update
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=limitranges,verbs=get;list;watch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;delete;patch;update
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete;patch;update
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;delete;patch;update
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;delete;patch;update
 
 func (r *ExperimentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -66,17 +84,45 @@ func (r *ExperimentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	}
 
 	// expr deleted
-	if expr == nil || !expr.DeletionTimestamp.IsZero() {
+	if expr == nil || (!expr.DeletionTimestamp.IsZero() && !collection.ContainsString(expr.Finalizers, experiment.DataVolumeFinalizer)) {
 		logger.Info("experiment has deleted, publish topic")
 		eventbus.Publish(eventbus.ExperimentDeletedTopic, req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
+	controller := &experiment.Controller{
+		Client:    r.Client,
+		APIReader: r.APIReader,
+		Logger:    logger.WithName("ExperimentController"),
+	}
 	status := experiment.NewStatus(expr)
-	result.WithResult((&experiment.Controller{
-		Client: r.Client,
-		Logger: logger.WithName("ExperimentController"),
-	}).Reconcile(ctx, status))
+
+	if !expr.DeletionTimestamp.IsZero() {
+		logger.Info("experiment is deleting, reclaim data volume")
+		finalizeResult, done := controller.Finalize(ctx, status)
+		result.WithResult(finalizeResult)
+		if err = r.updateStatus(ctx, status); err != nil {
+			logger.Error(err, "update experiment status failed")
+			return result.WithError(err).Aggregate()
+		}
+		if done {
+			expr.Finalizers = collection.RemoveString(expr.Finalizers, experiment.DataVolumeFinalizer)
+			if err = r.Client.Update(ctx, expr); err != nil {
+				logger.Error(err, "remove experiment finalizer failed")
+			}
+		}
+		return result.WithError(err).Aggregate()
+	}
+
+	if !collection.ContainsString(expr.Finalizers, experiment.DataVolumeFinalizer) {
+		expr.Finalizers = append(expr.Finalizers, experiment.DataVolumeFinalizer)
+		if err = r.Client.Update(ctx, expr); err != nil {
+			logger.Error(err, "add experiment finalizer failed")
+			return ctrl.Result{}, err
+		}
+	}
+
+	result.WithResult(controller.Reconcile(ctx, status))
 	err = r.updateStatus(ctx, status)
 	if err != nil {
 		logger.Error(err, "update experiment status failed")
@@ -95,6 +141,7 @@ func (r *ExperimentReconciler) fetchExperiment(ctx context.Context, name types.N
 
 func (r *ExperimentReconciler) updateStatus(ctx context.Context, status *experiment.Status) error {
 	log := r.Log.WithValues("name", status.Experiment.Name, "namespace", status.Experiment.Namespace)
+	topics := status.LifecycleTopics()
 	events, crt := status.Apply()
 	if crt == nil {
 		log.Info("not need update status")
@@ -118,14 +165,54 @@ func (r *ExperimentReconciler) updateStatus(ctx context.Context, status *experim
 			return e
 		}
 		newCrt.Status = crt.Status
-		return r.Client.Status().Update(ctx, newCrt)
+		crt = newCrt
+		err = r.Client.Status().Update(ctx, crt)
+	}
+	if err != nil {
+		return err
+	}
+
+	// lifecycle topics are published only once the status is persisted
+	for _, topic := range topics {
+		eventbus.Publish(topic, crt.DeepCopy())
+	}
+	return nil
+}
+
+// templateToExperiments enqueues experiments using the changed template
+func (r *ExperimentReconciler) templateToExperiments(obj handler.MapObject) []reconcile.Request {
+	exprList := &hackathonv1.ExperimentList{}
+	if err := r.Client.List(context.Background(), exprList, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "list experiments of template failed", "template", obj.Meta.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for _, expr := range exprList.Items {
+		if expr.Spec.Template != obj.Meta.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: expr.Namespace,
+			Name:      expr.Name,
+		}})
 	}
-	return err
+	return requests
 }
 
 func (r *ExperimentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&hackathonv1.Experiment{}).
+		Watches(&source.Kind{Type: &hackathonv1.Template{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.templateToExperiments),
+		}).
 		Owns(&corev1.Pod{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		Owns(&networkingv1beta1.Ingress{}).
+		Owns(&batchv1.Job{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
 		Complete(r)
 }
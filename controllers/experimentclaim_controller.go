@@ -0,0 +1,134 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	"github.com/kaiyuanshe/cloudengine/pkg/experimentpool"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+)
+
+// ExperimentClaimReconciler reconciles a ExperimentClaim object
+type ExperimentClaimReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentclaims/status,verbs=get;update;patch
+
+func (r *ExperimentClaimReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("experimentclaim", req.NamespacedName)
+	result := results.NewResults(ctx)
+	defer logtool.SpendTimeRecord(logger, "reconcile experiment claim")()
+
+	claim := &hackathonv1.ExperimentClaim{}
+	if err := r.Client.Get(ctx, req.NamespacedName, claim); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "fetch experiment claim failed")
+		return ctrl.Result{}, err
+	}
+	// bound experiment is deleted by garbage collector
+	if !claim.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	status := experimentpool.NewClaimStatus(claim)
+	result.WithResult((&experimentpool.ClaimController{
+		Client: r.Client,
+		Logger: logger.WithName("ExperimentClaimController"),
+	}).Reconcile(ctx, status))
+	err := r.updateStatus(ctx, status)
+	if err != nil {
+		logger.Error(err, "update experiment claim status failed")
+	}
+	return result.WithError(err).Aggregate()
+}
+
+func (r *ExperimentClaimReconciler) updateStatus(ctx context.Context, status *experimentpool.ClaimStatus) error {
+	events, crt := status.Apply()
+	for _, evt := range events {
+		r.Recorder.Event(status.Claim, evt.EventType, evt.Reason, evt.Message)
+	}
+	if crt == nil {
+		return nil
+	}
+
+	r.Log.Info("update experiment claim status", "namespace", crt.Namespace, "name", crt.Name)
+	return r.Client.Status().Update(ctx, crt)
+}
+
+// pooledExperimentToClaims enqueues pending claims of pool once a pooled experiment is available
+func (r *ExperimentClaimReconciler) pooledExperimentToClaims(obj handler.MapObject) []reconcile.Request {
+	expr, ok := obj.Object.(*hackathonv1.Experiment)
+	if !ok || !experiment.Available(expr) {
+		return nil
+	}
+	pool, ok := expr.Labels[experimentpool.LabelKeyExperimentPool]
+	if !ok {
+		return nil
+	}
+	if _, claimed := expr.Labels[experimentpool.LabelKeyClaim]; claimed {
+		return nil
+	}
+
+	claimList := &hackathonv1.ExperimentClaimList{}
+	if err := r.Client.List(context.Background(), claimList, client.InNamespace(expr.Namespace)); err != nil {
+		r.Log.Error(err, "list experiment claims failed", "namespace", expr.Namespace)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, claim := range claimList.Items {
+		if claim.Spec.Pool != pool || claim.Status.Experiment != "" {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: claim.Namespace,
+			Name:      claim.Name,
+		}})
+	}
+	return requests
+}
+
+func (r *ExperimentClaimReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hackathonv1.ExperimentClaim{}).
+		Owns(&hackathonv1.Experiment{}).
+		Watches(&source.Kind{Type: &hackathonv1.Experiment{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.pooledExperimentToClaims),
+		}).
+		Complete(r)
+}
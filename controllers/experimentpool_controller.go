@@ -0,0 +1,97 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/experimentpool"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+)
+
+// ExperimentPoolReconciler reconciles a ExperimentPool object
+type ExperimentPoolReconciler struct {
+	client.Client
+	// APIReader lists pooled experiments without cache lag
+	APIReader client.Reader
+	Recorder  record.EventRecorder
+	Log       logr.Logger
+	Scheme    *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentpools,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentpools/status,verbs=get;update;patch
+
+func (r *ExperimentPoolReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("experimentpool", req.NamespacedName)
+	result := results.NewResults(ctx)
+	defer logtool.SpendTimeRecord(logger, "reconcile experiment pool")()
+
+	pool := &hackathonv1.ExperimentPool{}
+	if err := r.Client.Get(ctx, req.NamespacedName, pool); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "fetch experiment pool failed")
+		return ctrl.Result{}, err
+	}
+	// unassigned experiments are deleted by garbage collector
+	if !pool.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	status := experimentpool.NewPoolStatus(pool)
+	result.WithResult((&experimentpool.PoolController{
+		Client:    r.Client,
+		APIReader: r.APIReader,
+		Logger:    logger.WithName("ExperimentPoolController"),
+	}).Reconcile(ctx, status))
+	err := r.updateStatus(ctx, status)
+	if err != nil {
+		logger.Error(err, "update experiment pool status failed")
+	}
+	return result.WithError(err).Aggregate()
+}
+
+func (r *ExperimentPoolReconciler) updateStatus(ctx context.Context, status *experimentpool.PoolStatus) error {
+	events, crt := status.Apply()
+	for _, evt := range events {
+		r.Recorder.Event(status.Pool, evt.EventType, evt.Reason, evt.Message)
+	}
+	if crt == nil {
+		return nil
+	}
+
+	r.Log.Info("update experiment pool status", "namespace", crt.Namespace, "name", crt.Name)
+	return r.Client.Status().Update(ctx, crt)
+}
+
+func (r *ExperimentPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hackathonv1.ExperimentPool{}).
+		Owns(&hackathonv1.Experiment{}).
+		Complete(r)
+}
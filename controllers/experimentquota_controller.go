@@ -0,0 +1,106 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/kaiyuanshe/cloudengine/pkg/quota"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+)
+
+// ExperimentQuotaReconciler refreshes the usage in ExperimentQuota status,
+// quota is enforced by the experiment validating webhook
+type ExperimentQuotaReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentquotas,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentquotas/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=templaterevisions,verbs=get;list;watch
+
+func (r *ExperimentQuotaReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("experimentquota", req.NamespacedName)
+	defer logtool.SpendTimeRecord(logger, "reconcile experiment quota")()
+
+	q := &hackathonv1.ExperimentQuota{}
+	if err := r.Client.Get(ctx, req.NamespacedName, q); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "fetch experiment quota failed")
+		return ctrl.Result{}, err
+	}
+
+	usages, err := quota.ListUsage(ctx, r.Client, q.Namespace, "")
+	if err != nil {
+		logger.Error(err, "list experiment usage failed")
+		return ctrl.Result{}, err
+	}
+	status := quota.Summarize(q, usages)
+	if equality.Semantic.DeepEqual(*status, q.Status) {
+		return ctrl.Result{}, nil
+	}
+
+	q.Status = *status
+	logger.Info("update experiment quota status")
+	if err = r.Client.Status().Update(ctx, q); err != nil {
+		logger.Error(err, "update experiment quota status failed")
+	}
+	return ctrl.Result{}, err
+}
+
+// experimentToQuotas enqueues all quotas in namespace of changed experiment
+func (r *ExperimentQuotaReconciler) experimentToQuotas(obj handler.MapObject) []reconcile.Request {
+	quotaList := &hackathonv1.ExperimentQuotaList{}
+	if err := r.Client.List(context.Background(), quotaList, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "list experiment quotas failed", "namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for _, q := range quotaList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: q.Namespace,
+			Name:      q.Name,
+		}})
+	}
+	return requests
+}
+
+func (r *ExperimentQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hackathonv1.ExperimentQuota{}).
+		Watches(&source.Kind{Type: &hackathonv1.Experiment{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.experimentToQuotas),
+		}).
+		Complete(r)
+}
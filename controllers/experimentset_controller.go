@@ -0,0 +1,101 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/experimentset"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+)
+
+// ExperimentSetReconciler reconciles a ExperimentSet object
+type ExperimentSetReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentsets/status,verbs=get;update;patch
+
+func (r *ExperimentSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("experimentset", req.NamespacedName)
+	result := results.NewResults(ctx)
+	defer logtool.SpendTimeRecord(logger, "reconcile experiment set")()
+
+	set, err := r.fetchExperimentSet(ctx, req.NamespacedName)
+	if err != nil {
+		logger.Error(err, "fetch experiment set failed")
+		return ctrl.Result{}, err
+	}
+	// children are deleted by garbage collector
+	if set == nil || !set.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	status := experimentset.NewStatus(set)
+	result.WithResult((&experimentset.Controller{
+		Client: r.Client,
+		Logger: logger.WithName("ExperimentSetController"),
+	}).Reconcile(ctx, status))
+	err = r.updateStatus(ctx, status)
+	if err != nil {
+		logger.Error(err, "update experiment set status failed")
+	}
+	return result.WithError(err).Aggregate()
+}
+
+func (r *ExperimentSetReconciler) fetchExperimentSet(ctx context.Context, name types.NamespacedName) (*hackathonv1.ExperimentSet, error) {
+	set := &hackathonv1.ExperimentSet{}
+	err := r.Client.Get(ctx, name, set)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return set, err
+}
+
+func (r *ExperimentSetReconciler) updateStatus(ctx context.Context, status *experimentset.Status) error {
+	events, crt := status.Apply()
+	for _, evt := range events {
+		r.Recorder.Event(status.Set, evt.EventType, evt.Reason, evt.Message)
+	}
+	if crt == nil {
+		return nil
+	}
+
+	r.Log.Info("update experiment set status", "namespace", crt.Namespace, "name", crt.Name)
+	return r.Client.Status().Update(ctx, crt)
+}
+
+func (r *ExperimentSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hackathonv1.ExperimentSet{}).
+		Owns(&hackathonv1.Experiment{}).
+		Complete(r)
+}
@@ -98,11 +98,43 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(NewCustomClusterController(k8sManager)).Should(Succeed())
 
 	Expect((&ExperimentReconciler{
+		Client:    k8sClient,
+		APIReader: k8sManager.GetAPIReader(),
+		Recorder:  k8sManager.GetEventRecorderFor("experiment-controller"),
+		Log:       ctrl.Log.WithName("controllers").WithName("ExperimentReconciler"),
+		Scheme:    k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)).Should(Succeed())
+
+	Expect((&TemplateReconciler{
+		Client:   k8sClient,
+		Recorder: k8sManager.GetEventRecorderFor("template-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("TemplateReconciler"),
+		Scheme:   k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)).Should(Succeed())
+	Expect((&ExperimentSetReconciler{
 		Client:   k8sClient,
-		Recorder: k8sManager.GetEventRecorderFor("experiment-controller"),
-		Log:      ctrl.Log.WithName("controllers").WithName("ExperimentReconciler"),
+		Recorder: k8sManager.GetEventRecorderFor("experimentset-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ExperimentSetReconciler"),
 		Scheme:   k8sManager.GetScheme(),
 	}).SetupWithManager(k8sManager)).Should(Succeed())
+	Expect((&ExperimentPoolReconciler{
+		Client:    k8sClient,
+		APIReader: k8sManager.GetAPIReader(),
+		Recorder:  k8sManager.GetEventRecorderFor("experimentpool-controller"),
+		Log:       ctrl.Log.WithName("controllers").WithName("ExperimentPoolReconciler"),
+		Scheme:    k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)).Should(Succeed())
+	Expect((&ExperimentClaimReconciler{
+		Client:   k8sClient,
+		Recorder: k8sManager.GetEventRecorderFor("experimentclaim-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ExperimentClaimReconciler"),
+		Scheme:   k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)).Should(Succeed())
+	Expect((&ExperimentQuotaReconciler{
+		Client: k8sClient,
+		Log:    ctrl.Log.WithName("controllers").WithName("ExperimentQuotaReconciler"),
+		Scheme: k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)).Should(Succeed())
 
 	group := sync.WaitGroup{}
 	group.Add(2)
@@ -0,0 +1,118 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/template"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+)
+
+// TemplateReconciler reconciles a Template object
+type TemplateReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=templaterevisions,verbs=get;list;watch;create;update;patch;delete
+
+func (r *TemplateReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("template", req.NamespacedName)
+	result := results.NewResults(ctx)
+	defer logtool.SpendTimeRecord(logger, "reconcile template")()
+
+	tmpl, err := r.fetchTemplate(ctx, req.NamespacedName)
+	if err != nil {
+		logger.Error(err, "fetch template failed")
+		return ctrl.Result{}, err
+	}
+	if tmpl == nil || !tmpl.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	status := template.NewStatus(tmpl)
+	result.WithResult((&template.Controller{
+		Client: r.Client,
+		Logger: logger.WithName("TemplateController"),
+	}).Reconcile(ctx, status))
+	err = r.updateStatus(ctx, status)
+	if err != nil {
+		logger.Error(err, "update template status failed")
+	}
+	return result.WithError(err).Aggregate()
+}
+
+func (r *TemplateReconciler) fetchTemplate(ctx context.Context, name types.NamespacedName) (*hackathonv1.Template, error) {
+	tmpl := &hackathonv1.Template{}
+	err := r.Client.Get(ctx, name, tmpl)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return tmpl, err
+}
+
+func (r *TemplateReconciler) updateStatus(ctx context.Context, status *template.Status) error {
+	events, crt := status.Apply()
+	if crt == nil {
+		return nil
+	}
+
+	for _, evt := range events {
+		r.Recorder.Event(crt, evt.EventType, evt.Reason, evt.Message)
+	}
+
+	r.Log.Info("update template status", "namespace", crt.Namespace, "name", crt.Name)
+	return r.Client.Status().Update(ctx, crt)
+}
+
+// experimentToTemplate enqueues the template of changed experiment to refresh revision usage
+func (r *TemplateReconciler) experimentToTemplate(obj handler.MapObject) []reconcile.Request {
+	expr, ok := obj.Object.(*hackathonv1.Experiment)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: expr.Namespace,
+		Name:      expr.Spec.Template,
+	}}}
+}
+
+func (r *TemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hackathonv1.Template{}).
+		Owns(&hackathonv1.TemplateRevision{}).
+		Watches(&source.Kind{Type: &hackathonv1.Experiment{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.experimentToTemplate),
+		}).
+		Complete(r)
+}
@@ -21,12 +21,18 @@ import (
 	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
 	"github.com/kaiyuanshe/cloudengine/controllers"
 	"github.com/kaiyuanshe/cloudengine/pkg/customcluster"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	"github.com/kaiyuanshe/cloudengine/pkg/gateway"
+	"github.com/kaiyuanshe/cloudengine/pkg/notification"
+	"github.com/kaiyuanshe/cloudengine/pkg/quota"
+	"github.com/kaiyuanshe/cloudengine/pkg/template"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -45,16 +51,70 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var enableWebhook bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false,
+		"Enable the validating webhooks enforcing ExperimentQuota, TemplateRevision immutability and who may set owner and mentors of experiments, serving certificates are required.")
 	flag.BoolVar(&customcluster.ControllerMode, "enable-controller", false, "")
 	flag.BoolVar(&customcluster.AgentMode, "enable-agent", false, "")
+	flag.StringVar(&experiment.DataVolumeBackend, "data-volume-backend", experiment.DataVolumeBackend,
+		"The default backend of experiment data volume, one of HostPath, Local and Dynamic.")
+	flag.StringVar(&experiment.DataVolumeStorageClass, "data-volume-storage-class", experiment.DataVolumeStorageClass,
+		"The default storage class of experiment data volume.")
+	flag.StringVar(&experiment.DataVolumeSnapshotStorageClass, "data-volume-snapshot-storage-class", experiment.DataVolumeSnapshotStorageClass,
+		"The CSI storage class of data volumes restored from snapshot, used when template does not set storage class.")
+	flag.StringVar(&experiment.DataVolumeHostPathDir, "data-volume-host-path-dir", experiment.DataVolumeHostPathDir,
+		"The host directory where hostPath data volumes are created.")
+	flag.DurationVar(&experiment.DataVolumeRetention, "data-volume-retention", experiment.DataVolumeRetention,
+		"How long data volumes are kept after experiments deleted.")
+	flag.DurationVar(&experiment.DataVolumeExpiryWarning, "data-volume-expiry-warning", experiment.DataVolumeExpiryWarning,
+		"How long before a retained data volume is reclaimed the experiment.expiring notification is sent.")
+	flag.DurationVar(&experiment.EndpointProbeTimeout, "endpoint-probe-timeout", experiment.EndpointProbeTimeout,
+		"Timeout of probing experiment endpoints before marking experiments ready.")
+	flag.DurationVar(&experiment.ProvisioningTimeout, "provisioning-timeout", experiment.ProvisioningTimeout,
+		"How long an experiment can be provisioning before marked as error, zero to disable.")
+	flag.StringVar(&gateway.Addr, "gateway-addr", gateway.Addr,
+		"The address the browser gateway binds to, gateway is disabled if empty.")
+	flag.StringVar(&gateway.URL, "gateway-url", gateway.URL,
+		"The external websocket url of browser gateway, such as wss://gateway.example.com.")
+	flag.StringVar(&gateway.AllowedOrigins, "gateway-allowed-origins", gateway.AllowedOrigins,
+		"Comma separated origins of pages allowed to open gateway websockets besides the gateway url, such as https://hackathon.example.com.")
+	flag.StringVar(&gateway.TLSCertFile, "gateway-tls-cert-file", gateway.TLSCertFile,
+		"The certificate of gateway https, tls must be terminated by a proxy setting X-Forwarded-Proto if empty.")
+	flag.StringVar(&gateway.TLSKeyFile, "gateway-tls-key-file", gateway.TLSKeyFile,
+		"The private key of gateway https.")
+	flag.StringVar(&gateway.Secret, "gateway-secret", gateway.Secret,
+		"The secret used to sign gateway tokens.")
+	flag.DurationVar(&gateway.TokenTTL, "gateway-token-ttl", gateway.TokenTTL,
+		"How long signed gateway urls returned by the credentials api are valid.")
+	flag.DurationVar(&gateway.SSHIdleTimeout, "gateway-ssh-idle-timeout", gateway.SSHIdleTimeout,
+		"How long browser ssh terminals are kept without input.")
+	flag.BoolVar(&gateway.RequireOwner, "gateway-require-owner", gateway.RequireOwner,
+		"Only allow owner and mentors of experiment to connect through gateway, disable to let anyone holding a signed url connect.")
+	flag.DurationVar(&notification.RetryBackoff, "notification-retry-backoff", notification.RetryBackoff,
+		"The delay of first notification retry, it doubles on every retry.")
+	flag.DurationVar(&notification.DeliveryTimeout, "notification-delivery-timeout", notification.DeliveryTimeout,
+		"The timeout of each notification webhook request.")
+	flag.BoolVar(&notification.AllowInsecure, "notification-allow-insecure", notification.AllowInsecure,
+		"Deliver notifications to plain http webhooks.")
+	flag.BoolVar(&notification.AllowPrivateNetworks, "notification-allow-private-networks", notification.AllowPrivateNetworks,
+		"Deliver notifications to webhooks on loopback, link-local and private addresses.")
+	flag.StringVar(&notification.AllowedHosts, "notification-allowed-hosts", notification.AllowedHosts,
+		"Comma separated hosts notifications may be delivered to, a leading dot matches subdomains, all hosts if empty.")
+	flag.IntVar(&template.RevisionHistoryLimit, "template-revision-history-limit", template.RevisionHistoryLimit,
+		"The count of unreferenced template revisions kept besides the current one.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	if err := experiment.ValidateDataVolumeBackend(experiment.DataVolumeBackend); err != nil {
+		setupLog.Error(err, "invalid data-volume-backend flag")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             clientgoscheme.Scheme,
 		MetricsBindAddress: metricsAddr,
@@ -72,16 +132,97 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.ExperimentReconciler{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Recorder:  mgr.GetEventRecorderFor("experiment-controller"),
+		Log:       ctrl.Log.WithName("controllers").WithName("Experiment"),
+		Scheme:    mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Experiment")
+		os.Exit(1)
+	}
+	if err = (&controllers.TemplateReconciler{
 		Client:   mgr.GetClient(),
-		Recorder: mgr.GetEventRecorderFor("experiment-controller"),
-		Log:      ctrl.Log.WithName("controllers").WithName("Experiment"),
+		Recorder: mgr.GetEventRecorderFor("template-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("Template"),
 		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Experiment")
+		setupLog.Error(err, "unable to create controller", "controller", "Template")
+		os.Exit(1)
+	}
+	if err = (&controllers.ExperimentSetReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("experimentset-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ExperimentSet"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ExperimentSet")
+		os.Exit(1)
+	}
+	if err = (&controllers.ExperimentPoolReconciler{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Recorder:  mgr.GetEventRecorderFor("experimentpool-controller"),
+		Log:       ctrl.Log.WithName("controllers").WithName("ExperimentPool"),
+		Scheme:    mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ExperimentPool")
+		os.Exit(1)
+	}
+	if err = (&controllers.ExperimentClaimReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("experimentclaim-controller"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ExperimentClaim"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ExperimentClaim")
+		os.Exit(1)
+	}
+	if err = (&controllers.ExperimentQuotaReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ExperimentQuota"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ExperimentQuota")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	if enableWebhook {
+		mgr.GetWebhookServer().Register(quota.ValidatePath, &webhook.Admission{Handler: &quota.Validator{
+			Client: mgr.GetClient(),
+			Logger: ctrl.Log.WithName("webhook").WithName("ExperimentQuota"),
+		}})
+		mgr.GetWebhookServer().Register(template.RevisionValidatePath, &webhook.Admission{Handler: &template.RevisionValidator{
+			Logger: ctrl.Log.WithName("webhook").WithName("TemplateRevision"),
+		}})
+		mgr.GetWebhookServer().Register(experiment.AccessValidatePath, &webhook.Admission{Handler: &experiment.AccessValidator{
+			Client: mgr.GetClient(),
+			Logger: ctrl.Log.WithName("webhook").WithName("ExperimentAccess"),
+		}})
+		experiment.AccessWebhookEnabled = true
+	}
+
+	if gateway.Enabled() {
+		if err = mgr.Add(&gateway.Gateway{
+			Client: mgr.GetClient(),
+			Logger: ctrl.Log.WithName("gateway"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add gateway")
+			os.Exit(1)
+		}
+	} else if gateway.Addr != "" {
+		setupLog.Info("gateway url or secret is empty, gateway disabled")
+	}
+
+	if err = mgr.Add(&notification.Dispatcher{
+		Client: mgr.GetClient(),
+		Logger: ctrl.Log.WithName("notification"),
+	}); err != nil {
+		setupLog.Error(err, "unable to add notification dispatcher")
+		os.Exit(1)
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
@@ -115,7 +115,7 @@ func ReconcileResource(ctx context.Context, config *ResourceConfig) error {
 	}
 
 	if config.PostUpdateHook != nil {
-		if err = config.PreUpdateHook(); err != nil {
+		if err = config.PostUpdateHook(); err != nil {
 			logger.Error(err, "post update hook failed")
 			return err
 		}
@@ -5,5 +5,9 @@ type Topic string
 const (
 	CustomClusterInitTopic    Topic = "custom-cluster.lifecycle.init"
 	CustomClusterDeletedTopic       = "custom-cluster.lifecycle.deleted"
+	CustomClusterLostTopic          = "custom-cluster.lifecycle.lost"
 	ExperimentDeletedTopic          = "experiment.lifecycle.deleted"
+	ExperimentReadyTopic            = "experiment.lifecycle.ready"
+	ExperimentErrorTopic            = "experiment.lifecycle.error"
+	ExperimentExpiringTopic         = "experiment.lifecycle.expiring"
 )
@@ -0,0 +1,142 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Access grants owner and mentors to read the experiment and its credentials secret,
+// the role and binding are deleted if experiment has neither owner nor mentors, or if
+// owner and mentors are not guarded by the access webhook
+type Access struct {
+	client        client.Client
+	status        *Status
+	resourceState *ResourceState
+	logger        logr.Logger
+}
+
+func (r *Access) Reconcile(ctx context.Context) *results.Results {
+	expr := r.status.Experiment
+	result := results.NewResults(ctx)
+
+	subjects := expr.Subjects()
+	if len(subjects) == 0 || !AccessWebhookEnabled {
+		if len(subjects) > 0 && r.resourceState.AccessBinding != nil {
+			r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation,
+				"access of owner and mentors revoked, it is only granted when admission webhooks are enabled")
+		}
+		if role := r.resourceState.AccessRole; role != nil {
+			if err := client.IgnoreNotFound(r.client.Delete(ctx, role)); err != nil {
+				return result.WithError(fmt.Errorf("delete access role failed: %s", err.Error()))
+			}
+		}
+		if binding := r.resourceState.AccessBinding; binding != nil {
+			if err := client.IgnoreNotFound(r.client.Delete(ctx, binding)); err != nil {
+				return result.WithError(fmt.Errorf("delete access role binding failed: %s", err.Error()))
+			}
+		}
+		return result
+	}
+
+	expectedRole, expectedBinding, err := buildExpectedAccess(expr, subjects)
+	if err != nil {
+		return result.WithError(err)
+	}
+	if old := r.resourceState.AccessRole; old == nil {
+		if err = r.client.Create(ctx, expectedRole); err != nil {
+			r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create access role failed: %s", err.Error()))
+			return result.WithError(err)
+		}
+	} else if !reflect.DeepEqual(old.Rules, expectedRole.Rules) {
+		old.Rules = expectedRole.Rules
+		if err = r.client.Update(ctx, old); err != nil {
+			return result.WithError(fmt.Errorf("update access role failed: %s", err.Error()))
+		}
+	}
+
+	if old := r.resourceState.AccessBinding; old == nil {
+		if err = r.client.Create(ctx, expectedBinding); err != nil {
+			r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create access role binding failed: %s", err.Error()))
+			return result.WithError(err)
+		}
+		r.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, "grant access to owner and mentors")
+	} else if !reflect.DeepEqual(old.Subjects, expectedBinding.Subjects) {
+		old.Subjects = expectedBinding.Subjects
+		if err = r.client.Update(ctx, old); err != nil {
+			return result.WithError(fmt.Errorf("update access role binding failed: %s", err.Error()))
+		}
+		r.status.AddEvent(corev1.EventTypeNormal, event.ReasonUpdated, "update access of owner and mentors")
+	}
+	return result
+}
+
+func accessRoleName(experiment string) string {
+	return fmt.Sprintf("access-%s", experiment)
+}
+
+func buildExpectedAccess(expr *hackathonv1.Experiment, subjects []hackathonv1.ExperimentSubject) (*rbacv1.Role, *rbacv1.RoleBinding, error) {
+	meta := metav1.ObjectMeta{
+		Name:      accessRoleName(expr.Name),
+		Namespace: expr.Namespace,
+		Labels: map[string]string{
+			LabelKeyExperimentName: expr.Name,
+		},
+	}
+	role := &rbacv1.Role{
+		ObjectMeta: *meta.DeepCopy(),
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{hackathonv1.GroupVersion.Group},
+				Resources:     []string{"experiments"},
+				ResourceNames: []string{expr.Name},
+				Verbs:         []string{"get", "watch"},
+			},
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{credentialsSecretName(expr.Name)},
+				Verbs:         []string{"get"},
+			},
+		},
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: *meta.DeepCopy(),
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     role.Name,
+		},
+	}
+	for _, s := range subjects {
+		subject := rbacv1.Subject{Kind: s.Kind, Name: s.Name}
+		switch s.Kind {
+		case rbacv1.ServiceAccountKind:
+			subject.Namespace = s.Namespace
+			if subject.Namespace == "" {
+				subject.Namespace = expr.Namespace
+			}
+		default:
+			subject.APIGroup = rbacv1.GroupName
+		}
+		binding.Subjects = append(binding.Subjects, subject)
+	}
+
+	if err := controllerutil.SetControllerReference(expr, role.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, nil, fmt.Errorf("set access role owner ref failed: %s", err.Error())
+	}
+	if err := controllerutil.SetControllerReference(expr, binding.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, nil, fmt.Errorf("set access role binding owner ref failed: %s", err.Error())
+	}
+	return role, binding, nil
+}
@@ -0,0 +1,123 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	resetDataPath = "/data"
+)
+
+// reconcileActions carries out restart and reset requested by generation bumps,
+// env pods must not be reconciled while an action is in progress
+func (c *Controller) reconcileActions(ctx context.Context, status *Status, rs *ResourceState) (*results.Results, bool) {
+	result := results.NewResults(ctx)
+	expr := status.Experiment
+
+	if expr.Spec.ResetGeneration > status.Status.ObservedResetGeneration {
+		return c.reconcileReset(ctx, status, rs)
+	}
+
+	if expr.Spec.RestartGeneration > status.Status.ObservedRestartGeneration {
+		for i := range rs.EnvPod {
+			pod := rs.EnvPod[i]
+			if err := client.IgnoreNotFound(c.Client.Delete(ctx, &pod)); err != nil {
+				status.SetCondition(hackathonv1.ExperimentRestarted, hackathonv1.ExperimentConditionFalse, "RestartFailed", err.Error())
+				return result.WithError(fmt.Errorf("delete env pod for restart failed: %s", err.Error())), true
+			}
+		}
+		status.Status.ObservedRestartGeneration = expr.Spec.RestartGeneration
+		msg := fmt.Sprintf("restart experiment, generation %d", expr.Spec.RestartGeneration)
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, msg)
+		status.SetCondition(hackathonv1.ExperimentRestarted, hackathonv1.ExperimentConditionTrue, "Restarted", msg)
+		return result, true
+	}
+	return result, false
+}
+
+// reconcileReset deletes env pods, wipes data volume with a job and
+// marks data as not seeded, so that the next env pod seeds it from template again
+func (c *Controller) reconcileReset(ctx context.Context, status *Status, rs *ResourceState) (*results.Results, bool) {
+	result := results.NewResults(ctx)
+	var (
+		expr = status.Experiment
+		job  = rs.ResetJob
+	)
+	waitReset := func() (reconcile.Result, error) {
+		return reconcile.Result{RequeueAfter: dataVolumeWaitInterval}, nil
+	}
+
+	if cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataReset); cond == nil || cond.Reason != "Resetting" {
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, fmt.Sprintf("reset experiment, generation %d", expr.Spec.ResetGeneration))
+	}
+	status.SetCondition(hackathonv1.ExperimentDataReset, hackathonv1.ExperimentConditionFalse, "Resetting", "")
+
+	if len(rs.EnvPod) > 0 {
+		for i := range rs.EnvPod {
+			pod := rs.EnvPod[i]
+			if err := client.IgnoreNotFound(c.Client.Delete(ctx, &pod)); err != nil {
+				return result.WithError(fmt.Errorf("delete env pod for reset failed: %s", err.Error())), true
+			}
+		}
+		return result.With("wait-env-pod-deleted", waitReset), true
+	}
+
+	if rs.DataVolumeClaim == nil {
+		return result.With("wait-data-volume", waitReset), true
+	}
+
+	if job == nil {
+		expected, err := buildResetJob(expr)
+		if err != nil {
+			return result.WithError(err), true
+		}
+		if err = c.Client.Create(ctx, expected); err != nil {
+			status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create reset job failed: %s", err.Error()))
+			return result.WithError(err), true
+		}
+		return result.With("wait-reset-job", waitReset), true
+	}
+
+	succeeded, failed := jobFinished(job)
+	if !succeeded && !failed {
+		return result.With("wait-reset-job", waitReset), true
+	}
+
+	// the job is removed so that the next reset runs a new one
+	if err := client.IgnoreNotFound(c.Client.Delete(ctx, job, client.PropagationPolicy("Background"))); err != nil {
+		return result.WithError(fmt.Errorf("delete reset job failed: %s", err.Error())), true
+	}
+	status.Status.ObservedResetGeneration = expr.Spec.ResetGeneration
+	if failed {
+		// data may be partially removed, seed it again rather than trusting the old seed condition
+		msg := fmt.Sprintf("reset job %s failed", job.Name)
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, msg)
+		status.SetCondition(hackathonv1.ExperimentDataReset, hackathonv1.ExperimentConditionFalse, "ResetFailed", msg)
+	} else {
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, fmt.Sprintf("data volume reset, generation %d", expr.Spec.ResetGeneration))
+		status.SetCondition(hackathonv1.ExperimentDataReset, hackathonv1.ExperimentConditionTrue, "Reset", "")
+	}
+	status.SetCondition(hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionFalse, "DataReset", "")
+	// env pod is created in next reconcile, after the seed condition persisted
+	return result.With("wait-reset-status", waitReset), true
+}
+
+func resetJobName(experiment *hackathonv1.Experiment) string {
+	return fmt.Sprintf("reset-%s", experiment.Name)
+}
+
+func buildResetJob(experiment *hackathonv1.Experiment) (*batchv1.Job, error) {
+	volumes := []corev1.Volume{claimVolume("data", dataVolumeClaimName(experiment), false)}
+	mounts := []corev1.VolumeMount{{Name: "data", MountPath: resetDataPath}}
+	// the seed marker goes first, so that data is seeded again even if the reset fails halfway
+	script := fmt.Sprintf("rm -f %[1]s/%[2]s && rm -rf %[1]s/..?* %[1]s/.[!.]* %[1]s/*", resetDataPath, dataSeedMarkerFile)
+	return newVolumeJob(experiment, resetJobName(experiment), script, volumes, mounts)
+}
@@ -0,0 +1,154 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// actionClient records objects created and deleted by actions, lists nothing and finds nothing
+type actionClient struct {
+	client.Client
+	created   []runtime.Object
+	deleted   []runtime.Object
+	deleteErr error
+}
+
+func (c *actionClient) Create(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+	c.created = append(c.created, obj)
+	return nil
+}
+
+func (c *actionClient) Get(_ context.Context, key client.ObjectKey, _ runtime.Object) error {
+	return errors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *actionClient) List(context.Context, runtime.Object, ...client.ListOption) error {
+	return nil
+}
+
+func (c *actionClient) Delete(_ context.Context, obj runtime.Object, _ ...client.DeleteOption) error {
+	c.deleted = append(c.deleted, obj)
+	return c.deleteErr
+}
+
+func newFinishedJob(condType batchv1.JobConditionType) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "reset-test-expr", Namespace: "default"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: condType, Status: corev1.ConditionTrue},
+		}},
+	}
+}
+
+var _ = Describe("experiment-actions", func() {
+	var (
+		cli    *actionClient
+		c      *Controller
+		status *Status
+		rs     *ResourceState
+	)
+	BeforeEach(func() {
+		cli = &actionClient{}
+		c = &Controller{Client: cli, Logger: zap.New()}
+		status = newLifecycleStatus(hackathonv1.ExperimentRunning)
+		status.Status.Conditions = []hackathonv1.ExperimentCondition{hackathonv1.NewExperimentCondition(
+			hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionTrue, "Seeded", "")}
+		rs = &ResourceState{EnvPod: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "test-expr"}}}}
+	})
+
+	Context("restart", func() {
+		It("deletes env pods and observes generation", func() {
+			status.Experiment.Spec.RestartGeneration = 1
+			_, busy := c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(cli.deleted).To(HaveLen(1))
+			Expect(status.Status.ObservedRestartGeneration).To(BeEquivalentTo(1))
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentRestarted, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+
+			_, busy = c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeFalse())
+			Expect(cli.deleted).To(HaveLen(1))
+		})
+
+		It("keeps generation if env pod not deleted", func() {
+			status.Experiment.Spec.RestartGeneration = 1
+			cli.deleteErr = fmt.Errorf("forbidden")
+			_, busy := c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(status.Status.ObservedRestartGeneration).To(BeZero())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentRestarted)
+			Expect(cond.Reason).To(Equal("RestartFailed"))
+		})
+	})
+
+	Context("reset", func() {
+		BeforeEach(func() {
+			status.Experiment.Spec.ResetGeneration = 1
+		})
+
+		It("wipes data volume after env pods deleted", func() {
+			_, busy := c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(cli.deleted).To(HaveLen(1))
+			Expect(cli.created).To(BeEmpty())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataReset)
+			Expect(cond.Reason).To(Equal("Resetting"))
+
+			rs.EnvPod = nil
+			rs.DataVolumeClaim = &corev1.PersistentVolumeClaim{}
+			_, busy = c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(cli.created).To(HaveLen(1))
+			job := cli.created[0].(*batchv1.Job)
+			Expect(job.Name).To(Equal("reset-test-expr"))
+			Expect(job.Spec.Template.Spec.Containers[0].Command[2]).To(HavePrefix("rm -f /data/" + dataSeedMarkerFile + " && "))
+
+			rs.ResetJob = newFinishedJob(batchv1.JobComplete)
+			_, busy = c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(status.Status.ObservedResetGeneration).To(BeEquivalentTo(1))
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentDataReset, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+			cond = hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataSeeded)
+			Expect(cond.Status).To(Equal(hackathonv1.ExperimentConditionFalse))
+			Expect(cond.Reason).To(Equal("DataReset"))
+		})
+
+		It("seeds data again after reset job failed", func() {
+			rs.EnvPod = nil
+			rs.DataVolumeClaim = &corev1.PersistentVolumeClaim{}
+			rs.ResetJob = newFinishedJob(batchv1.JobFailed)
+			_, busy := c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(cli.deleted).To(HaveLen(1))
+			Expect(status.Status.ObservedResetGeneration).To(BeEquivalentTo(1))
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataReset)
+			Expect(cond.Reason).To(Equal("ResetFailed"))
+			cond = hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataSeeded)
+			Expect(cond.Status).To(Equal(hackathonv1.ExperimentConditionFalse))
+			Expect(cond.Reason).To(Equal("DataReset"))
+		})
+
+		It("waits for running reset job", func() {
+			rs.EnvPod = nil
+			rs.DataVolumeClaim = &corev1.PersistentVolumeClaim{}
+			rs.ResetJob = &batchv1.Job{}
+			_, busy := c.reconcileActions(context.Background(), status, rs)
+			Expect(busy).To(BeTrue())
+			Expect(cli.deleted).To(BeEmpty())
+			Expect(status.Status.ObservedResetGeneration).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,264 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"path"
+	"reflect"
+	"regexp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strings"
+)
+
+const (
+	authorizedKeysVolumeName        = "authorized-keys"
+	authorizedKeysInstallVolumeName = "authorized-keys-install"
+	authorizedKeysContainerName     = "authorized-keys"
+	authorizedKeysFile              = "authorized_keys"
+)
+
+// sshUsernamePattern matches portable unix user names, other names are not passed to the install script
+var sshUsernamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+
+// AuthorizedKeys collects public keys of experiment into an owned secret
+type AuthorizedKeys struct {
+	client        client.Client
+	status        *Status
+	resourceState *ResourceState
+	logger        logr.Logger
+}
+
+func (r *AuthorizedKeys) Reconcile(ctx context.Context) *results.Results {
+	var (
+		old  = r.resourceState.AuthorizedKeys
+		expr = r.status.Experiment
+	)
+	result := results.NewResults(ctx)
+
+	if len(expr.Spec.AuthorizedKeys) == 0 {
+		if old != nil {
+			r.status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, "delete authorized keys secret")
+			return result.WithError(client.IgnoreNotFound(r.client.Delete(ctx, old)))
+		}
+		return result
+	}
+
+	keys, err := r.collectKeys(ctx)
+	if err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, err.Error())
+		return result.WithError(err)
+	}
+
+	expected := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      authorizedKeysSecretName(expr.Name),
+			Namespace: expr.Namespace,
+			Labels: map[string]string{
+				LabelKeyClusterName:    expr.Spec.ClusterName,
+				LabelKeyExperimentName: expr.Name,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{authorizedKeysFile: []byte(strings.Join(keys, "\n") + "\n")},
+	}
+	if err = controllerutil.SetControllerReference(expr, expected.GetObjectMeta(), scheme.Scheme); err != nil {
+		return result.WithError(fmt.Errorf("set authorized keys secret owner ref failed: %s", err.Error()))
+	}
+
+	if old == nil {
+		if err = r.client.Create(ctx, expected); err != nil {
+			r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create authorized keys secret failed: %s", err.Error()))
+			return result.WithError(err)
+		}
+		r.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("create authorized keys secret with %d keys", len(keys)))
+		return result
+	}
+	if reflect.DeepEqual(old.Data, expected.Data) {
+		return result
+	}
+	old.Data = expected.Data
+	r.status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, fmt.Sprintf("update authorized keys secret with %d keys", len(keys)))
+	return result.WithError(r.client.Update(ctx, old))
+}
+
+// collectKeys skips invalid public keys, so that one bad key does not lock out the whole team
+func (r *AuthorizedKeys) collectKeys(ctx context.Context) ([]string, error) {
+	expr := r.status.Experiment
+	keys := make([]string, 0)
+	for _, source := range expr.Spec.AuthorizedKeys {
+		content := source.Key
+		if source.SecretKeyRef != nil {
+			secret := &corev1.Secret{}
+			if err := r.client.Get(ctx, types.NamespacedName{Namespace: expr.Namespace, Name: source.SecretKeyRef.Name}, secret); err != nil {
+				if client.IgnoreNotFound(err) == nil && source.SecretKeyRef.Optional != nil && *source.SecretKeyRef.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("query authorized keys secret %s failed: %s", source.SecretKeyRef.Name, err.Error())
+			}
+			content = string(secret.Data[source.SecretKeyRef.Key])
+		}
+
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+				r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, fmt.Sprintf("skip invalid authorized key: %s", err.Error()))
+				continue
+			}
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
+// authorizedKeysInstallScript copies authorized_keys for every "<file> <user>" argument pair,
+// secret volumes are owned by root so that sshd of a non-root user could not read them
+const authorizedKeysInstallScript = `set -e
+while [ $# -gt 0 ]; do
+  cp /tmp/authorized-keys/authorized_keys "/tmp/ssh-keys/$1"
+  chmod 0600 "/tmp/ssh-keys/$1"
+  chown "$2" "/tmp/ssh-keys/$1" || echo "ssh user $2 not found in image, $1 is kept owned by root" >&2
+  shift 2
+done
+`
+
+// mountAuthorizedKeys installs the authorized keys secret into the containers serving ssh endpoints,
+// an init container running the image of serving container gives the keys file to the ssh user.
+// Endpoints with invalid ssh user are skipped with a warning
+func mountAuthorizedKeys(pod *corev1.Pod, expr *hackathonv1.Experiment, endpoints []hackathonv1.EndpointTemplate) []string {
+	warnings := make([]string, 0)
+	if len(expr.Spec.AuthorizedKeys) == 0 {
+		return warnings
+	}
+	type keysMount struct {
+		container int
+		path      string
+		user      string
+	}
+	mounts := make([]keysMount, 0)
+	for _, endpoint := range endpoints {
+		if endpoint.Protocol != hackathonv1.ExperimentIngressSSH || endpoint.SSH == nil {
+			continue
+		}
+		container := endpointContainer(pod, endpoint.Port)
+		if container < 0 {
+			continue
+		}
+		m := keysMount{container: container, path: authorizedKeysPath(endpoint.SSH), user: endpoint.SSH.Username}
+		if m.user == "" {
+			m.user = "root"
+		}
+		if !sshUsernamePattern.MatchString(m.user) {
+			warnings = append(warnings, fmt.Sprintf("authorized keys not installed for endpoint %s, invalid ssh user %q", endpoint.Name, m.user))
+			continue
+		}
+		found := false
+		for _, existing := range mounts {
+			found = found || (existing.container == m.container && existing.path == m.path)
+		}
+		if !found {
+			mounts = append(mounts, m)
+		}
+	}
+	if len(mounts) == 0 {
+		return warnings
+	}
+
+	mode := int32(0600)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: authorizedKeysVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  authorizedKeysSecretName(expr.Name),
+				DefaultMode: &mode,
+			},
+		},
+	}, corev1.Volume{
+		Name:         authorizedKeysInstallVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+
+	// keys are installed by the image of serving container, which knows the ssh users
+	byImage := map[string][]string{}
+	images := make([]string, 0)
+	for i, m := range mounts {
+		file := fmt.Sprintf("%s-%d", authorizedKeysFile, i)
+		container := &pod.Spec.Containers[m.container]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      authorizedKeysInstallVolumeName,
+			MountPath: m.path,
+			SubPath:   file,
+			ReadOnly:  true,
+		})
+		if _, ok := byImage[container.Image]; !ok {
+			images = append(images, container.Image)
+		}
+		byImage[container.Image] = append(byImage[container.Image], file, m.user)
+	}
+
+	root := int64(0)
+	initContainers := make([]corev1.Container, 0)
+	for i, image := range images {
+		name := authorizedKeysContainerName
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d", authorizedKeysContainerName, i)
+		}
+		initContainers = append(initContainers, corev1.Container{
+			Name:    name,
+			Image:   image,
+			Command: append([]string{"sh", "-c", authorizedKeysInstallScript, authorizedKeysContainerName}, byImage[image]...),
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: authorizedKeysVolumeName, MountPath: "/tmp/authorized-keys", ReadOnly: true},
+				{Name: authorizedKeysInstallVolumeName, MountPath: "/tmp/ssh-keys"},
+			},
+			SecurityContext: &corev1.SecurityContext{RunAsUser: &root},
+		})
+	}
+	pod.Spec.InitContainers = append(initContainers, pod.Spec.InitContainers...)
+	return warnings
+}
+
+// endpointContainer returns index of the container declaring port, or the main container if no container declares it
+func endpointContainer(pod *corev1.Pod, port int32) int {
+	fallback := -1
+	for i, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.ContainerPort == port {
+				return i
+			}
+		}
+		if c.Name == mainContainerName {
+			fallback = i
+		}
+	}
+	if fallback < 0 && len(pod.Spec.Containers) > 0 {
+		fallback = 0
+	}
+	return fallback
+}
+
+func authorizedKeysPath(cfg *hackathonv1.SSHConfig) string {
+	if cfg.AuthorizedKeysPath != "" {
+		return cfg.AuthorizedKeysPath
+	}
+	if cfg.Username == "" || cfg.Username == "root" {
+		return path.Join("/root/.ssh", authorizedKeysFile)
+	}
+	return path.Join("/home", cfg.Username, ".ssh", authorizedKeysFile)
+}
+
+func authorizedKeysSecretName(exprName string) string {
+	return fmt.Sprintf("keys-%s", exprName)
+}
@@ -0,0 +1,94 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("experiment-authorized-keys", func() {
+	newKeysPod := func() *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: mainContainerName, Image: "desktop"},
+			{Name: "sshd", Image: "sshd", Ports: []corev1.ContainerPort{{ContainerPort: 2222}}},
+		}}}
+	}
+	newKeysExperiment := func() *hackathonv1.Experiment {
+		expr := newVolumeExperiment(nil)
+		expr.Spec.AuthorizedKeys = []hackathonv1.AuthorizedKeySource{{Key: "ssh-ed25519 AAAA team"}}
+		return expr
+	}
+
+	It("mounts keys only into the container serving ssh endpoint", func() {
+		pod := newKeysPod()
+		mountAuthorizedKeys(pod, newKeysExperiment(), []hackathonv1.EndpointTemplate{
+			{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 2222, SSH: &hackathonv1.SSHConfig{Username: "dev"}},
+		})
+		Expect(pod.Spec.Containers[0].VolumeMounts).To(BeEmpty())
+		Expect(pod.Spec.Containers[1].VolumeMounts).To(Equal([]corev1.VolumeMount{{
+			Name:      authorizedKeysInstallVolumeName,
+			MountPath: "/home/dev/.ssh/authorized_keys",
+			SubPath:   "authorized_keys-0",
+			ReadOnly:  true,
+		}}))
+		Expect(pod.Spec.Volumes).To(HaveLen(2))
+		Expect(pod.Spec.Volumes[0].Secret.SecretName).To(Equal("keys-test-expr"))
+		Expect(pod.Spec.Volumes[1].EmptyDir).NotTo(BeNil())
+	})
+
+	It("gives keys file to ssh user in an init container", func() {
+		pod := newKeysPod()
+		pod.Spec.InitContainers = []corev1.Container{{Name: "user-init"}}
+		mountAuthorizedKeys(pod, newKeysExperiment(), []hackathonv1.EndpointTemplate{
+			{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 22, SSH: &hackathonv1.SSHConfig{}},
+			{Name: "dev-ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 2222, SSH: &hackathonv1.SSHConfig{Username: "dev"}},
+		})
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/root/.ssh/authorized_keys"))
+		Expect(pod.Spec.InitContainers).To(HaveLen(3))
+
+		install := pod.Spec.InitContainers[0]
+		Expect(install.Name).To(Equal(authorizedKeysContainerName))
+		Expect(install.Image).To(Equal("desktop"))
+		Expect(*install.SecurityContext.RunAsUser).To(BeZero())
+		Expect(install.Command[2]).To(ContainSubstring("chmod 0600"))
+		Expect(install.Command[4:]).To(Equal([]string{"authorized_keys-0", "root"}))
+
+		Expect(pod.Spec.InitContainers[1].Name).To(Equal("authorized-keys-1"))
+		Expect(pod.Spec.InitContainers[1].Image).To(Equal("sshd"))
+		Expect(pod.Spec.InitContainers[1].Command[4:]).To(Equal([]string{"authorized_keys-1", "dev"}))
+		Expect(pod.Spec.InitContainers[2].Name).To(Equal("user-init"))
+	})
+
+	It("skips endpoints with invalid ssh user", func() {
+		pod := newKeysPod()
+		warnings := mountAuthorizedKeys(pod, newKeysExperiment(), []hackathonv1.EndpointTemplate{
+			{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 2222, SSH: &hackathonv1.SSHConfig{Username: "dev; rm -rf /"}},
+		})
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0]).To(ContainSubstring("invalid ssh user"))
+		Expect(pod.Spec.Volumes).To(BeEmpty())
+		Expect(pod.Spec.InitContainers).To(BeEmpty())
+	})
+
+	It("skips experiments without keys or ssh endpoints", func() {
+		pod := newKeysPod()
+		mountAuthorizedKeys(pod, newVolumeExperiment(nil), []hackathonv1.EndpointTemplate{
+			{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 22, SSH: &hackathonv1.SSHConfig{}},
+		})
+		mountAuthorizedKeys(pod, newKeysExperiment(), []hackathonv1.EndpointTemplate{
+			{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Port: 5901, VNC: &hackathonv1.VNCConfig{}},
+		})
+		Expect(pod.Spec.Volumes).To(BeEmpty())
+		Expect(pod.Spec.InitContainers).To(BeEmpty())
+	})
+
+	It("uses main container when no container declares the port", func() {
+		pod := newKeysPod()
+		Expect(endpointContainer(pod, 2222)).To(Equal(1))
+		Expect(endpointContainer(pod, 22)).To(Equal(0))
+		pod.Spec.Containers[0].Name = "desktop"
+		Expect(endpointContainer(pod, 22)).To(Equal(0))
+		Expect(endpointContainer(&corev1.Pod{}, 22)).To(Equal(-1))
+	})
+})
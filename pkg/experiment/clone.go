@@ -0,0 +1,130 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	snapshotAPIGroup = "snapshot.storage.k8s.io"
+	cloneSourcePath  = "/source"
+	cloneTargetPath  = "/target"
+)
+
+func cloneFromExperiment(experiment *hackathonv1.Experiment) bool {
+	return experiment.Spec.Source != nil && experiment.Spec.Source.Experiment != ""
+}
+
+func restoreFromSnapshot(experiment *hackathonv1.Experiment) bool {
+	return experiment.Spec.Source != nil && experiment.Spec.Source.Experiment == "" && experiment.Spec.Source.Snapshot != ""
+}
+
+// reconcileVolumeContent makes sure the data volume is populated before env pod starts,
+// the progress is tracked by ExperimentVolumeCreated condition
+func (v *DataVolume) reconcileVolumeContent(ctx context.Context) *results.Results {
+	defer logtool.SpendTimeRecord(v.logger, "reconcile volume content")()
+	result := results.NewResults(ctx)
+	var (
+		expr  = v.status.Experiment
+		claim = v.resourceState.DataVolumeClaim
+	)
+
+	if hackathonv1.CheckExperimentCondition(v.status.Status.Conditions,
+		hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionTrue) {
+		return result
+	}
+
+	if claim == nil {
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "WaitForVolumeClaim", "")
+		return result
+	}
+
+	switch {
+	case cloneFromExperiment(expr):
+		return result.WithResult(v.reconcileCloneJob(ctx))
+	case restoreFromSnapshot(expr):
+		if claim.Status.Phase != corev1.ClaimBound {
+			v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse,
+				"RestoringSnapshot", fmt.Sprintf("wait for restoring snapshot %s", expr.Spec.Source.Snapshot))
+			return result
+		}
+		v.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("data volume restored from snapshot %s", expr.Spec.Source.Snapshot))
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionTrue, "SnapshotRestored", "")
+	default:
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionTrue, "VolumeCreated", "")
+	}
+	return result
+}
+
+func (v *DataVolume) reconcileCloneJob(ctx context.Context) *results.Results {
+	result := results.NewResults(ctx)
+	var (
+		expr   = v.status.Experiment
+		source = v.resourceState.SourceExperiment
+		job    = v.resourceState.CloneJob
+	)
+
+	if expr.Spec.Source.Experiment == expr.Name {
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse,
+			"SourceInvalid", "experiment can not be cloned from itself")
+		return result
+	}
+
+	if source == nil {
+		msg := fmt.Sprintf("source experiment %s not found", expr.Spec.Source.Experiment)
+		v.status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, msg)
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "SourceNotFound", msg)
+		return result.WithError(fmt.Errorf("source experiment %s not found", expr.Spec.Source.Experiment))
+	}
+
+	if job == nil {
+		expected, err := buildCloneJob(expr, source)
+		if err != nil {
+			return result.WithError(err)
+		}
+		if err = v.client.Create(ctx, expected); err != nil {
+			v.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create clone job failed: %s", err.Error()))
+			return result.WithError(err)
+		}
+		v.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("clone data volume from experiment %s", source.Name))
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "Cloning", "")
+		return result
+	}
+
+	succeeded, failed := jobFinished(job)
+	switch {
+	case succeeded:
+		v.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("data volume cloned from experiment %s", source.Name))
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionTrue, "Cloned", "")
+	case failed:
+		v.status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, fmt.Sprintf("clone job %s failed", job.Name))
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "CloneFailed",
+			fmt.Sprintf("clone job %s failed", job.Name))
+	default:
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "Cloning", "")
+	}
+	return result
+}
+
+func cloneJobName(experiment *hackathonv1.Experiment) string {
+	return fmt.Sprintf("clone-%s", experiment.Name)
+}
+
+func buildCloneJob(experiment, source *hackathonv1.Experiment) (*batchv1.Job, error) {
+	volumes := []corev1.Volume{
+		claimVolume("source", dataVolumeClaimName(source), true),
+		claimVolume("target", dataVolumeClaimName(experiment), false),
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "source", MountPath: cloneSourcePath, ReadOnly: true},
+		{Name: "target", MountPath: cloneTargetPath},
+	}
+	script := fmt.Sprintf("cp -a %s/. %s/", cloneSourcePath, cloneTargetPath)
+	return newVolumeJob(experiment, cloneJobName(experiment), script, volumes, mounts)
+}
@@ -1,10 +1,37 @@
 package experiment
 
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"time"
+)
+
 const (
 	LabelKeyExperimentName = "hackathon.kaiyuanshe.cn/experiment"
 	LabelKeyClusterName    = "hackathon.kaiyuanshe.cn/cluster"
+	LabelKeyVolumeJob      = "hackathon.kaiyuanshe.cn/volume-job"
+	LabelKeyNodeName       = "hackathon.kaiyuanshe.cn/node"
+
+	DataVolumeFinalizer = "hackathon.kaiyuanshe.cn/data-volume"
+
+	AnnotationKeyPodSpecHash = "hackathon.kaiyuanshe.cn/pod-spec-hash"
 )
 
 var (
+	DataVolumeBackend      = string(hackathonv1.HostPathDataVolume)
 	DataVolumeStorageClass = "local-fs"
+	DataVolumeHostPathDir  = "/opt/open-hackathon/cloud-engine/data"
+	DataVolumeRetention    = time.Duration(0)
+	DataVolumeJobImage     = "busybox"
+	DataSeedGitImage       = "alpine/git"
+	EndpointProbeTimeout   = 3 * time.Second
+	// ProvisioningTimeout moves experiments whose env pod is not ready in time to Error, zero to disable
+	ProvisioningTimeout = 10 * time.Minute
+	// DataVolumeSnapshotStorageClass must be a CSI storage class, restoring from snapshot
+	// is refused if neither it nor template storage class is set
+	DataVolumeSnapshotStorageClass = ""
+	// DataVolumeExpiryWarning is how long before a retained data volume is reclaimed the experiment reports expiring
+	DataVolumeExpiryWarning = 24 * time.Hour
+	// AccessWebhookEnabled is set when the owner and mentors validating webhook is served, access role bindings
+	// are only granted then, as otherwise anyone able to edit experiments could name itself owner
+	AccessWebhookEnabled = false
 )
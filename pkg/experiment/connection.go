@@ -0,0 +1,80 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"net"
+	"strconv"
+)
+
+// connectionFormatter builds connection info of an exposed endpoint, host is the first ingress ip
+type connectionFormatter func(expr *hackathonv1.Experiment, endpoint *hackathonv1.ExperimentEndpointStatus, host string) *hackathonv1.EndpointConnection
+
+var connectionFormatters = map[hackathonv1.ExperimentIngressProtocol]connectionFormatter{
+	hackathonv1.ExperimentIngressVNC:  formatVNCConnection,
+	hackathonv1.ExperimentIngressSSH:  formatSSHConnection,
+	hackathonv1.ExperimentIngressHTTP: formatHTTPConnection,
+}
+
+func endpointConnection(expr *hackathonv1.Experiment, endpoint *hackathonv1.ExperimentEndpointStatus) *hackathonv1.EndpointConnection {
+	formatter, ok := connectionFormatters[endpoint.Protocol]
+	if !ok {
+		return nil
+	}
+	host := ""
+	if len(endpoint.IngressIPs) > 0 && endpoint.IngressPort > 0 {
+		host = endpoint.IngressIPs[0]
+	}
+	return formatter(expr, endpoint, host)
+}
+
+func formatVNCConnection(expr *hackathonv1.Experiment, endpoint *hackathonv1.ExperimentEndpointStatus, host string) *hackathonv1.EndpointConnection {
+	conn := &hackathonv1.EndpointConnection{URL: endpoint.URL}
+	if host != "" {
+		address := net.JoinHostPort(host, strconv.Itoa(int(endpoint.IngressPort)))
+		conn.URI = fmt.Sprintf("vnc://%s", address)
+		conn.ClientConfig = fmt.Sprintf("[Connection]\nHost=%s\n", address)
+		if endpoint.VNC != nil && endpoint.VNC.Username != "" {
+			conn.URI = fmt.Sprintf("vnc://%s@%s", endpoint.VNC.Username, address)
+			conn.ClientConfig += fmt.Sprintf("UserName=%s\n", endpoint.VNC.Username)
+		}
+		conn.ClientConfigFile = fmt.Sprintf("%s-%s.vnc", expr.Name, endpoint.Name)
+	}
+	if conn.URI == "" && conn.URL == "" {
+		return nil
+	}
+	return conn
+}
+
+func formatSSHConnection(expr *hackathonv1.Experiment, endpoint *hackathonv1.ExperimentEndpointStatus, host string) *hackathonv1.EndpointConnection {
+	conn := &hackathonv1.EndpointConnection{URL: endpoint.URL}
+	if host != "" {
+		user := ""
+		if endpoint.SSH != nil && endpoint.SSH.Username != "" {
+			user = endpoint.SSH.Username + "@"
+		}
+		hostAlias := fmt.Sprintf("%s-%s", expr.Name, endpoint.Name)
+		conn.URI = fmt.Sprintf("ssh://%s%s", user, net.JoinHostPort(host, strconv.Itoa(int(endpoint.IngressPort))))
+		conn.Command = fmt.Sprintf("ssh %s%s -p %d", user, host, endpoint.IngressPort)
+		conn.ClientConfig = fmt.Sprintf("Host %s\n  HostName %s\n  Port %d\n", hostAlias, host, endpoint.IngressPort)
+		if user != "" {
+			conn.ClientConfig += fmt.Sprintf("  User %s\n", endpoint.SSH.Username)
+		}
+		conn.ClientConfigFile = "ssh_config"
+	}
+	if conn.URI == "" && conn.URL == "" {
+		return nil
+	}
+	return conn
+}
+
+func formatHTTPConnection(expr *hackathonv1.Experiment, endpoint *hackathonv1.ExperimentEndpointStatus, host string) *hackathonv1.EndpointConnection {
+	if endpoint.URL != "" {
+		return &hackathonv1.EndpointConnection{URL: endpoint.URL}
+	}
+	if host == "" {
+		return nil
+	}
+	url := fmt.Sprintf("http://%s/", net.JoinHostPort(host, strconv.Itoa(int(endpoint.IngressPort))))
+	return &hackathonv1.EndpointConnection{URL: url}
+}
@@ -0,0 +1,75 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("experiment-connection", func() {
+	expr := newVolumeExperiment(nil)
+
+	It("formats vnc connection", func() {
+		endpoint := &hackathonv1.ExperimentEndpointStatus{
+			Name: "desktop", Protocol: hackathonv1.ExperimentIngressVNC,
+			IngressIPs: []string{"10.0.0.1"}, IngressPort: 30901,
+			VNC: &hackathonv1.VNCConfig{Username: "root"},
+		}
+		conn := endpointConnection(expr, endpoint)
+		Expect(conn.URI).To(Equal("vnc://root@10.0.0.1:30901"))
+		Expect(conn.ClientConfig).To(Equal("[Connection]\nHost=10.0.0.1:30901\nUserName=root\n"))
+		Expect(conn.ClientConfigFile).To(Equal("test-expr-desktop.vnc"))
+
+		endpoint.VNC = nil
+		conn = endpointConnection(expr, endpoint)
+		Expect(conn.URI).To(Equal("vnc://10.0.0.1:30901"))
+		Expect(conn.ClientConfig).NotTo(ContainSubstring("UserName"))
+	})
+
+	It("formats ssh connection", func() {
+		endpoint := &hackathonv1.ExperimentEndpointStatus{
+			Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH,
+			IngressIPs: []string{"10.0.0.1"}, IngressPort: 30022,
+			SSH: &hackathonv1.SSHConfig{Username: "dev"},
+		}
+		conn := endpointConnection(expr, endpoint)
+		Expect(conn.URI).To(Equal("ssh://dev@10.0.0.1:30022"))
+		Expect(conn.Command).To(Equal("ssh dev@10.0.0.1 -p 30022"))
+		Expect(conn.ClientConfig).To(Equal("Host test-expr-ssh\n  HostName 10.0.0.1\n  Port 30022\n  User dev\n"))
+		Expect(conn.ClientConfigFile).To(Equal("ssh_config"))
+
+		endpoint.SSH = nil
+		conn = endpointConnection(expr, endpoint)
+		Expect(conn.Command).To(Equal("ssh 10.0.0.1 -p 30022"))
+		Expect(conn.ClientConfig).NotTo(ContainSubstring("User"))
+	})
+
+	It("brackets ipv6 hosts", func() {
+		endpoint := &hackathonv1.ExperimentEndpointStatus{
+			Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH,
+			IngressIPs: []string{"fd00::1"}, IngressPort: 30022,
+		}
+		Expect(endpointConnection(expr, endpoint).URI).To(Equal("ssh://[fd00::1]:30022"))
+	})
+
+	It("formats http connection from ingress url or node port", func() {
+		endpoint := &hackathonv1.ExperimentEndpointStatus{
+			Name: "web", Protocol: hackathonv1.ExperimentIngressHTTP,
+			IngressIPs: []string{"10.0.0.1"}, IngressPort: 30080,
+		}
+		Expect(endpointConnection(expr, endpoint).URL).To(Equal("http://10.0.0.1:30080/"))
+
+		endpoint.URL = "http://web.test-expr.example.com/"
+		Expect(endpointConnection(expr, endpoint).URL).To(Equal("http://web.test-expr.example.com/"))
+	})
+
+	It("returns nil for endpoints not exposed", func() {
+		for _, protocol := range []hackathonv1.ExperimentIngressProtocol{
+			hackathonv1.ExperimentIngressVNC, hackathonv1.ExperimentIngressSSH, hackathonv1.ExperimentIngressHTTP,
+		} {
+			endpoint := &hackathonv1.ExperimentEndpointStatus{Name: "ep", Protocol: protocol, IngressIPs: []string{"10.0.0.1"}}
+			Expect(endpointConnection(expr, endpoint)).To(BeNil())
+		}
+		Expect(endpointConnection(expr, &hackathonv1.ExperimentEndpointStatus{Protocol: "rdp", IngressPort: 3389})).To(BeNil())
+	})
+})
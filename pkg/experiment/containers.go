@@ -0,0 +1,131 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+)
+
+const (
+	mainContainerName    = "experiment"
+	dataVolumeVolumeName = "data-volume"
+)
+
+// mainContainerTemplate converts the legacy single container fields of pod template, nil if image is empty
+func mainContainerTemplate(podCfg *hackathonv1.PodTemplate) *hackathonv1.ContainerTemplate {
+	if podCfg.Image == "" {
+		return nil
+	}
+	return &hackathonv1.ContainerTemplate{
+		Name:      mainContainerName,
+		Image:     podCfg.Image,
+		Env:       podCfg.Env,
+		Command:   podCfg.Command,
+		Essential: true,
+	}
+}
+
+// validateContainers rejects duplicated container names and the names reserved by controller
+func validateContainers(podCfg *hackathonv1.PodTemplate) error {
+	names := map[string]bool{dataSeedContainerName: true}
+	if mainContainerTemplate(podCfg) != nil {
+		names[mainContainerName] = true
+	}
+	for _, list := range [][]hackathonv1.ContainerTemplate{podCfg.Containers, podCfg.InitContainers} {
+		for _, c := range list {
+			if c.Name == mainContainerName || c.Name == dataSeedContainerName ||
+				c.Name == authorizedKeysContainerName || strings.HasPrefix(c.Name, authorizedKeysContainerName+"-") {
+				return fmt.Errorf("container name %s is reserved", c.Name)
+			}
+			if names[c.Name] {
+				return fmt.Errorf("container name %s is duplicated", c.Name)
+			}
+			names[c.Name] = true
+		}
+	}
+	return nil
+}
+
+func buildContainer(cfg *hackathonv1.ContainerTemplate, mountPath string) corev1.Container {
+	envs := make([]corev1.EnvVar, 0)
+	for k, v := range cfg.Env {
+		envs = append(envs, corev1.EnvVar{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(envs, func(i, j int) bool {
+		return envs[i].Name < envs[j].Name
+	})
+
+	mounts := append([]corev1.VolumeMount{}, cfg.VolumeMounts...)
+	mounted := false
+	for _, m := range mounts {
+		if m.MountPath == mountPath {
+			mounted = true
+		}
+	}
+	if !mounted {
+		mounts = append(mounts, corev1.VolumeMount{Name: dataVolumeVolumeName, MountPath: mountPath})
+	}
+
+	container := corev1.Container{
+		Name:         cfg.Name,
+		Image:        cfg.Image,
+		Command:      cfg.Command,
+		Args:         cfg.Args,
+		Env:          envs,
+		Ports:        cfg.Ports,
+		VolumeMounts: mounts,
+	}
+	if cfg.Resources != nil {
+		container.Resources = *cfg.Resources.DeepCopy()
+	}
+	return container
+}
+
+// essentialContainers returns names of containers which decide experiment readiness,
+// all containers are essential if none is marked
+func essentialContainers(podCfg *hackathonv1.PodTemplate) []string {
+	names := make([]string, 0)
+	all := make([]string, 0)
+	if main := mainContainerTemplate(podCfg); main != nil {
+		names = append(names, main.Name)
+		all = append(all, main.Name)
+	}
+	for _, c := range podCfg.Containers {
+		all = append(all, c.Name)
+		if c.Essential {
+			names = append(names, c.Name)
+		}
+	}
+	if len(names) == 0 {
+		return all
+	}
+	return names
+}
+
+func isEnvPodReady(pod *corev1.Pod, template *hackathonv1.Template) bool {
+	if template.Data.PodTemplate == nil {
+		return false
+	}
+	return isContainersReady(pod, essentialContainers(template.Data.PodTemplate))
+}
+
+func isContainersReady(pod *corev1.Pod, names []string) bool {
+	if pod.Status.Phase != corev1.PodRunning || len(names) == 0 {
+		return false
+	}
+	ready := map[string]bool{}
+	for _, cs := range pod.Status.ContainerStatuses {
+		ready[cs.Name] = cs.Ready
+	}
+	for _, name := range names {
+		if !ready[name] {
+			return false
+		}
+	}
+	return true
+}
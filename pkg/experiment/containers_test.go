@@ -0,0 +1,65 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/k8stools"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("experiment-containers", func() {
+	It("rejects duplicated and reserved container names", func() {
+		podCfg := &hackathonv1.PodTemplate{
+			Image:          "ubuntu",
+			Containers:     []hackathonv1.ContainerTemplate{{Name: "desktop", Image: "vnc"}},
+			InitContainers: []hackathonv1.ContainerTemplate{{Name: "setup", Image: "busybox"}},
+		}
+		Expect(validateContainers(podCfg)).To(Succeed())
+
+		podCfg.InitContainers[0].Name = "desktop"
+		Expect(validateContainers(podCfg)).To(MatchError(ContainSubstring("duplicated")))
+
+		podCfg.InitContainers[0].Name = dataSeedContainerName
+		Expect(validateContainers(podCfg)).To(MatchError(ContainSubstring("reserved")))
+
+		podCfg.InitContainers[0].Name = "setup"
+		podCfg.Containers[0].Name = mainContainerName
+		Expect(validateContainers(podCfg)).To(MatchError(ContainSubstring("reserved")))
+
+		podCfg.Image = ""
+		Expect(validateContainers(podCfg)).To(MatchError(ContainSubstring("reserved")))
+
+		podCfg.Containers[0].Name = "desktop"
+		podCfg.InitContainers[0].Name = "authorized-keys-1"
+		Expect(validateContainers(podCfg)).To(MatchError(ContainSubstring("reserved")))
+	})
+
+	It("hashes pods without init containers as before", func() {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{
+			Containers:     []corev1.Container{{Name: "experiment", Image: "ubuntu"}, {Name: "desktop", Image: "vnc"}},
+			InitContainers: []corev1.Container{{Name: dataSeedContainerName, Image: DataVolumeJobImage}},
+		}}
+		legacy, err := k8stools.HashObject(pod.Spec.Containers)
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := podSpecHash(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(legacy))
+
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: "setup", Image: "busybox"})
+		withInit, err := podSpecHash(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(withInit).NotTo(Equal(legacy))
+	})
+
+	It("decides essential containers", func() {
+		podCfg := &hackathonv1.PodTemplate{Containers: []hackathonv1.ContainerTemplate{{Name: "a"}, {Name: "b"}}}
+		Expect(essentialContainers(podCfg)).To(Equal([]string{"a", "b"}))
+
+		podCfg.Containers[1].Essential = true
+		Expect(essentialContainers(podCfg)).To(Equal([]string{"b"}))
+
+		podCfg.Image = "ubuntu"
+		Expect(essentialContainers(podCfg)).To(Equal([]string{mainContainerName, "b"}))
+	})
+})
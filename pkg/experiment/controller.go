@@ -7,18 +7,24 @@ import (
 	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
 	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
 	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
-	"github.com/kaiyuanshe/cloudengine/pkg/utils/k8stools"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+const (
+	dataVolumeWaitInterval = 5 * time.Second
 )
 
 type Controller struct {
 	Client client.Client
-	Logger logr.Logger
+	// APIReader reads objects not cached by manager, such as events
+	APIReader client.Reader
+	Logger    logr.Logger
 }
 
 func (c *Controller) Reconcile(ctx context.Context, status *Status) *results.Results {
@@ -31,12 +37,24 @@ func (c *Controller) Reconcile(ctx context.Context, status *Status) *results.Res
 	}
 
 	resourceState, err := NewExprResourceStatus(ctx, c.Client, status.Experiment)
+	if revErr, ok := err.(*revisionError); ok {
+		// env pod is neither created nor updated until the revision is fixed
+		if cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentRevisionResolved); cond == nil || cond.Message != revErr.message {
+			status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, revErr.message)
+		}
+		status.SetCondition(hackathonv1.ExperimentRevisionResolved, hackathonv1.ExperimentConditionFalse, revErr.reason, revErr.message)
+		return result
+	}
 	if err != nil {
 		c.Logger.Error(err, "query experiment state failed")
 		status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, err.Error())
 		return result.WithError(err)
 	}
 
+	if status.Experiment.Spec.TemplateRevision != "" ||
+		hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentRevisionResolved) != nil {
+		status.SetCondition(hackathonv1.ExperimentRevisionResolved, hackathonv1.ExperimentConditionTrue, "Resolved", resourceState.TemplateRevision)
+	}
 	_ = c.checkExprTemplate(ctx, status, resourceState)
 
 	result.WithResult((&DataVolume{
@@ -46,6 +64,27 @@ func (c *Controller) Reconcile(ctx context.Context, status *Status) *results.Res
 		logger:        c.Logger.WithName("DataVolume"),
 	}).Reconcile(ctx))
 
+	result.WithResult((&Credentials{
+		client:        c.Client,
+		status:        status,
+		resourceState: resourceState,
+		logger:        c.Logger.WithName("Credentials"),
+	}).Reconcile(ctx))
+
+	result.WithResult((&AuthorizedKeys{
+		client:        c.Client,
+		status:        status,
+		resourceState: resourceState,
+		logger:        c.Logger.WithName("AuthorizedKeys"),
+	}).Reconcile(ctx))
+
+	result.WithResult((&Access{
+		client:        c.Client,
+		status:        status,
+		resourceState: resourceState,
+		logger:        c.Logger.WithName("Access"),
+	}).Reconcile(ctx))
+
 	result.WithResult((&IngressService{
 		client:        c.Client,
 		status:        status,
@@ -53,7 +92,20 @@ func (c *Controller) Reconcile(ctx context.Context, status *Status) *results.Res
 		logger:        c.Logger.WithName("IngressService"),
 	}).Reconcile(ctx))
 
-	podResult := c.reconcileExperimentPods(ctx, status, resourceState)
+	result.WithResult((&HTTPIngress{
+		client:        c.Client,
+		status:        status,
+		resourceState: resourceState,
+		logger:        c.Logger.WithName("HTTPIngress"),
+	}).Reconcile(ctx))
+
+	actionResult, busy := c.reconcileActions(ctx, status, resourceState)
+	result.WithResult(actionResult)
+
+	podResult := results.NewResults(ctx)
+	if !busy {
+		podResult = c.reconcileExperimentPods(ctx, status, resourceState)
+	}
 	status.UpdateExperimentStatus(resourceState)
 	return result.WithResult(podResult)
 }
@@ -76,13 +128,7 @@ func (c *Controller) reconcileExperimentPods(ctx context.Context, status *Status
 	}
 
 	if status.Experiment.Spec.Pause {
-		if status.Status.Status != hackathonv1.ExperimentStopped {
-			status.Status.Status = hackathonv1.ExperimentStopped
-			status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, "pause experiment")
-			status.Status.Conditions = hackathonv1.UpdateExperimentConditions(
-				status.Status.Conditions, hackathonv1.NewExperimentCondition(
-					hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PauseExperiment", ""))
-		}
+		status.Transit(eventPause, "pause experiment")
 		if len(resState.EnvPod) > 0 {
 			for i := range resState.EnvPod {
 				needDelPod := resState.EnvPod[i]
@@ -92,37 +138,93 @@ func (c *Controller) reconcileExperimentPods(ctx context.Context, status *Status
 		return result
 	}
 
-	expected, err := buildExpectedEnvPod(status.Experiment, resState.Template)
+	expected, warnings, err := buildExpectedEnvPod(status.Experiment, resState)
 	if err != nil {
 		c.Logger.Error(err, "build expect env pod failed")
 		return result.WithError(err)
 	}
+	for _, warning := range warnings {
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, warning)
+	}
 
 	if len(resState.EnvPod) == 0 {
+		status.Transit(eventProvision, "")
+		if !hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+			hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionTrue) {
+			c.Logger.Info("data volume not ready, delay creating env pod")
+			return result.With("wait-data-volume", func() (reconcile.Result, error) {
+				return reconcile.Result{RequeueAfter: dataVolumeWaitInterval}, nil
+			})
+		}
 		status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, "create env pod")
+		status.SetCondition(hackathonv1.ExperimentUpdatePending, hackathonv1.ExperimentConditionFalse, "UpToDate", "")
+		status.Status.TemplateRevision = resState.TemplateRevision
 		return result.WithError(c.Client.Create(ctx, expected))
 	}
 
 	reconciled := resState.EnvPod[0]
 	c.Logger.Info("found event pod", "pod", reconciled.Name, "namespace", reconciled.Namespace, "status", reconciled.Status.Phase)
+	if !reconciled.DeletionTimestamp.IsZero() {
+		// containers of a deleted pod may stay ready until they are stopped
+		status.Transit(eventProvision, "")
+		status.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PodTerminating", "")
+		status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "PodNotReady", "")
+		return result.With("wait-pod-terminated", func() (reconcile.Result, error) {
+			return reconcile.Result{RequeueAfter: dataVolumeWaitInterval}, nil
+		})
+	}
+	updateDataSeedCondition(status, &reconciled)
+	recreating, err := c.reconcileOutOfResource(ctx, status, &reconciled)
+	if err != nil || recreating {
+		return result.WithError(err)
+	}
+	recreating, err = c.reconcilePodDrift(ctx, status, resState, expected, &reconciled)
+	if err != nil || recreating {
+		return result.WithError(err)
+	}
 	return result.With("check-env-pod", func() (reconcile.Result, error) {
-		if k8stools.IsPodReady(&reconciled) {
-			if status.Status.Status != hackathonv1.ExperimentRunning {
-				status.Status.Status = hackathonv1.ExperimentRunning
-				status.Status.Conditions = hackathonv1.UpdateExperimentConditions(
-					status.Status.Conditions, hackathonv1.NewExperimentCondition(
-						hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionTrue, "", ""))
+		if isEnvPodReady(&reconciled, resState.Template) {
+			// experiment only becomes running once endpoints answer, running experiments keep being probed
+			// so that Ready follows endpoints which stop answering while pod stays ready
+			status.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionTrue, "PodReady", "")
+			if err := probeEndpoints(ctx, resState, status.Experiment.Name); err != nil {
+				c.Logger.Info("experiment endpoints not ready", "reason", err.Error())
+				status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "ProbeFailed", err.Error())
+				provisioning := time.Since(reconciled.CreationTimestamp.Time)
+				if status.Status.Status == hackathonv1.ExperimentProvisioning && ProvisioningTimeout > 0 && provisioning > ProvisioningTimeout {
+					status.Transit(eventFail, fmt.Sprintf("provisioning timeout after %s: %s", ProvisioningTimeout, err.Error()))
+				}
+				return reconcile.Result{RequeueAfter: endpointProbeInterval}, nil
+			}
+			status.Transit(eventPodReady, "")
+			if !hackathonv1.CheckExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue) {
+				status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, "experiment endpoints ready")
 			}
-		} else {
-			if !status.Experiment.Spec.Pause && status.Status.Status == hackathonv1.ExperimentRunning {
-				status.Status.Status = hackathonv1.ExperimentError
-				status.AddEvent(corev1.EventTypeWarning, event.ReasonUnhealthy, fmt.Sprintf("pod %s not ready", reconciled.Name))
+			status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue, "EndpointsReady", "")
+			return reconcile.Result{RequeueAfter: endpointProbeInterval}, nil
+		}
+
+		diagnosis := diagnosePod(&reconciled, c.podEvents(ctx, &reconciled))
+		provisioning := time.Since(reconciled.CreationTimestamp.Time)
+		requeue := reconcile.Result{}
+		switch {
+		case diagnosis.Fatal:
+			status.Transit(eventFail, diagnosis.Message)
+		case status.Status.Status == hackathonv1.ExperimentRunning:
+			status.Transit(eventPodUnready, fmt.Sprintf("pod %s not ready: %s", reconciled.Name, diagnosis.Message))
+		case status.Status.Status == hackathonv1.ExperimentError:
+			// stay in error until pod ready, crashing containers are running between back offs
+		case ProvisioningTimeout > 0 && provisioning > ProvisioningTimeout:
+			status.Transit(eventFail, fmt.Sprintf("provisioning timeout after %s: %s", ProvisioningTimeout, diagnosis.Message))
+		default:
+			status.Transit(eventProvision, "")
+			if ProvisioningTimeout > 0 {
+				requeue.RequeueAfter = ProvisioningTimeout - provisioning
 			}
-			status.Status.Conditions = hackathonv1.UpdateExperimentConditions(
-				status.Status.Conditions, hackathonv1.NewExperimentCondition(
-					hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PodNotReady", ""))
 		}
-		return reconcile.Result{}, nil
+		status.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, diagnosis.Reason, diagnosis.Message)
+		status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "PodNotReady", "")
+		return requeue, nil
 	})
 }
 
@@ -130,35 +232,63 @@ func (c *Controller) checkExprTemplate(ctx context.Context, status *Status, rs *
 	var (
 		template = rs.Template
 	)
-	switch template.Data.IngressProtocol {
-	case hackathonv1.ExperimentIngressVNC:
-		if template.Data.VNC == nil {
-			c.Logger.V(3).Info("template vnc config is nil")
-			status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, "template vnc config is nil")
-		}
-	case hackathonv1.ExperimentIngressSSH:
-		if template.Data.SSH == nil {
-			c.Logger.V(3).Info("template ssh config is nil")
-			status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, "template ssh config is nil")
+	endpoints := templateEndpoints(template)
+	if len(endpoints) == 0 {
+		c.Logger.V(3).Info("template has no endpoint")
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, "template has no endpoint")
+	}
+	for _, endpoint := range endpoints {
+		switch endpoint.Protocol {
+		case hackathonv1.ExperimentIngressVNC:
+			if endpoint.VNC == nil {
+				c.Logger.V(3).Info("template vnc config is nil", "endpoint", endpoint.Name)
+				status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, fmt.Sprintf("endpoint %s vnc config is nil", endpoint.Name))
+			}
+		case hackathonv1.ExperimentIngressSSH:
+			if endpoint.SSH == nil {
+				c.Logger.V(3).Info("template ssh config is nil", "endpoint", endpoint.Name)
+				status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, fmt.Sprintf("endpoint %s ssh config is nil", endpoint.Name))
+			}
+		case hackathonv1.ExperimentIngressHTTP:
+			if rs.Cluster.Spec.IngressDomain == "" {
+				c.Logger.V(3).Info("cluster ingress domain is empty", "endpoint", endpoint.Name)
+			}
+		default:
+			c.Logger.V(3).Info("template ingress protocol not support", "protocol", endpoint.Protocol)
 		}
-	default:
-		c.Logger.V(3).Info("template ingress protocol not support", "protocol", template.Data.IngressProtocol)
 	}
 	return nil
 }
 
-func buildExpectedEnvPod(experiment *hackathonv1.Experiment, template *hackathonv1.Template) (*corev1.Pod, error) {
+func buildExpectedEnvPod(experiment *hackathonv1.Experiment, rs *ResourceState) (*corev1.Pod, []string, error) {
+	template := rs.Template
 	podCfg := template.Data.PodTemplate
 	if podCfg == nil {
-		return nil, fmt.Errorf("pod template is nil")
+		return nil, nil, fmt.Errorf("pod template is nil")
 	}
-	envs := make([]corev1.EnvVar, 0)
-	for k, v := range template.Data.PodTemplate.Env {
-		envs = append(envs, corev1.EnvVar{
-			Name:  k,
-			Value: v,
-		})
+	dvConfig, _ := effectiveDataVolume(experiment, template)
+	resources, warnings := effectiveResources(experiment, template, rs.LimitRanges)
+	if podCfg.Image == "" && len(podCfg.Containers) == 0 {
+		return nil, nil, fmt.Errorf("pod template has no container")
+	}
+	if err := validateContainers(podCfg); err != nil {
+		return nil, nil, err
+	}
+
+	containers := make([]corev1.Container, 0)
+	if main := mainContainerTemplate(podCfg); main != nil {
+		container := buildContainer(main, dvConfig.MountPath)
+		container.Resources = resources
+		containers = append(containers, container)
+	}
+	for i := range podCfg.Containers {
+		containers = append(containers, buildContainer(&podCfg.Containers[i], dvConfig.MountPath))
 	}
+	initContainers := make([]corev1.Container, 0)
+	for i := range podCfg.InitContainers {
+		initContainers = append(initContainers, buildContainer(&podCfg.InitContainers[i], dvConfig.MountPath))
+	}
+
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      experiment.Name,
@@ -169,23 +299,11 @@ func buildExpectedEnvPod(experiment *hackathonv1.Experiment, template *hackathon
 			},
 		},
 		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:    "experiment",
-					Image:   podCfg.Image,
-					Command: podCfg.Command,
-					Env:     envs,
-					VolumeMounts: []corev1.VolumeMount{
-						{
-							Name:      "data-volume",
-							MountPath: containerPath,
-						},
-					},
-				},
-			},
+			Containers:     containers,
+			InitContainers: initContainers,
 			Volumes: []corev1.Volume{
 				{
-					Name: "data-volume",
+					Name: dataVolumeVolumeName,
 					VolumeSource: corev1.VolumeSource{
 						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
 							ClaimName: dataVolumeClaimName(experiment),
@@ -197,10 +315,30 @@ func buildExpectedEnvPod(experiment *hackathonv1.Experiment, template *hackathon
 		},
 	}
 
-	err := controllerutil.SetControllerReference(experiment, pod.GetObjectMeta(), scheme.Scheme)
+	// template passwords are reported by credentials reconciler and ignored
+	injectCredentialsEnv(pod, experiment, templateEndpoints(template))
+	warnings = append(warnings, mountAuthorizedKeys(pod, experiment, templateEndpoints(template))...)
+
+	if needSeedData(experiment, template) {
+		seed, volumes, err := buildDataSeedContainer(template.Data.DataSource, dvConfig.MountPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("build data seed container failed: %s", err.Error())
+		}
+		// seed data before user init containers
+		pod.Spec.InitContainers = append([]corev1.Container{*seed}, pod.Spec.InitContainers...)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
+	}
+
+	hash, err := podSpecHash(pod)
+	if err != nil {
+		return nil, nil, fmt.Errorf("hash pod spec failed: %s", err.Error())
+	}
+	pod.Annotations = map[string]string{AnnotationKeyPodSpecHash: hash}
+
+	err = controllerutil.SetControllerReference(experiment, pod.GetObjectMeta(), scheme.Scheme)
 	if err != nil {
-		return nil, fmt.Errorf("set pod owner ref failed: %s", err.Error())
+		return nil, nil, fmt.Errorf("set pod owner ref failed: %s", err.Error())
 	}
 
-	return pod, nil
+	return pod, warnings, nil
 }
@@ -0,0 +1,225 @@
+package experiment
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"math/big"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strings"
+)
+
+const (
+	passwordLetters = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	passwordLength  = 16
+	// vnc authentication only uses the first 8 characters
+	vncPasswordLength = 8
+)
+
+var envNameReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// Credentials keeps passwords of experiment endpoints in an owned secret
+type Credentials struct {
+	client        client.Client
+	status        *Status
+	resourceState *ResourceState
+	logger        logr.Logger
+}
+
+func (r *Credentials) Reconcile(ctx context.Context) *results.Results {
+	var (
+		old  = r.resourceState.Credentials
+		expr = r.status.Experiment
+	)
+	result := results.NewResults(ctx)
+
+	endpoints := templateEndpoints(r.resourceState.Template)
+	for _, warning := range credentialsWarnings(endpoints) {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, warning)
+	}
+	rotate := expr.Spec.CredentialsRotation > r.status.Status.ObservedCredentialsRotation
+	expected, err := buildExpectedCredentials(expr, endpoints, old, rotate)
+	if err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("build credentials failed: %s", err.Error()))
+		return result.WithError(err)
+	}
+
+	if old == nil {
+		if err = r.client.Create(ctx, expected); err != nil {
+			r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create credentials secret failed: %s", err.Error()))
+			return result.WithError(err)
+		}
+		r.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, "create credentials secret")
+	} else if !reflect.DeepEqual(old.Data, expected.Data) {
+		old.Data = expected.Data
+		if err = r.client.Update(ctx, old); err != nil {
+			return result.WithError(fmt.Errorf("update credentials secret failed: %s", err.Error()))
+		}
+	}
+	r.status.Status.CredentialsSecret = expected.Name
+
+	if rotate {
+		// env of running pods is not refreshed, recreate them to pick up new passwords.
+		// Deleted pods are reconciled as terminating, so that the experiment is not reported running
+		// with old passwords in the same status update which records the rotation
+		now := metav1.Now()
+		for i := range r.resourceState.EnvPod {
+			pod := r.resourceState.EnvPod[i]
+			if err = r.client.Delete(ctx, &pod); client.IgnoreNotFound(err) != nil {
+				return result.WithError(fmt.Errorf("delete env pod for credentials rotation failed: %s", err.Error()))
+			}
+			r.resourceState.EnvPod[i].DeletionTimestamp = &now
+		}
+		r.status.Status.ObservedCredentialsRotation = expr.Spec.CredentialsRotation
+		r.status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange,
+			fmt.Sprintf("rotate credentials, rotation %d", expr.Spec.CredentialsRotation))
+	}
+	return result
+}
+
+// buildExpectedCredentials generates a password for every vnc and ssh endpoint and keeps
+// the passwords of old secret unless rotating, keys are always copied from template
+func buildExpectedCredentials(expr *hackathonv1.Experiment, endpoints []hackathonv1.EndpointTemplate, old *corev1.Secret, rotate bool) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialsSecretName(expr.Name),
+			Namespace: expr.Namespace,
+			Labels: map[string]string{
+				LabelKeyClusterName:    expr.Spec.ClusterName,
+				LabelKeyExperimentName: expr.Name,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{},
+	}
+
+	for _, endpoint := range endpoints {
+		var username, key string
+		switch {
+		case endpoint.Protocol == hackathonv1.ExperimentIngressVNC && endpoint.VNC != nil:
+			username = endpoint.VNC.Username
+		case endpoint.Protocol == hackathonv1.ExperimentIngressSSH && endpoint.SSH != nil:
+			username, key = endpoint.SSH.Username, endpoint.SSH.Key
+		default:
+			continue
+		}
+
+		ref := endpointCredentials(expr.Name, endpoint.Name)
+		password := ""
+		if old != nil && !rotate && len(old.Data[ref.PasswordKey]) > 0 {
+			password = string(old.Data[ref.PasswordKey])
+		} else {
+			_, length := endpointPasswordEnv(endpoint)
+			generated, err := randomPassword(length)
+			if err != nil {
+				return nil, err
+			}
+			password = generated
+		}
+		secret.Data[ref.UsernameKey] = []byte(username)
+		secret.Data[ref.PasswordKey] = []byte(password)
+		if key != "" {
+			secret.Data[ref.KeyKey] = []byte(key)
+		}
+	}
+
+	if err := controllerutil.SetControllerReference(expr, secret.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("set credentials secret owner ref failed: %s", err.Error())
+	}
+	return secret, nil
+}
+
+// injectCredentialsEnv sets generated password of each endpoint into env of the container serving it,
+// sidecars do not see passwords of endpoints they do not serve
+func injectCredentialsEnv(pod *corev1.Pod, expr *hackathonv1.Experiment, endpoints []hackathonv1.EndpointTemplate) {
+	for _, endpoint := range endpoints {
+		passwordEnv, _ := endpointPasswordEnv(endpoint)
+		container := endpointContainer(pod, endpoint.Port)
+		if passwordEnv == "" || container < 0 {
+			continue
+		}
+		ref := endpointCredentials(expr.Name, endpoint.Name)
+		pod.Spec.Containers[container].Env = append(pod.Spec.Containers[container].Env, corev1.EnvVar{
+			Name: passwordEnv,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: ref.SecretName},
+					Key:                  ref.PasswordKey,
+				},
+			},
+		})
+	}
+}
+
+// credentialsWarnings reports template passwords, they are ignored as they would be shared by all experiments
+// and every experiment gets a generated password in env instead
+func credentialsWarnings(endpoints []hackathonv1.EndpointTemplate) []string {
+	warnings := make([]string, 0)
+	for _, endpoint := range endpoints {
+		password := ""
+		switch {
+		case endpoint.Protocol == hackathonv1.ExperimentIngressVNC && endpoint.VNC != nil:
+			password = endpoint.VNC.Password
+		case endpoint.Protocol == hackathonv1.ExperimentIngressSSH && endpoint.SSH != nil:
+			password = endpoint.SSH.Password
+		}
+		if password != "" {
+			passwordEnv, _ := endpointPasswordEnv(endpoint)
+			warnings = append(warnings, fmt.Sprintf("endpoint %s password is ignored, the generated password is set in env %s",
+				endpoint.Name, passwordEnv))
+		}
+	}
+	return warnings
+}
+
+// endpointPasswordEnv returns the env receiving generated password of endpoint, <ENDPOINT>_PASSWORD by default
+func endpointPasswordEnv(endpoint hackathonv1.EndpointTemplate) (string, int) {
+	passwordEnv, length := "", passwordLength
+	switch {
+	case endpoint.Protocol == hackathonv1.ExperimentIngressVNC && endpoint.VNC != nil:
+		passwordEnv, length = endpoint.VNC.PasswordEnv, vncPasswordLength
+	case endpoint.Protocol == hackathonv1.ExperimentIngressSSH && endpoint.SSH != nil:
+		passwordEnv = endpoint.SSH.PasswordEnv
+	default:
+		return "", length
+	}
+	if passwordEnv == "" {
+		passwordEnv = strings.ToUpper(envNameReplacer.Replace(endpoint.Name)) + "_PASSWORD"
+	}
+	return passwordEnv, length
+}
+
+func endpointCredentials(exprName, endpoint string) *hackathonv1.CredentialsReference {
+	return &hackathonv1.CredentialsReference{
+		SecretName:  credentialsSecretName(exprName),
+		UsernameKey: fmt.Sprintf("%s-username", endpoint),
+		PasswordKey: fmt.Sprintf("%s-password", endpoint),
+		KeyKey:      fmt.Sprintf("%s-key", endpoint),
+	}
+}
+
+func randomPassword(length int) (string, error) {
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordLetters)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate password failed: %s", err.Error())
+		}
+		password[i] = passwordLetters[n.Int64()]
+	}
+	return string(password), nil
+}
+
+func credentialsSecretName(exprName string) string {
+	return fmt.Sprintf("cred-%s", exprName)
+}
@@ -0,0 +1,122 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("experiment-credentials", func() {
+	endpoints := []hackathonv1.EndpointTemplate{
+		{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Port: 5901, VNC: &hackathonv1.VNCConfig{Username: "root"}},
+		{Name: "remote-ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 22, SSH: &hackathonv1.SSHConfig{Username: "dev", Key: "private-key", PasswordEnv: "DEV_PASSWORD"}},
+		{Name: "web", Protocol: hackathonv1.ExperimentIngressHTTP, Port: 80},
+	}
+
+	Context("secret", func() {
+		It("generates passwords by default and keeps them unless rotating", func() {
+			expr := newVolumeExperiment(nil)
+			secret, err := buildExpectedCredentials(expr, endpoints, nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Name).To(Equal("cred-test-expr"))
+			Expect(secret.Data).To(HaveLen(5))
+			Expect(secret.Data["vnc-username"]).To(BeEquivalentTo("root"))
+			Expect(secret.Data["vnc-password"]).To(HaveLen(vncPasswordLength))
+			Expect(secret.Data["remote-ssh-password"]).To(HaveLen(passwordLength))
+			Expect(secret.Data["remote-ssh-key"]).To(BeEquivalentTo("private-key"))
+
+			kept, err := buildExpectedCredentials(expr, endpoints, secret, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kept.Data).To(Equal(secret.Data))
+
+			rotated, err := buildExpectedCredentials(expr, endpoints, secret, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rotated.Data["vnc-password"]).NotTo(Equal(secret.Data["vnc-password"]))
+			Expect(rotated.Data["remote-ssh-password"]).NotTo(Equal(secret.Data["remote-ssh-password"]))
+		})
+
+		It("generates unique passwords for experiments", func() {
+			first, err := buildExpectedCredentials(newVolumeExperiment(nil), endpoints, nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := buildExpectedCredentials(newVolumeExperiment(nil), endpoints, nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first.Data["remote-ssh-password"]).NotTo(Equal(second.Data["remote-ssh-password"]))
+		})
+	})
+
+	Context("env", func() {
+		It("injects generated passwords into the container serving endpoint", func() {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: mainContainerName},
+				{Name: "sshd", Ports: []corev1.ContainerPort{{ContainerPort: 22}}},
+				{Name: "logger"},
+			}}}
+			injectCredentialsEnv(pod, newVolumeExperiment(nil), endpoints)
+			envs := pod.Spec.Containers[0].Env
+			Expect(envs).To(HaveLen(1))
+			Expect(envs[0].Name).To(Equal("VNC_PASSWORD"))
+			Expect(envs[0].ValueFrom.SecretKeyRef).To(Equal(&corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "cred-test-expr"},
+				Key:                  "vnc-password",
+			}))
+			envs = pod.Spec.Containers[1].Env
+			Expect(envs).To(HaveLen(1))
+			Expect(envs[0].Name).To(Equal("DEV_PASSWORD"))
+			Expect(envs[0].ValueFrom.SecretKeyRef.Key).To(Equal("remote-ssh-password"))
+			Expect(pod.Spec.Containers[2].Env).To(BeEmpty())
+		})
+	})
+
+	Context("rotation", func() {
+		It("reports experiment provisioning until recreated pod is ready", func() {
+			cli := &actionClient{}
+			status := newLifecycleStatus(hackathonv1.ExperimentRunning)
+			status.Experiment.Spec.CredentialsRotation = 1
+			rs := &ResourceState{
+				Template: &hackathonv1.Template{Data: hackathonv1.TemplateData{
+					PodTemplate: &hackathonv1.PodTemplate{Image: "ubuntu"},
+					Endpoints:   endpoints,
+				}},
+				EnvPod: []corev1.Pod{{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-expr"},
+					Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+				}},
+			}
+			rotation := &Credentials{client: cli, status: status, resourceState: rs, logger: zap.New()}
+			_, err := rotation.Reconcile(context.Background()).Aggregate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cli.deleted).To(HaveLen(1))
+			Expect(status.Status.ObservedCredentialsRotation).To(BeEquivalentTo(1))
+			Expect(rs.EnvPod[0].DeletionTimestamp).NotTo(BeNil())
+
+			c := &Controller{Client: cli, Logger: zap.New()}
+			_, err = c.reconcileExperimentPods(context.Background(), status, rs).Aggregate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentProvisioning))
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentPodReady)
+			Expect(cond.Reason).To(Equal("PodTerminating"))
+		})
+	})
+
+	Context("validation", func() {
+		It("warns and ignores template password", func() {
+			Expect(credentialsWarnings(endpoints)).To(BeEmpty())
+
+			shared := []hackathonv1.EndpointTemplate{
+				{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Port: 5901, VNC: &hackathonv1.VNCConfig{Password: "secret"}},
+			}
+			warnings := credentialsWarnings(shared)
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(ContainSubstring("endpoint vnc password is ignored"))
+			Expect(warnings[0]).To(ContainSubstring("VNC_PASSWORD"))
+
+			secret, err := buildExpectedCredentials(newVolumeExperiment(nil), shared, nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data["vnc-password"]).NotTo(BeEquivalentTo("secret"))
+		})
+	})
+})
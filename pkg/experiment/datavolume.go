@@ -10,15 +10,16 @@ import (
 	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
 	"github.com/kaiyuanshe/cloudengine/pkg/utils/logtool"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	hostPathDir   = "/opt/open-hackathon/cloud-engine/data"
-	containerPath = "/data"
-	volumeSizeGi  = 10
+	defaultMountPath = "/data"
+	defaultSizeGi    = 10
 )
 
 type DataVolume struct {
@@ -28,20 +29,102 @@ type DataVolume struct {
 	logger        logr.Logger
 }
 
+// dataVolumeConfig is the effective data volume config of experiment,
+// merged from controller defaults, template and experiment spec
+type dataVolumeConfig struct {
+	Backend      hackathonv1.DataVolumeBackend
+	Node         string
+	NodeHostname string
+	Size         resource.Quantity
+	StorageClass string
+	MountPath    string
+}
+
 func (v *DataVolume) Reconcile(ctx context.Context) *results.Results {
-	return results.NewResults(ctx).
-		WithResult(v.reconcileVolumeClaim(ctx)).
-		WithResult(v.reconcileVolume(ctx))
+	result := results.NewResults(ctx)
+	config, warning := effectiveDataVolume(v.status.Experiment, v.resourceState.Template)
+	if warning != "" {
+		v.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, warning)
+	}
+
+	if restoreFromSnapshot(v.status.Experiment) && config.StorageClass == "" && v.resourceState.DataVolumeClaim == nil {
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "StorageClassRequired",
+			"restoring snapshot requires a CSI storage class in template or data-volume-snapshot-storage-class flag")
+		return result
+	}
+
+	if err := ValidateDataVolumeBackend(string(config.Backend)); err != nil {
+		if cond := hackathonv1.QueryExperimentCondition(v.status.Status.Conditions, hackathonv1.ExperimentVolumeCreated); cond == nil || cond.Message != err.Error() {
+			v.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, err.Error())
+		}
+		v.status.SetCondition(hackathonv1.ExperimentVolumeCreated, hackathonv1.ExperimentConditionFalse, "InvalidBackend", err.Error())
+		return result
+	}
+
+	if config.Backend == hackathonv1.LocalDataVolume && (config.Node == "" || v.resourceState.DataVolume == nil) {
+		node, hostname, err := v.volumeNode(ctx, config.Node)
+		if err != nil {
+			v.status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, err.Error())
+			return result.WithError(err)
+		}
+		config.Node, config.NodeHostname = node, hostname
+	}
+
+	result.WithResult(v.reconcileVolumeClaim(ctx, config))
+	if preProvisioned(config.Backend) {
+		result.WithResult(v.reconcileVolume(ctx, config))
+	}
+	v.updateVolumeStatus(config)
+	return result.WithResult(v.reconcileVolumeContent(ctx))
 }
 
-func (v *DataVolume) reconcileVolume(ctx context.Context) *results.Results {
+// volumeNode returns the node of an existing local volume, the node recorded in status, the node of
+// source volume if cloning, or picks a new one
+func (v *DataVolume) volumeNode(ctx context.Context, node string) (string, string, error) {
+	if pv := v.resourceState.DataVolume; pv != nil && pv.Labels[LabelKeyNodeName] != "" {
+		return pv.Labels[LabelKeyNodeName], "", nil
+	}
+	if node == "" && cloneFromExperiment(v.status.Experiment) {
+		// clone job mounts both volumes, it can only be scheduled if they are on the same node
+		node = sourceVolumeNode(v.resourceState.SourceExperiment)
+	}
+	if node != "" {
+		no := &corev1.Node{}
+		if err := v.client.Get(ctx, types.NamespacedName{Name: node}, no); err != nil {
+			return "", "", fmt.Errorf("query data volume node %s failed: %s", node, err.Error())
+		}
+		return node, no.Labels[corev1.LabelHostname], nil
+	}
+	return pickVolumeNode(ctx, v.client)
+}
+
+// sourceVolumeNode returns the node of source experiment local volume, empty if source volume is not local
+func sourceVolumeNode(source *hackathonv1.Experiment) string {
+	if source == nil || source.Status.DataVolume == nil || source.Status.DataVolume.Backend != hackathonv1.LocalDataVolume {
+		return ""
+	}
+	return source.Status.DataVolume.Node
+}
+
+func (v *DataVolume) updateVolumeStatus(config *dataVolumeConfig) {
+	node := config.Node
+	if node == "" && len(v.resourceState.EnvPod) > 0 {
+		node = v.resourceState.EnvPod[0].Spec.NodeName
+	}
+	v.status.Status.DataVolume = &hackathonv1.ExperimentDataVolumeStatus{
+		Backend: config.Backend,
+		Node:    node,
+	}
+}
+
+func (v *DataVolume) reconcileVolume(ctx context.Context, dvConfig *dataVolumeConfig) *results.Results {
 	defer logtool.SpendTimeRecord(v.logger, "reconcile data volume")()
 	result := results.NewResults(ctx)
 	var (
 		pvName = dataVolumeName(v.status.Experiment)
 	)
 
-	expected := buildExpectedDataVolume(v.status.Experiment)
+	expected := volumeBuilders[dvConfig.Backend](v.status.Experiment, dvConfig)
 	reconciled := v.resourceState.DataVolume
 	if reconciled == nil {
 		reconciled = expected
@@ -68,13 +151,13 @@ func (v *DataVolume) reconcileVolume(ctx context.Context) *results.Results {
 	return result.WithError(reconciler.ReconcileResource(ctx, config))
 }
 
-func (v *DataVolume) reconcileVolumeClaim(ctx context.Context) *results.Results {
+func (v *DataVolume) reconcileVolumeClaim(ctx context.Context, dvConfig *dataVolumeConfig) *results.Results {
 	defer logtool.SpendTimeRecord(v.logger, "reconcile volume claim")()
 	result := results.NewResults(ctx)
 	var (
 		pvcName = dataVolumeClaimName(v.status.Experiment)
 	)
-	expected := buildExpectedDataVolumeClaim(v.status.Experiment)
+	expected := buildExpectedDataVolumeClaim(v.status.Experiment, dvConfig)
 	v.logger.Info("build expected pvc", "pvc", pvcName)
 	reconciled := v.resourceState.DataVolumeClaim
 	if reconciled == nil {
@@ -87,7 +170,7 @@ func (v *DataVolume) reconcileVolumeClaim(ctx context.Context) *results.Results
 		Expected:   expected,
 		Reconciled: reconciled,
 		NeedUpdate: func() bool {
-			return false
+			return v.needExpandVolumeClaim(ctx, dvConfig)
 		},
 		NeedRecreate: func() bool {
 			return false
@@ -97,10 +180,16 @@ func (v *DataVolume) reconcileVolumeClaim(ctx context.Context) *results.Results
 			return nil
 		},
 		PreUpdateHook: func() error {
+			pvc := reconciled
+			if pvc.Spec.Resources.Requests == nil {
+				pvc.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = dvConfig.Size
 			return nil
 		},
 		PostUpdateHook: func() error {
-			v.status.AddEvent(corev1.EventTypeNormal, event.ReasonUpdated, "update data volume claim")
+			v.status.AddEvent(corev1.EventTypeNormal, event.ReasonUpdated, fmt.Sprintf("expand data volume claim to %s", dvConfig.Size.String()))
+			v.status.SetCondition(hackathonv1.ExperimentVolumeExpanded, hackathonv1.ExperimentConditionTrue, "Expanded", dvConfig.Size.String())
 			return nil
 		},
 		Logger: v.logger.WithValues("pvc", pvcName),
@@ -109,6 +198,102 @@ func (v *DataVolume) reconcileVolumeClaim(ctx context.Context) *results.Results
 	return result.WithError(reconciler.ReconcileResource(ctx, config))
 }
 
+// needExpandVolumeClaim checks whether the existing claim is smaller than expected
+// and its storage class allows volume expansion, shrinking a volume is never supported.
+// Expansion not carried out is recorded in VolumeExpanded condition instead of an event per reconcile
+func (v *DataVolume) needExpandVolumeClaim(ctx context.Context, dvConfig *dataVolumeConfig) bool {
+	pvc := v.resourceState.DataVolumeClaim
+	if pvc == nil {
+		return false
+	}
+	current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	switch current.Cmp(dvConfig.Size) {
+	case 0:
+		if hackathonv1.QueryExperimentCondition(v.status.Status.Conditions, hackathonv1.ExperimentVolumeExpanded) != nil {
+			v.status.SetCondition(hackathonv1.ExperimentVolumeExpanded, hackathonv1.ExperimentConditionTrue, "Expanded", current.String())
+		}
+		return false
+	case 1:
+		v.logger.V(3).Info("data volume shrink not supported", "current", current.String(), "expected", dvConfig.Size.String())
+		v.status.SetCondition(hackathonv1.ExperimentVolumeExpanded, hackathonv1.ExperimentConditionFalse, "ShrinkNotSupported",
+			fmt.Sprintf("data volume can not shrink from %s to %s", current.String(), dvConfig.Size.String()))
+		return false
+	}
+
+	sc := &storagev1.StorageClass{}
+	if pvc.Spec.StorageClassName == nil {
+		return false
+	}
+	if err := v.client.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, sc); err != nil {
+		v.logger.Error(err, "query storage class failed", "storageClass", *pvc.Spec.StorageClassName)
+		return false
+	}
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		msg := fmt.Sprintf("storage class %s does not support volume expansion", sc.Name)
+		if cond := hackathonv1.QueryExperimentCondition(v.status.Status.Conditions, hackathonv1.ExperimentVolumeExpanded); cond == nil || cond.Message != msg {
+			v.status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, msg)
+		}
+		v.status.SetCondition(hackathonv1.ExperimentVolumeExpanded, hackathonv1.ExperimentConditionFalse, "ExpansionNotSupported", msg)
+		return false
+	}
+	return true
+}
+
+// effectiveDataVolume merges data volume config, a warning is returned
+// if the size requested by experiment is out of template limits
+func effectiveDataVolume(experiment *hackathonv1.Experiment, template *hackathonv1.Template) (*dataVolumeConfig, string) {
+	config := &dataVolumeConfig{
+		Backend:      hackathonv1.DataVolumeBackend(DataVolumeBackend),
+		Size:         resource.MustParse(fmt.Sprintf("%dGi", defaultSizeGi)),
+		StorageClass: DataVolumeStorageClass,
+		MountPath:    defaultMountPath,
+	}
+	warning := ""
+
+	tmplVolume := template.Data.DataVolume
+	if tmplVolume != nil {
+		if tmplVolume.Size != nil {
+			config.Size = tmplVolume.Size.DeepCopy()
+		}
+		if tmplVolume.StorageClassName != nil {
+			config.StorageClass = *tmplVolume.StorageClassName
+		}
+		if tmplVolume.MountPath != "" {
+			config.MountPath = tmplVolume.MountPath
+		}
+		if tmplVolume.Backend != "" {
+			config.Backend = tmplVolume.Backend
+		}
+	}
+
+	if restoreFromSnapshot(experiment) {
+		// the default storage class is usually not able to restore snapshot
+		config.Backend = hackathonv1.DynamicDataVolume
+		if tmplVolume == nil || tmplVolume.StorageClassName == nil {
+			config.StorageClass = DataVolumeSnapshotStorageClass
+		}
+	}
+	// backend and node never change once volume is created
+	if dv := experiment.Status.DataVolume; dv != nil && dv.Backend != "" {
+		config.Backend = dv.Backend
+		config.Node = dv.Node
+	}
+
+	if experiment.Spec.DataVolumeSize != nil {
+		maxSize := config.Size.DeepCopy()
+		if tmplVolume != nil && tmplVolume.MaxSize != nil {
+			maxSize = tmplVolume.MaxSize.DeepCopy()
+		}
+		if experiment.Spec.DataVolumeSize.Cmp(maxSize) > 0 {
+			warning = fmt.Sprintf("data volume size %s exceeds template limit %s", experiment.Spec.DataVolumeSize.String(), maxSize.String())
+			config.Size = maxSize
+		} else {
+			config.Size = experiment.Spec.DataVolumeSize.DeepCopy()
+		}
+	}
+	return config, warning
+}
+
 func dataVolumeName(experiment *hackathonv1.Experiment) string {
 	return fmt.Sprintf("pv-%s", experiment.Name)
 }
@@ -117,35 +302,9 @@ func dataVolumeClaimName(experiment *hackathonv1.Experiment) string {
 	return fmt.Sprintf("pvc-%s", experiment.Name)
 }
 
-func buildExpectedDataVolume(experiment *hackathonv1.Experiment) *corev1.PersistentVolume {
-	hostType := corev1.HostPathDirectoryOrCreate
-	return &corev1.PersistentVolume{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: dataVolumeName(experiment),
-			Labels: map[string]string{
-				LabelKeyClusterName:    experiment.Spec.ClusterName,
-				LabelKeyExperimentName: experiment.Name,
-			},
-		},
-		Spec: corev1.PersistentVolumeSpec{
-			Capacity: map[corev1.ResourceName]resource.Quantity{
-				corev1.ResourceStorage: resource.MustParse(fmt.Sprintf("%dGi", volumeSizeGi)),
-			},
-			PersistentVolumeSource: corev1.PersistentVolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Path: fmt.Sprintf("%s/%s", hostPathDir, experiment.UID),
-					Type: &hostType,
-				}},
-			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRecycle,
-			StorageClassName:              DataVolumeStorageClass,
-			ClaimRef:                      &corev1.ObjectReference{Namespace: experiment.Namespace, Name: dataVolumeClaimName(experiment)},
-		},
-	}
-}
-
-func buildExpectedDataVolumeClaim(experiment *hackathonv1.Experiment) *corev1.PersistentVolumeClaim {
-	return &corev1.PersistentVolumeClaim{
+func buildExpectedDataVolumeClaim(experiment *hackathonv1.Experiment, config *dataVolumeConfig) *corev1.PersistentVolumeClaim {
+	storageClass := config.StorageClass
+	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: experiment.Namespace,
 			Name:      dataVolumeClaimName(experiment),
@@ -157,11 +316,25 @@ func buildExpectedDataVolumeClaim(experiment *hackathonv1.Experiment) *corev1.Pe
 		Spec: corev1.PersistentVolumeClaimSpec{
 			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
 			Resources: corev1.ResourceRequirements{Requests: map[corev1.ResourceName]resource.Quantity{
-				corev1.ResourceStorage: resource.MustParse(fmt.Sprintf("%dGi", volumeSizeGi)),
+				corev1.ResourceStorage: config.Size,
 			}},
-			VolumeName:       dataVolumeName(experiment),
-			StorageClassName: &DataVolumeStorageClass,
+			StorageClassName: &storageClass,
 			DataSource:       nil,
 		},
 	}
+
+	if preProvisioned(config.Backend) {
+		pvc.Spec.VolumeName = dataVolumeName(experiment)
+	}
+
+	if restoreFromSnapshot(experiment) {
+		// let the storage class provision a new volume from snapshot
+		apiGroup := snapshotAPIGroup
+		pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     "VolumeSnapshot",
+			Name:     experiment.Spec.Source.Snapshot,
+		}
+	}
+	return pvc
 }
@@ -0,0 +1,119 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func newVolumeExperiment(source *hackathonv1.ExperimentSource) *hackathonv1.Experiment {
+	return &hackathonv1.Experiment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-expr", Namespace: "default"},
+		Spec:       hackathonv1.ExperimentSpec{Template: "test-tmpl", Source: source},
+	}
+}
+
+var _ = Describe("experiment-data-volume", func() {
+	Context("snapshot restore", func() {
+		snapshotClass := DataVolumeSnapshotStorageClass
+		AfterEach(func() {
+			DataVolumeSnapshotStorageClass = snapshotClass
+		})
+
+		It("uses snapshot storage class instead of default class", func() {
+			DataVolumeSnapshotStorageClass = "csi-snapshot"
+			expr := newVolumeExperiment(&hackathonv1.ExperimentSource{Snapshot: "snap"})
+			config, warning := effectiveDataVolume(expr, &hackathonv1.Template{})
+			Expect(warning).To(BeEmpty())
+			Expect(config.Backend).To(Equal(hackathonv1.DynamicDataVolume))
+			Expect(config.StorageClass).To(Equal("csi-snapshot"))
+
+			pvc := buildExpectedDataVolumeClaim(expr, config)
+			Expect(*pvc.Spec.StorageClassName).To(Equal("csi-snapshot"))
+			Expect(pvc.Spec.DataSource.Name).To(Equal("snap"))
+			Expect(pvc.Spec.VolumeName).To(BeEmpty())
+		})
+
+		It("prefers storage class of template", func() {
+			DataVolumeSnapshotStorageClass = "csi-snapshot"
+			class := "csi-template"
+			tmpl := &hackathonv1.Template{Data: hackathonv1.TemplateData{
+				DataVolume: &hackathonv1.DataVolumeTemplate{StorageClassName: &class},
+			}}
+			config, _ := effectiveDataVolume(newVolumeExperiment(&hackathonv1.ExperimentSource{Snapshot: "snap"}), tmpl)
+			Expect(config.StorageClass).To(Equal("csi-template"))
+		})
+
+		It("leaves storage class empty without csi class", func() {
+			DataVolumeSnapshotStorageClass = ""
+			config, _ := effectiveDataVolume(newVolumeExperiment(&hackathonv1.ExperimentSource{Snapshot: "snap"}), &hackathonv1.Template{})
+			Expect(config.StorageClass).To(BeEmpty())
+
+			config, _ = effectiveDataVolume(newVolumeExperiment(nil), &hackathonv1.Template{})
+			Expect(config.StorageClass).To(Equal(DataVolumeStorageClass))
+		})
+	})
+
+	Context("size", func() {
+		It("limits requested size by template max size", func() {
+			size, maxSize := resource.MustParse("5Gi"), resource.MustParse("20Gi")
+			tmpl := &hackathonv1.Template{Data: hackathonv1.TemplateData{
+				DataVolume: &hackathonv1.DataVolumeTemplate{Size: &size, MaxSize: &maxSize},
+			}}
+			expr := newVolumeExperiment(nil)
+			config, warning := effectiveDataVolume(expr, tmpl)
+			Expect(warning).To(BeEmpty())
+			Expect(config.Size.String()).To(Equal("5Gi"))
+
+			requested := resource.MustParse("15Gi")
+			expr.Spec.DataVolumeSize = &requested
+			config, warning = effectiveDataVolume(expr, tmpl)
+			Expect(warning).To(BeEmpty())
+			Expect(config.Size.String()).To(Equal("15Gi"))
+
+			requested = resource.MustParse("30Gi")
+			config, warning = effectiveDataVolume(expr, tmpl)
+			Expect(warning).To(ContainSubstring("exceeds template limit"))
+			Expect(config.Size.String()).To(Equal("20Gi"))
+		})
+	})
+
+	Context("expansion", func() {
+		It("records shrink in condition without expanding", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentRunning)
+			current := resource.MustParse("10Gi")
+			v := &DataVolume{status: status, resourceState: &ResourceState{
+				DataVolumeClaim: &corev1.PersistentVolumeClaim{Spec: corev1.PersistentVolumeClaimSpec{
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: current}},
+				}},
+			}, logger: zap.New()}
+
+			Expect(v.needExpandVolumeClaim(context.Background(), &dataVolumeConfig{Size: resource.MustParse("10Gi")})).To(BeFalse())
+			Expect(status.Status.Conditions).To(BeEmpty())
+
+			Expect(v.needExpandVolumeClaim(context.Background(), &dataVolumeConfig{Size: resource.MustParse("5Gi")})).To(BeFalse())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentVolumeExpanded)
+			Expect(cond.Reason).To(Equal("ShrinkNotSupported"))
+			Expect(status.Events).To(BeEmpty())
+
+			Expect(v.needExpandVolumeClaim(context.Background(), &dataVolumeConfig{Size: resource.MustParse("10Gi")})).To(BeFalse())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentVolumeExpanded, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+		})
+	})
+
+	Context("conditions", func() {
+		It("updates condition when only message changed", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentProvisioning)
+			status.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PodWarning", "first")
+			status.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PodWarning", "second")
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentPodReady)
+			Expect(cond.Message).To(Equal("second"))
+		})
+	})
+})
@@ -0,0 +1,125 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+)
+
+const (
+	diagnoseImagePullFailed   = "ImagePullFailed"
+	diagnoseCrashLoop         = "CrashLoop"
+	diagnoseOOMKilled         = "OOMKilled"
+	diagnoseConfigError       = "ConfigError"
+	diagnoseUnschedulable     = "Unschedulable"
+	diagnoseVolumeMountFailed = "VolumeMountFailed"
+	diagnosePodFailed         = "PodFailed"
+	diagnosePodWarning        = "PodWarning"
+	diagnosePodNotReady       = "PodNotReady"
+)
+
+// podDiagnosis is the most specific reason why env pod is not ready,
+// fatal means the pod will not become ready without changes
+type podDiagnosis struct {
+	Reason  string
+	Message string
+	Fatal   bool
+}
+
+// waitingReasons maps container waiting reasons to diagnosis reasons,
+// a single failed pull may be a registry hiccup, it is fatal only after kubelet backs off
+var waitingReasons = map[string]struct {
+	reason string
+	fatal  bool
+}{
+	"ErrImagePull":               {diagnoseImagePullFailed, false},
+	"ImagePullBackOff":           {diagnoseImagePullFailed, true},
+	"InvalidImageName":           {diagnoseImagePullFailed, true},
+	"CrashLoopBackOff":           {diagnoseCrashLoop, true},
+	"CreateContainerConfigError": {diagnoseConfigError, true},
+	"CreateContainerError":       {diagnoseConfigError, true},
+}
+
+// eventReasons maps warning event reasons of pod to diagnosis reasons
+var eventReasons = map[string]string{
+	"FailedScheduling":       diagnoseUnschedulable,
+	"FailedMount":            diagnoseVolumeMountFailed,
+	"FailedAttachVolume":     diagnoseVolumeMountFailed,
+	"FailedCreatePodSandBox": diagnosePodWarning,
+	"Failed":                 diagnosePodWarning,
+	"BackOff":                diagnosePodWarning,
+}
+
+// diagnosePod inspects pod phase, container statuses, pod conditions and then warning events in order
+func diagnosePod(pod *corev1.Pod, events []corev1.Event) *podDiagnosis {
+	if pod.Status.Phase == corev1.PodFailed {
+		return &podDiagnosis{Reason: diagnosePodFailed, Message: fmt.Sprintf("pod failed: %s %s", pod.Status.Reason, pod.Status.Message), Fatal: true}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if terminated := cs.State.Terminated; terminated != nil && terminated.Reason == podReasonOOMKilled {
+			// kubelet restarts the container, it is fatal once crash looping
+			return &podDiagnosis{Reason: diagnoseOOMKilled, Message: fmt.Sprintf("container %s killed for exceeding memory limit", cs.Name)}
+		}
+		if cs.State.Waiting == nil {
+			continue
+		}
+		mapped, ok := waitingReasons[cs.State.Waiting.Reason]
+		if !ok {
+			continue
+		}
+		msg := fmt.Sprintf("container %s %s: %s", cs.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+		last := cs.LastTerminationState.Terminated
+		if last != nil {
+			msg = fmt.Sprintf("%s, last exit code %d %s", msg, last.ExitCode, last.Reason)
+		}
+		if mapped.reason == diagnoseCrashLoop && last != nil && last.Reason == podReasonOOMKilled {
+			return &podDiagnosis{Reason: diagnoseOOMKilled, Message: msg, Fatal: true}
+		}
+		return &podDiagnosis{Reason: mapped.reason, Message: msg, Fatal: mapped.fatal}
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return &podDiagnosis{Reason: diagnoseUnschedulable, Message: cond.Message}
+		}
+	}
+
+	// the latest warning event is the most relevant one
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastTimestamp.After(events[j].LastTimestamp.Time)
+	})
+	for _, evt := range events {
+		if evt.Type != corev1.EventTypeWarning {
+			continue
+		}
+		if reason, ok := eventReasons[evt.Reason]; ok {
+			return &podDiagnosis{Reason: reason, Message: fmt.Sprintf("%s: %s", evt.Reason, evt.Message)}
+		}
+	}
+	return &podDiagnosis{Reason: diagnosePodNotReady, Message: fmt.Sprintf("pod is %s", pod.Status.Phase)}
+}
+
+// podEvents queries events of pod from api server, events are not cached by manager
+func (c *Controller) podEvents(ctx context.Context, pod *corev1.Pod) []corev1.Event {
+	if c.APIReader == nil {
+		return nil
+	}
+	eventList := &corev1.EventList{}
+	err := c.APIReader.List(ctx, eventList, client.InNamespace(pod.Namespace),
+		client.MatchingFields{"involvedObject.kind": "Pod", "involvedObject.name": pod.Name})
+	if err != nil {
+		c.Logger.Info("query pod events failed", "pod", pod.Name, "error", err.Error())
+		return nil
+	}
+	events := make([]corev1.Event, 0)
+	for _, evt := range eventList.Items {
+		if evt.InvolvedObject.UID == pod.UID {
+			events = append(events, evt)
+		}
+	}
+	return events
+}
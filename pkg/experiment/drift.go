@@ -0,0 +1,74 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/k8stools"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func templateUpdatePolicy(template *hackathonv1.Template) hackathonv1.TemplateUpdatePolicy {
+	if template.Data.UpdatePolicy == "" {
+		return hackathonv1.UpdateOnResume
+	}
+	return template.Data.UpdatePolicy
+}
+
+// podSpecHash only covers containers from template, the data seed init container
+// is not part of the experiment environment. Pods without template init containers are hashed
+// by containers only, so that pods created before init containers supported are not drifted
+func podSpecHash(pod *corev1.Pod) (string, error) {
+	initContainers := make([]corev1.Container, 0)
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name != dataSeedContainerName {
+			initContainers = append(initContainers, c)
+		}
+	}
+	if len(initContainers) == 0 {
+		return k8stools.HashObject(pod.Spec.Containers)
+	}
+	return k8stools.HashObject(struct {
+		Containers     []corev1.Container
+		InitContainers []corev1.Container
+	}{pod.Spec.Containers, initContainers})
+}
+
+// reconcilePodDrift compares the running env pod with the expected one and applies template update policy,
+// it reports whether the env pod is deleted and should be recreated
+func (c *Controller) reconcilePodDrift(ctx context.Context, status *Status, rs *ResourceState, expected, reconciled *corev1.Pod) (bool, error) {
+	template := rs.Template
+	current, ok := reconciled.Annotations[AnnotationKeyPodSpecHash]
+	if !ok {
+		// pods created before drift detection, nothing to compare
+		return false, nil
+	}
+	if current == expected.Annotations[AnnotationKeyPodSpecHash] {
+		status.SetCondition(hackathonv1.ExperimentUpdatePending, hackathonv1.ExperimentConditionFalse, "UpToDate", "")
+		if rs.TemplateRevision != "" {
+			status.Status.TemplateRevision = rs.TemplateRevision
+		}
+		return false, nil
+	}
+
+	policy := templateUpdatePolicy(template)
+	c.Logger.Info("env pod drifted from template", "policy", policy, "current", current)
+	switch policy {
+	case hackathonv1.UpdateImmediate:
+		if err := client.IgnoreNotFound(c.Client.Delete(ctx, reconciled)); err != nil {
+			return false, fmt.Errorf("delete drifted env pod failed: %s", err.Error())
+		}
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonUpgraded, fmt.Sprintf("template %s changed, recreate env pod", template.Name))
+		status.SetCondition(hackathonv1.ExperimentUpdatePending, hackathonv1.ExperimentConditionTrue, "Recreating", "")
+		return true, nil
+	case hackathonv1.UpdateOnResume:
+		status.SetCondition(hackathonv1.ExperimentUpdatePending, hackathonv1.ExperimentConditionTrue, "WaitForResume",
+			"template changed, the update is applied on next resume")
+	default:
+		status.SetCondition(hackathonv1.ExperimentUpdatePending, hackathonv1.ExperimentConditionTrue, "UpdatePolicyNever",
+			"template changed, the update is never applied to this env pod")
+	}
+	return false, nil
+}
@@ -0,0 +1,93 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func newHashedPod(image string) *corev1.Pod {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "experiment", Image: image}},
+	}}
+	hash, err := podSpecHash(pod)
+	Expect(err).NotTo(HaveOccurred())
+	pod.Annotations = map[string]string{AnnotationKeyPodSpecHash: hash}
+	return pod
+}
+
+var _ = Describe("experiment-drift", func() {
+	Context("pod spec hash", func() {
+		It("is stable and follows containers", func() {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "experiment", Image: "ubuntu:20.04"}}}}
+			first, err := podSpecHash(pod)
+			Expect(err).NotTo(HaveOccurred())
+			second, _ := podSpecHash(pod.DeepCopy())
+			Expect(second).To(Equal(first))
+
+			pod.Spec.Containers[0].Image = "ubuntu:22.04"
+			changed, _ := podSpecHash(pod)
+			Expect(changed).NotTo(Equal(first))
+		})
+
+		It("ignores data seed and pod level fields", func() {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "experiment", Image: "ubuntu"}}}}
+			origin, _ := podSpecHash(pod)
+
+			pod.Spec.InitContainers = []corev1.Container{{Name: dataSeedContainerName, Image: DataVolumeJobImage}}
+			pod.Spec.NodeName = "node-a"
+			seeded, _ := podSpecHash(pod)
+			Expect(seeded).To(Equal(origin))
+		})
+	})
+
+	Context("update policy", func() {
+		var (
+			c      *Controller
+			status *Status
+			rs     *ResourceState
+		)
+		BeforeEach(func() {
+			c = &Controller{Logger: zap.New()}
+			status = newLifecycleStatus(hackathonv1.ExperimentRunning)
+			rs = &ResourceState{Template: &hackathonv1.Template{}}
+		})
+
+		It("defaults to OnResume", func() {
+			Expect(templateUpdatePolicy(rs.Template)).To(Equal(hackathonv1.UpdateOnResume))
+		})
+
+		It("ignores pods created before drift detection", func() {
+			recreate, err := c.reconcilePodDrift(context.Background(), status, rs, newHashedPod("ubuntu"), &corev1.Pod{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recreate).To(BeFalse())
+			Expect(status.Status.Conditions).To(BeEmpty())
+		})
+
+		It("marks up to date pod", func() {
+			recreate, err := c.reconcilePodDrift(context.Background(), status, rs, newHashedPod("ubuntu"), newHashedPod("ubuntu"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recreate).To(BeFalse())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentUpdatePending, hackathonv1.ExperimentConditionFalse)).To(BeTrue())
+		})
+
+		It("keeps drifted pod until resume or forever", func() {
+			recreate, err := c.reconcilePodDrift(context.Background(), status, rs, newHashedPod("ubuntu:22.04"), newHashedPod("ubuntu:20.04"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recreate).To(BeFalse())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentUpdatePending)
+			Expect(cond.Reason).To(Equal("WaitForResume"))
+
+			rs.Template.Data.UpdatePolicy = hackathonv1.UpdateNever
+			recreate, err = c.reconcilePodDrift(context.Background(), status, rs, newHashedPod("ubuntu:22.04"), newHashedPod("ubuntu:20.04"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recreate).To(BeFalse())
+			cond = hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentUpdatePending)
+			Expect(cond.Reason).To(Equal("UpdatePolicyNever"))
+		})
+	})
+})
@@ -0,0 +1,50 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+)
+
+// templateEndpoints returns endpoints of template, the legacy ingress protocol and port
+// are converted to an endpoint named by protocol
+func templateEndpoints(template *hackathonv1.Template) []hackathonv1.EndpointTemplate {
+	if len(template.Data.Endpoints) > 0 {
+		return template.Data.Endpoints
+	}
+	if template.Data.IngressProtocol == "" {
+		return nil
+	}
+	return []hackathonv1.EndpointTemplate{
+		{
+			Name:     string(template.Data.IngressProtocol),
+			Protocol: template.Data.IngressProtocol,
+			Port:     template.Data.IngressPort,
+			VNC:      template.Data.VNC,
+			SSH:      template.Data.SSH,
+		},
+	}
+}
+
+func endpointServiceGroup(endpoint *hackathonv1.EndpointTemplate) string {
+	if endpoint.Service != "" {
+		return endpoint.Service
+	}
+	return endpoint.Name
+}
+
+func validateEndpoints(endpoints []hackathonv1.EndpointTemplate) error {
+	names := map[string]bool{}
+	for _, endpoint := range endpoints {
+		if endpoint.Name == "" {
+			return fmt.Errorf("endpoint name is empty")
+		}
+		if names[endpoint.Name] {
+			return fmt.Errorf("endpoint %s is duplicated", endpoint.Name)
+		}
+		names[endpoint.Name] = true
+		if endpoint.Port <= 0 {
+			return fmt.Errorf("endpoint %s port %d is invalid", endpoint.Name, endpoint.Port)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("experiment-endpoints", func() {
+	It("converts legacy ingress config to an endpoint", func() {
+		tmpl := &hackathonv1.Template{Data: hackathonv1.TemplateData{
+			IngressProtocol: hackathonv1.ExperimentIngressSSH,
+			IngressPort:     22,
+			SSH:             &hackathonv1.SSHConfig{Username: "root"},
+		}}
+		endpoints := templateEndpoints(tmpl)
+		Expect(endpoints).To(HaveLen(1))
+		Expect(endpoints[0].Name).To(Equal("ssh"))
+		Expect(endpoints[0].Port).To(Equal(int32(22)))
+		Expect(endpoints[0].SSH.Username).To(Equal("root"))
+
+		Expect(templateEndpoints(&hackathonv1.Template{})).To(BeEmpty())
+	})
+
+	It("validates endpoint names and ports", func() {
+		endpoints := []hackathonv1.EndpointTemplate{
+			{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 22},
+			{Name: "web", Protocol: hackathonv1.ExperimentIngressHTTP, Port: 8080},
+		}
+		Expect(validateEndpoints(endpoints)).To(Succeed())
+
+		endpoints[1].Name = "ssh"
+		Expect(validateEndpoints(endpoints)).To(MatchError(ContainSubstring("duplicated")))
+
+		endpoints[1].Name = ""
+		Expect(validateEndpoints(endpoints)).To(MatchError(ContainSubstring("empty")))
+
+		endpoints[1].Name, endpoints[1].Port = "web", 0
+		Expect(validateEndpoints(endpoints)).To(MatchError(ContainSubstring("invalid")))
+	})
+
+	It("groups endpoints into services", func() {
+		expr := newVolumeExperiment(nil)
+		endpoints := []hackathonv1.EndpointTemplate{
+			{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: 22},
+			{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Port: 5900, Service: "desktop"},
+			{Name: "novnc", Protocol: hackathonv1.ExperimentIngressHTTP, Port: 6080, Service: "desktop"},
+		}
+		services, err := buildExpectedIngressServices(expr, endpoints, []string{"10.0.0.1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(services).To(HaveLen(2))
+
+		ssh := services["svc-test-expr-ssh"]
+		Expect(ssh).NotTo(BeNil())
+		Expect(ssh.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+		Expect(ssh.Spec.ExternalIPs).To(Equal([]string{"10.0.0.1"}))
+		Expect(ssh.Spec.Ports).To(HaveLen(1))
+		Expect(ssh.Spec.Selector[LabelKeyExperimentName]).To(Equal("test-expr"))
+		Expect(ssh.OwnerReferences).To(HaveLen(1))
+
+		desktop := services["svc-test-expr-desktop"]
+		Expect(desktop).NotTo(BeNil())
+		Expect(desktop.Spec.Ports).To(HaveLen(2))
+		Expect(desktop.Spec.Ports[0].Name).To(Equal("vnc"))
+		Expect(desktop.Spec.Ports[1].TargetPort.IntValue()).To(Equal(6080))
+	})
+})
@@ -0,0 +1,157 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+const (
+	hostPathMountPath = "/host"
+)
+
+// Finalize stops the deleted experiment and reclaims its data volume after retention period,
+// it reports whether the data volume finalizer can be removed
+func (c *Controller) Finalize(ctx context.Context, status *Status) (*results.Results, bool) {
+	result := results.NewResults(ctx)
+	expr := status.Experiment
+	status.Transit(eventTerminate, "experiment deleted")
+
+	if err := c.deleteEnvPods(ctx, expr); err != nil {
+		return result.WithError(err), false
+	}
+
+	retention := c.retentionPeriod(ctx, expr)
+	deadline := expr.DeletionTimestamp.Add(retention)
+	if remaining := time.Until(deadline); remaining > 0 {
+		status.SetCondition(hackathonv1.ExperimentVolumeRetained, hackathonv1.ExperimentConditionTrue, "Retained",
+			fmt.Sprintf("data volume retained until %s", deadline.Format(time.RFC3339)))
+		wait := remaining
+		if expiring := remaining - DataVolumeExpiryWarning; expiring > 0 {
+			wait = expiring
+		} else {
+			status.SetCondition(hackathonv1.ExperimentVolumeExpiring, hackathonv1.ExperimentConditionTrue, "Expiring",
+				fmt.Sprintf("data volume reclaimed at %s", deadline.Format(time.RFC3339)))
+		}
+		return result.With("wait-retention-period", func() (reconcile.Result, error) {
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}), false
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: expr.Namespace, Name: dataVolumeClaimName(expr)},
+	}
+	if err := client.IgnoreNotFound(c.Client.Delete(ctx, pvc)); err != nil {
+		return result.WithError(fmt.Errorf("delete data volume claim failed: %s", err.Error())), false
+	}
+
+	backend, node := hackathonv1.HostPathDataVolume, ""
+	if dv := expr.Status.DataVolume; dv != nil {
+		backend, node = dv.Backend, dv.Node
+	}
+	if !preProvisioned(backend) {
+		// dynamic volume is reclaimed by storage class
+		status.SetCondition(hackathonv1.ExperimentVolumeRetained, hackathonv1.ExperimentConditionFalse, "Reclaimed", "")
+		return result, true
+	}
+
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: dataVolumeName(expr)},
+	}
+	if err := client.IgnoreNotFound(c.Client.Delete(ctx, pv)); err != nil {
+		return result.WithError(fmt.Errorf("delete data volume failed: %s", err.Error())), false
+	}
+
+	job := &batchv1.Job{}
+	err := c.Client.Get(ctx, types.NamespacedName{Namespace: expr.Namespace, Name: cleanupJobName(expr)}, job)
+	if errors.IsNotFound(err) {
+		expected, err := buildCleanupJob(expr, node)
+		if err != nil {
+			return result.WithError(err), false
+		}
+		if err = c.Client.Create(ctx, expected); err != nil {
+			return result.WithError(fmt.Errorf("create cleanup job failed: %s", err.Error())), false
+		}
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonDeleted, "clean up data volume")
+		status.SetCondition(hackathonv1.ExperimentVolumeRetained, hackathonv1.ExperimentConditionFalse, "Reclaiming", "")
+		return result, false
+	}
+	if err != nil {
+		return result.WithError(fmt.Errorf("query cleanup job failed: %s", err.Error())), false
+	}
+
+	succeeded, failed := jobFinished(job)
+	switch {
+	case succeeded:
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonDeleted, "data volume reclaimed")
+		status.SetCondition(hackathonv1.ExperimentVolumeRetained, hackathonv1.ExperimentConditionFalse, "Reclaimed", "")
+		return result, true
+	case failed:
+		// never block experiment deletion, the host directory is left for manual cleanup
+		msg := fmt.Sprintf("cleanup job failed, %s left on node %s", dataVolumeHostPath(expr), node)
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonUnexpected, msg)
+		status.SetCondition(hackathonv1.ExperimentVolumeRetained, hackathonv1.ExperimentConditionFalse, "ReclaimFailed", msg)
+		return result, true
+	}
+	return result, false
+}
+
+func (c *Controller) deleteEnvPods(ctx context.Context, expr *hackathonv1.Experiment) error {
+	podList := &corev1.PodList{}
+	err := c.Client.List(ctx, podList, client.InNamespace(expr.Namespace), client.MatchingLabels{LabelKeyExperimentName: expr.Name})
+	if err != nil {
+		return fmt.Errorf("list env pods failed: %s", err.Error())
+	}
+	for i := range podList.Items {
+		if err = client.IgnoreNotFound(c.Client.Delete(ctx, &podList.Items[i])); err != nil {
+			return fmt.Errorf("delete env pod failed: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *Controller) retentionPeriod(ctx context.Context, expr *hackathonv1.Experiment) time.Duration {
+	template := &hackathonv1.Template{}
+	if err := c.Client.Get(ctx, types.NamespacedName{Namespace: expr.Namespace, Name: expr.Spec.Template}, template); err != nil {
+		return DataVolumeRetention
+	}
+	if template.Data.DataVolume == nil || template.Data.DataVolume.RetentionPeriod == nil {
+		return DataVolumeRetention
+	}
+	return template.Data.DataVolume.RetentionPeriod.Duration
+}
+
+func cleanupJobName(experiment *hackathonv1.Experiment) string {
+	return fmt.Sprintf("cleanup-%s", experiment.Name)
+}
+
+func buildCleanupJob(experiment *hackathonv1.Experiment, node string) (*batchv1.Job, error) {
+	hostType := corev1.HostPathDirectoryOrCreate
+	volumes := []corev1.Volume{
+		{
+			Name: "host",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: DataVolumeHostPathDir, Type: &hostType},
+			},
+		},
+	}
+	mounts := []corev1.VolumeMount{{Name: "host", MountPath: hostPathMountPath}}
+	script := fmt.Sprintf("rm -rf %s/%s", hostPathMountPath, experiment.UID)
+
+	job, err := newVolumeJob(experiment, cleanupJobName(experiment), script, volumes, mounts)
+	if err != nil {
+		return nil, err
+	}
+	job.Spec.Template.Spec.NodeName = node
+	return job, nil
+}
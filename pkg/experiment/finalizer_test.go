@@ -0,0 +1,86 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/eventbus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"time"
+)
+
+var _ = Describe("experiment-finalizer", func() {
+	Context("retention", func() {
+		retention, warning := DataVolumeRetention, DataVolumeExpiryWarning
+		AfterEach(func() {
+			DataVolumeRetention, DataVolumeExpiryWarning = retention, warning
+		})
+
+		It("reports expiring shortly before data volume reclaimed", func() {
+			DataVolumeRetention, DataVolumeExpiryWarning = 72*time.Hour, 24*time.Hour
+			c := &Controller{Client: &actionClient{}, Logger: zap.New()}
+			status := newLifecycleStatus(hackathonv1.ExperimentRunning)
+			deleted := metav1.NewTime(time.Now().Add(-time.Hour))
+			status.Experiment.DeletionTimestamp = &deleted
+
+			_, done := c.Finalize(context.Background(), status)
+			Expect(done).To(BeFalse())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentVolumeRetained, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+			Expect(hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentVolumeExpiring)).To(BeNil())
+			Expect(status.LifecycleTopics()).To(BeEmpty())
+
+			deleted = metav1.NewTime(time.Now().Add(-60 * time.Hour))
+			_, done = c.Finalize(context.Background(), status)
+			Expect(done).To(BeFalse())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentVolumeExpiring)
+			Expect(cond.Status).To(Equal(hackathonv1.ExperimentConditionTrue))
+			Expect(cond.Message).To(ContainSubstring("data volume reclaimed at"))
+			Expect(status.LifecycleTopics()).To(ConsistOf(eventbus.Topic(eventbus.ExperimentExpiringTopic)))
+		})
+	})
+
+	It("builds cleanup job on volume node", func() {
+		expr := &hackathonv1.Experiment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-expr", Namespace: "default", UID: "uid-1"},
+			Spec:       hackathonv1.ExperimentSpec{ClusterName: "meta-cluster"},
+		}
+		job, err := buildCleanupJob(expr, "node-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Name).To(Equal("cleanup-test-expr"))
+		Expect(job.Namespace).To(Equal("default"))
+		Expect(job.Labels[LabelKeyVolumeJob]).To(Equal("test-expr"))
+		Expect(job.Labels).NotTo(HaveKey(LabelKeyExperimentName))
+		Expect(job.OwnerReferences).To(HaveLen(1))
+		Expect(job.OwnerReferences[0].Name).To(Equal("test-expr"))
+
+		spec := job.Spec.Template.Spec
+		Expect(spec.NodeName).To(Equal("node-a"))
+		Expect(spec.Volumes[0].HostPath.Path).To(Equal(DataVolumeHostPathDir))
+		Expect(spec.Containers[0].Command[2]).To(Equal("rm -rf /host/uid-1"))
+	})
+
+	It("reports job result from conditions", func() {
+		job := &batchv1.Job{}
+		succeeded, failed := jobFinished(job)
+		Expect(succeeded || failed).To(BeFalse())
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionFalse}}
+		succeeded, failed = jobFinished(job)
+		Expect(succeeded || failed).To(BeFalse())
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		succeeded, failed = jobFinished(job)
+		Expect(succeeded).To(BeTrue())
+		Expect(failed).To(BeFalse())
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		succeeded, failed = jobFinished(job)
+		Expect(succeeded).To(BeFalse())
+		Expect(failed).To(BeTrue())
+	})
+})
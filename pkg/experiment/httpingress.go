@@ -0,0 +1,204 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strings"
+)
+
+const (
+	annotationKeyIngressClass = "kubernetes.io/ingress.class"
+)
+
+// HTTPIngress routes http endpoints of experiment by hostname
+type HTTPIngress struct {
+	client        client.Client
+	status        *Status
+	resourceState *ResourceState
+	logger        logr.Logger
+}
+
+func (r *HTTPIngress) Reconcile(ctx context.Context) *results.Results {
+	var (
+		old     = r.resourceState.HTTPIngress
+		expr    = r.status.Experiment
+		cluster = r.resourceState.Cluster
+	)
+	result := results.NewResults(ctx)
+
+	endpoints := httpEndpoints(r.resourceState.Template)
+	if len(endpoints) > 0 && cluster.Spec.IngressDomain == "" {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation,
+			fmt.Sprintf("cluster %s ingress domain not configured, http endpoints are not routed", cluster.Name))
+	}
+	if len(endpoints) == 0 || cluster.Spec.IngressDomain == "" {
+		if old != nil {
+			r.status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, "delete http ingress")
+			return result.WithError(client.IgnoreNotFound(r.client.Delete(ctx, old)))
+		}
+		return result
+	}
+
+	if err := validateHostLabels(expr, endpoints); err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, err.Error())
+		return result
+	}
+	expected, err := buildExpectedHTTPIngress(expr, cluster, endpoints)
+	if err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, "create http ingress failed")
+		return result.WithError(err)
+	}
+	if err = r.checkHostConflict(ctx, expected); err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, err.Error())
+		return result
+	}
+
+	if old == nil {
+		if err = r.client.Create(ctx, expected); err != nil {
+			r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create http ingress failed: %s", err.Error()))
+			return result.WithError(err)
+		}
+		r.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, "create http ingress")
+		return result
+	}
+
+	if reflect.DeepEqual(old.Spec, expected.Spec) && reflect.DeepEqual(old.Annotations, expected.Annotations) {
+		return result
+	}
+	old.Annotations = expected.Annotations
+	old.Spec = expected.Spec
+	return result.WithError(r.client.Update(ctx, old))
+}
+
+// validateHostLabels requires experiment and endpoint names to be single dns labels,
+// so that a dotted name can never build the host of another experiment
+func validateHostLabels(expr *hackathonv1.Experiment, endpoints []hackathonv1.EndpointTemplate) error {
+	if errs := validation.IsDNS1123Label(expr.Name); len(errs) > 0 {
+		return fmt.Errorf("experiment name %s can not be used as http host: %s", expr.Name, strings.Join(errs, ", "))
+	}
+	for _, endpoint := range endpoints {
+		if errs := validation.IsDNS1123Label(endpoint.Name); len(errs) > 0 {
+			return fmt.Errorf("endpoint name %s can not be used as http host: %s", endpoint.Name, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// checkHostConflict refuses hosts already routed by ingresses of other experiments in the namespace
+func (r *HTTPIngress) checkHostConflict(ctx context.Context, expected *networkingv1beta1.Ingress) error {
+	ingressList := &networkingv1beta1.IngressList{}
+	if err := r.client.List(ctx, ingressList, client.InNamespace(expected.Namespace), client.HasLabels{LabelKeyExperimentName}); err != nil {
+		return fmt.Errorf("list http ingresses failed: %s", err.Error())
+	}
+	hosts := map[string]bool{}
+	for _, rule := range expected.Spec.Rules {
+		hosts[rule.Host] = true
+	}
+	for _, ingress := range ingressList.Items {
+		if ingress.Name == expected.Name {
+			continue
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if hosts[rule.Host] {
+				return fmt.Errorf("http host %s is already routed by ingress %s", rule.Host, ingress.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func buildExpectedHTTPIngress(expr *hackathonv1.Experiment, cluster *hackathonv1.CustomCluster, endpoints []hackathonv1.EndpointTemplate) (*networkingv1beta1.Ingress, error) {
+	ingress := &networkingv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      httpIngressName(expr.Name),
+			Namespace: expr.Namespace,
+			Labels: map[string]string{
+				LabelKeyClusterName:    expr.Spec.ClusterName,
+				LabelKeyExperimentName: expr.Name,
+			},
+		},
+	}
+	if cluster.Spec.IngressClass != "" {
+		ingress.Annotations = map[string]string{annotationKeyIngressClass: cluster.Spec.IngressClass}
+	}
+
+	hosts := make([]string, 0)
+	for i, endpoint := range endpoints {
+		host := endpointHost(expr, endpoint.Name, i == 0, cluster.Spec.IngressDomain)
+		hosts = append(hosts, host)
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1beta1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1beta1.IngressRuleValue{
+				HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+					Paths: []networkingv1beta1.HTTPIngressPath{
+						{
+							Path: "/",
+							Backend: networkingv1beta1.IngressBackend{
+								ServiceName: ingressServiceName(expr.Name, endpointServiceGroup(&endpoint)),
+								ServicePort: intstr.FromInt(int(endpoint.Port)),
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+	if cluster.Spec.IngressTLSSecret != "" {
+		ingress.Spec.TLS = []networkingv1beta1.IngressTLS{
+			{Hosts: hosts, SecretName: cluster.Spec.IngressTLSSecret},
+		}
+	}
+
+	if err := controllerutil.SetControllerReference(expr, ingress.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("set http ingress owner ref failed: %s", err.Error())
+	}
+	return ingress, nil
+}
+
+func httpEndpoints(template *hackathonv1.Template) []hackathonv1.EndpointTemplate {
+	endpoints := make([]hackathonv1.EndpointTemplate, 0)
+	for _, endpoint := range templateEndpoints(template) {
+		if endpoint.Protocol == hackathonv1.ExperimentIngressHTTP {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// endpointHost uses <expr>.<namespace>.<domain> for the first http endpoint,
+// other endpoints use <endpoint>.<expr>.<namespace>.<domain>, so hosts of different experiments never collide
+// as long as names are dns labels. The tls certificate must cover both levels of wildcard
+func endpointHost(expr *hackathonv1.Experiment, endpoint string, first bool, domain string) string {
+	if first {
+		return fmt.Sprintf("%s.%s.%s", expr.Name, expr.Namespace, domain)
+	}
+	return fmt.Sprintf("%s.%s.%s.%s", endpoint, expr.Name, expr.Namespace, domain)
+}
+
+func endpointURL(expr *hackathonv1.Experiment, cluster *hackathonv1.CustomCluster, endpoint string, first bool) string {
+	if cluster.Spec.IngressDomain == "" {
+		return ""
+	}
+	schema := "http"
+	if cluster.Spec.IngressTLSSecret != "" {
+		schema = "https"
+	}
+	return fmt.Sprintf("%s://%s/", schema, endpointHost(expr, endpoint, first, cluster.Spec.IngressDomain))
+}
+
+func httpIngressName(exprName string) string {
+	return fmt.Sprintf("ing-%s", exprName)
+}
@@ -0,0 +1,53 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newHostExperiment(name string) *hackathonv1.Experiment {
+	return &hackathonv1.Experiment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team"}}
+}
+
+var _ = Describe("experiment-http-ingress", func() {
+	It("never builds the same host for different experiments", func() {
+		Expect(endpointHost(newHostExperiment("a"), "web", false, "example.com")).To(Equal("web.a.team.example.com"))
+		Expect(endpointHost(newHostExperiment("a-web"), "app", true, "example.com")).To(Equal("a-web.team.example.com"))
+		Expect(endpointHost(newHostExperiment("a"), "app", true, "example.com")).NotTo(
+			Equal(endpointHost(newHostExperiment("a-web"), "app", true, "example.com")))
+	})
+
+	It("requires dns label names", func() {
+		endpoints := []hackathonv1.EndpointTemplate{{Name: "web", Protocol: hackathonv1.ExperimentIngressHTTP, Port: 80}}
+		Expect(validateHostLabels(newHostExperiment("a"), endpoints)).To(Succeed())
+		Expect(validateHostLabels(newHostExperiment("web.a"), endpoints)).NotTo(Succeed())
+
+		endpoints[0].Name = "web.app"
+		Expect(validateHostLabels(newHostExperiment("a"), endpoints)).NotTo(Succeed())
+	})
+
+	It("routes every http endpoint with tls", func() {
+		cluster := &hackathonv1.CustomCluster{Spec: hackathonv1.CustomClusterSpec{
+			IngressDomain:    "example.com",
+			IngressClass:     "nginx",
+			IngressTLSSecret: "wildcard",
+		}}
+		endpoints := []hackathonv1.EndpointTemplate{
+			{Name: "app", Protocol: hackathonv1.ExperimentIngressHTTP, Port: 8080},
+			{Name: "docs", Protocol: hackathonv1.ExperimentIngressHTTP, Port: 8000, Service: "web"},
+		}
+		ingress, err := buildExpectedHTTPIngress(newHostExperiment("a"), cluster, endpoints)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ingress.Name).To(Equal("ing-a"))
+		Expect(ingress.Annotations[annotationKeyIngressClass]).To(Equal("nginx"))
+		Expect(ingress.Spec.Rules).To(HaveLen(2))
+		Expect(ingress.Spec.Rules[0].Host).To(Equal("a.team.example.com"))
+		Expect(ingress.Spec.Rules[1].Host).To(Equal("docs.a.team.example.com"))
+		Expect(ingress.Spec.Rules[1].HTTP.Paths[0].Backend.ServiceName).To(Equal("svc-a-web"))
+		Expect(ingress.Spec.TLS[0].Hosts).To(Equal([]string{"a.team.example.com", "docs.a.team.example.com"}))
+
+		Expect(endpointURL(newHostExperiment("a"), cluster, "docs", false)).To(Equal("https://docs.a.team.example.com/"))
+	})
+})
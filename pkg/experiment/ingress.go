@@ -11,6 +11,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
+	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"strings"
@@ -25,13 +26,18 @@ type IngressService struct {
 
 func (r *IngressService) Reconcile(ctx context.Context) *results.Results {
 	var (
-		old     = r.resourceState.IngressSvc
 		expr    = r.status.Experiment
 		tmpl    = r.resourceState.Template
 		cluster = r.resourceState.Cluster
 	)
 	result := results.NewResults(ctx)
 
+	endpoints := templateEndpoints(tmpl)
+	if err := validateEndpoints(endpoints); err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, err.Error())
+		return result.WithError(err)
+	}
+
 	externalIps := make([]string, 0)
 	switch {
 	case len(cluster.Spec.PublishIps) > 0:
@@ -41,59 +47,98 @@ func (r *IngressService) Reconcile(ctx context.Context) *results.Results {
 		externalIps = cluster.Spec.PrivateIps
 	}
 
-	if old != nil {
-		old.Spec.Type = corev1.ServiceTypeNodePort
-		old.Spec.ExternalIPs = externalIps
-		for i := range old.Spec.Ports {
-			if old.Spec.Ports[i].Name == string(tmpl.Data.IngressProtocol) {
-				old.Spec.Ports[i].Protocol = corev1.ProtocolTCP
-				old.Spec.Ports[i].Port = tmpl.Data.IngressPort
-				old.Spec.Ports[i].TargetPort = intstr.FromInt(int(tmpl.Data.IngressPort))
+	expected, err := buildExpectedIngressServices(expr, endpoints, externalIps)
+	if err != nil {
+		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, "create ingress service failed")
+		return result.WithError(err)
+	}
+
+	reconciled := map[string]*corev1.Service{}
+	for i := range r.resourceState.IngressSvcs {
+		svc := &r.resourceState.IngressSvcs[i]
+		if _, ok := expected[svc.Name]; !ok {
+			r.status.AddEvent(corev1.EventTypeNormal, event.ReasonStateChange, fmt.Sprintf("delete ingress service %s", svc.Name))
+			result.WithError(client.IgnoreNotFound(r.client.Delete(ctx, svc)))
+			continue
+		}
+		reconciled[svc.Name] = svc
+	}
+
+	for name, service := range expected {
+		old, ok := reconciled[name]
+		if !ok {
+			r.status.AddEvent(corev1.EventTypeNormal, "DiscoverExternalIp", fmt.Sprintf("use external ip: %s", strings.Join(externalIps, ",")))
+			if err = r.client.Create(ctx, service); err != nil {
+				r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create ingress service failed: %s", err.Error()))
+				result.WithError(err)
+				continue
 			}
+			r.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("create ingress service %s", name))
+			continue
+		}
+
+		// keep allocated node ports
+		ports := make([]corev1.ServicePort, 0, len(service.Spec.Ports))
+		for _, port := range service.Spec.Ports {
+			for _, oldPort := range old.Spec.Ports {
+				if oldPort.Name == port.Name {
+					port.NodePort = oldPort.NodePort
+				}
+			}
+			ports = append(ports, port)
+		}
+		if old.Spec.Type == corev1.ServiceTypeNodePort &&
+			reflect.DeepEqual(old.Spec.ExternalIPs, service.Spec.ExternalIPs) &&
+			reflect.DeepEqual(old.Spec.Ports, ports) {
+			continue
 		}
-		return result.WithError(r.client.Update(ctx, old))
+		old.Spec.Type = corev1.ServiceTypeNodePort
+		old.Spec.ExternalIPs = service.Spec.ExternalIPs
+		old.Spec.Ports = ports
+		result.WithError(r.client.Update(ctx, old))
 	}
+	return result
+}
 
-	r.status.AddEvent(corev1.EventTypeNormal, "DiscoverExternalIp", fmt.Sprintf("use external ip: %s", strings.Join(externalIps, ",")))
+// buildExpectedIngressServices groups endpoints into node port services, keyed by service name
+func buildExpectedIngressServices(expr *hackathonv1.Experiment, endpoints []hackathonv1.EndpointTemplate, externalIps []string) (map[string]*corev1.Service, error) {
 	labels := map[string]string{
 		LabelKeyClusterName:    expr.Spec.ClusterName,
 		LabelKeyExperimentName: expr.Name,
 	}
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      ingressServiceName(expr.Name, tmpl.Data.IngressProtocol),
-			Namespace: expr.Namespace,
-			Labels:    labels,
-		},
-		Spec: corev1.ServiceSpec{
-			Type:        corev1.ServiceTypeNodePort,
-			ExternalIPs: externalIps,
-			Ports: []corev1.ServicePort{
-				{
-					Name:       string(tmpl.Data.IngressProtocol),
-					Protocol:   corev1.ProtocolTCP,
-					Port:       tmpl.Data.IngressPort,
-					TargetPort: intstr.FromInt(int(tmpl.Data.IngressPort)),
+	services := map[string]*corev1.Service{}
+	for _, endpoint := range endpoints {
+		name := ingressServiceName(expr.Name, endpointServiceGroup(&endpoint))
+		service, ok := services[name]
+		if !ok {
+			service = &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: expr.Namespace,
+					Labels:    labels,
 				},
-			},
-			Selector: labels,
-		},
-	}
-
-	err := controllerutil.SetControllerReference(expr, service.GetObjectMeta(), scheme.Scheme)
-	if err != nil {
-		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, "create ingress service failed")
-		return result.WithError(fmt.Errorf("set ingress service owner ref failed: %s", err.Error()))
-	}
-
-	if err = r.client.Create(ctx, service); err != nil {
-		r.status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create ingress service failed: %s", err.Error()))
-		return result.WithError(err)
+				Spec: corev1.ServiceSpec{
+					Type:        corev1.ServiceTypeNodePort,
+					ExternalIPs: externalIps,
+					Ports:       []corev1.ServicePort{},
+					Selector:    labels,
+				},
+			}
+			if err := controllerutil.SetControllerReference(expr, service.GetObjectMeta(), scheme.Scheme); err != nil {
+				return nil, fmt.Errorf("set ingress service owner ref failed: %s", err.Error())
+			}
+			services[name] = service
+		}
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       endpoint.Name,
+			Protocol:   corev1.ProtocolTCP,
+			Port:       endpoint.Port,
+			TargetPort: intstr.FromInt(int(endpoint.Port)),
+		})
 	}
-	r.status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, "create ingress service")
-	return result
+	return services, nil
 }
 
-func ingressServiceName(exprName string, protocol hackathonv1.ExperimentIngressProtocol) string {
-	return fmt.Sprintf("svc-%s-%s", exprName, protocol)
+func ingressServiceName(exprName string, group string) string {
+	return fmt.Sprintf("svc-%s-%s", exprName, group)
 }
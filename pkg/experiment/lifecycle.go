@@ -0,0 +1,134 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type lifecycleEvent string
+
+const (
+	// eventProvision is fired when env pod or its resources are being created
+	eventProvision lifecycleEvent = "Provision"
+	// eventPodReady is fired when all essential containers are ready
+	eventPodReady lifecycleEvent = "PodReady"
+	// eventPodUnready is fired when a running env pod becomes unready
+	eventPodUnready lifecycleEvent = "PodUnready"
+	// eventFail is fired when env pod can not start
+	eventFail lifecycleEvent = "Fail"
+	// eventPause is fired when experiment is paused
+	eventPause lifecycleEvent = "Pause"
+	// eventTerminate is fired when experiment is deleted
+	eventTerminate lifecycleEvent = "Terminate"
+)
+
+// lifecycleTransitions lists allowed transitions, events not listed for a state are ignored
+var lifecycleTransitions = map[hackathonv1.ExperimentEnvStatus]map[lifecycleEvent]hackathonv1.ExperimentEnvStatus{
+	hackathonv1.ExperimentCreated: {
+		eventProvision: hackathonv1.ExperimentProvisioning,
+		eventPodReady:  hackathonv1.ExperimentRunning,
+		eventFail:      hackathonv1.ExperimentError,
+		eventPause:     hackathonv1.ExperimentPaused,
+		eventTerminate: hackathonv1.ExperimentTerminating,
+	},
+	hackathonv1.ExperimentProvisioning: {
+		eventPodReady:  hackathonv1.ExperimentRunning,
+		eventFail:      hackathonv1.ExperimentError,
+		eventPause:     hackathonv1.ExperimentPaused,
+		eventTerminate: hackathonv1.ExperimentTerminating,
+	},
+	hackathonv1.ExperimentRunning: {
+		eventProvision:  hackathonv1.ExperimentProvisioning,
+		eventPodUnready: hackathonv1.ExperimentError,
+		eventFail:       hackathonv1.ExperimentError,
+		eventPause:      hackathonv1.ExperimentPaused,
+		eventTerminate:  hackathonv1.ExperimentTerminating,
+	},
+	hackathonv1.ExperimentPaused: {
+		eventProvision: hackathonv1.ExperimentProvisioning,
+		eventPodReady:  hackathonv1.ExperimentRunning,
+		eventTerminate: hackathonv1.ExperimentTerminating,
+	},
+	hackathonv1.ExperimentError: {
+		eventProvision: hackathonv1.ExperimentProvisioning,
+		eventPodReady:  hackathonv1.ExperimentRunning,
+		eventPause:     hackathonv1.ExperimentPaused,
+		eventTerminate: hackathonv1.ExperimentTerminating,
+	},
+	hackathonv1.ExperimentTerminating: {},
+}
+
+// nextLifecycleState returns the state after event, ok is false if the event is not allowed in current state.
+// The legacy stopped state moves to paused if it stays paused, so that it is written back as paused
+func nextLifecycleState(current hackathonv1.ExperimentEnvStatus, evt lifecycleEvent) (hackathonv1.ExperimentEnvStatus, bool) {
+	switch current {
+	case "":
+		current = hackathonv1.ExperimentCreated
+	case hackathonv1.ExperimentStopped:
+		if evt == eventPause {
+			return hackathonv1.ExperimentPaused, true
+		}
+		current = hackathonv1.ExperimentPaused
+	}
+	next, ok := lifecycleTransitions[current][evt]
+	if !ok {
+		return current, false
+	}
+	return next, true
+}
+
+// Transit moves experiment to the next state of event, it reports whether the state changed.
+// Conditions which are meaningless in the new state are reset, so that they never go stale
+func (s *Status) Transit(evt lifecycleEvent, reason string) bool {
+	next, ok := nextLifecycleState(s.Status.Status, evt)
+	if !ok || next == s.Status.Status {
+		return false
+	}
+
+	previous := s.Status.Status
+	s.Status.Status = next
+	eventType := corev1.EventTypeNormal
+	if next == hackathonv1.ExperimentError {
+		eventType = corev1.EventTypeWarning
+	}
+	msg := fmt.Sprintf("experiment state changed from %s to %s", previous, next)
+	if reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, reason)
+	}
+	s.AddEvent(eventType, event.ReasonStateChange, msg)
+
+	switch next {
+	case hackathonv1.ExperimentRunning:
+		s.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionTrue, "PodReady", "")
+	case hackathonv1.ExperimentPaused:
+		s.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PauseExperiment", "")
+		s.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "PauseExperiment", "")
+		s.SetCondition(hackathonv1.ExperimentOutOfResource, hackathonv1.ExperimentConditionFalse, "PauseExperiment", "")
+	case hackathonv1.ExperimentTerminating:
+		s.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "Terminating", "")
+		s.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "Terminating", "")
+	default:
+		s.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, reasonOf(next), reason)
+		s.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "PodNotReady", "")
+	}
+	return true
+}
+
+func reasonOf(state hackathonv1.ExperimentEnvStatus) string {
+	if state == hackathonv1.ExperimentError {
+		return "PodFailed"
+	}
+	return "PodNotReady"
+}
+
+// Available reports whether experiment reached the state requested by spec,
+// that is running with endpoints ready, or paused if paused by spec
+func Available(expr *hackathonv1.Experiment) bool {
+	if expr.Spec.Pause {
+		return expr.Status.Status == hackathonv1.ExperimentPaused || expr.Status.Status == hackathonv1.ExperimentStopped
+	}
+	return expr.Status.Status == hackathonv1.ExperimentRunning &&
+		hackathonv1.CheckExperimentCondition(expr.Status.Conditions, hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue)
+}
@@ -0,0 +1,275 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+var allLifecycleEvents = []lifecycleEvent{
+	eventProvision, eventPodReady, eventPodUnready, eventFail, eventPause, eventTerminate,
+}
+
+func newLifecycleStatus(state hackathonv1.ExperimentEnvStatus) *Status {
+	return NewStatus(&hackathonv1.Experiment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-expr", Namespace: "default"},
+		Status:     hackathonv1.ExperimentStatus{Status: state},
+	})
+}
+
+var _ = Describe("experiment-lifecycle", func() {
+	Context("transitions", func() {
+		edges := []struct {
+			from hackathonv1.ExperimentEnvStatus
+			evt  lifecycleEvent
+			to   hackathonv1.ExperimentEnvStatus
+		}{
+			{hackathonv1.ExperimentCreated, eventProvision, hackathonv1.ExperimentProvisioning},
+			{hackathonv1.ExperimentCreated, eventPodReady, hackathonv1.ExperimentRunning},
+			{hackathonv1.ExperimentCreated, eventFail, hackathonv1.ExperimentError},
+			{hackathonv1.ExperimentCreated, eventPause, hackathonv1.ExperimentPaused},
+			{hackathonv1.ExperimentCreated, eventTerminate, hackathonv1.ExperimentTerminating},
+			{hackathonv1.ExperimentProvisioning, eventPodReady, hackathonv1.ExperimentRunning},
+			{hackathonv1.ExperimentProvisioning, eventFail, hackathonv1.ExperimentError},
+			{hackathonv1.ExperimentProvisioning, eventPause, hackathonv1.ExperimentPaused},
+			{hackathonv1.ExperimentProvisioning, eventTerminate, hackathonv1.ExperimentTerminating},
+			{hackathonv1.ExperimentRunning, eventProvision, hackathonv1.ExperimentProvisioning},
+			{hackathonv1.ExperimentRunning, eventPodUnready, hackathonv1.ExperimentError},
+			{hackathonv1.ExperimentRunning, eventFail, hackathonv1.ExperimentError},
+			{hackathonv1.ExperimentRunning, eventPause, hackathonv1.ExperimentPaused},
+			{hackathonv1.ExperimentRunning, eventTerminate, hackathonv1.ExperimentTerminating},
+			{hackathonv1.ExperimentPaused, eventProvision, hackathonv1.ExperimentProvisioning},
+			{hackathonv1.ExperimentPaused, eventPodReady, hackathonv1.ExperimentRunning},
+			{hackathonv1.ExperimentPaused, eventTerminate, hackathonv1.ExperimentTerminating},
+			{hackathonv1.ExperimentError, eventProvision, hackathonv1.ExperimentProvisioning},
+			{hackathonv1.ExperimentError, eventPodReady, hackathonv1.ExperimentRunning},
+			{hackathonv1.ExperimentError, eventPause, hackathonv1.ExperimentPaused},
+			{hackathonv1.ExperimentError, eventTerminate, hackathonv1.ExperimentTerminating},
+		}
+
+		It("covers every edge of transition table", func() {
+			count := 0
+			for _, events := range lifecycleTransitions {
+				count += len(events)
+			}
+			Expect(edges).To(HaveLen(count))
+		})
+
+		for _, edge := range edges {
+			edge := edge
+			It(fmt.Sprintf("moves from %s to %s on %s", edge.from, edge.to, edge.evt), func() {
+				next, ok := nextLifecycleState(edge.from, edge.evt)
+				Expect(ok).To(BeTrue())
+				Expect(next).To(Equal(edge.to))
+
+				status := newLifecycleStatus(edge.from)
+				Expect(status.Transit(edge.evt, "")).To(BeTrue())
+				Expect(status.Status.Status).To(Equal(edge.to))
+				Expect(status.Events).To(HaveLen(1))
+				Expect(status.Events[0].Reason).To(Equal(event.ReasonStateChange))
+			})
+		}
+
+		for state, events := range lifecycleTransitions {
+			state, events := state, events
+			for _, evt := range allLifecycleEvents {
+				evt := evt
+				if _, ok := events[evt]; ok {
+					continue
+				}
+				It(fmt.Sprintf("ignores %s in %s", evt, state), func() {
+					_, ok := nextLifecycleState(state, evt)
+					Expect(ok).To(BeFalse())
+
+					status := newLifecycleStatus(state)
+					Expect(status.Transit(evt, "")).To(BeFalse())
+					Expect(status.Status.Status).To(Equal(state))
+					Expect(status.Events).To(BeEmpty())
+				})
+			}
+		}
+
+		It("treats empty state as created", func() {
+			next, ok := nextLifecycleState("", eventProvision)
+			Expect(ok).To(BeTrue())
+			Expect(next).To(Equal(hackathonv1.ExperimentProvisioning))
+		})
+
+		It("treats legacy stopped state as paused", func() {
+			next, ok := nextLifecycleState(hackathonv1.ExperimentStopped, eventPodUnready)
+			Expect(ok).To(BeFalse())
+			Expect(next).To(Equal(hackathonv1.ExperimentPaused))
+
+			status := newLifecycleStatus(hackathonv1.ExperimentStopped)
+			Expect(status.Transit(eventProvision, "")).To(BeTrue())
+			Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentProvisioning))
+		})
+
+		It("writes legacy stopped state back as paused", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentStopped)
+			Expect(status.Transit(eventPause, "")).To(BeTrue())
+			Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentPaused))
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse)).To(BeTrue())
+
+			Expect(status.Transit(eventPause, "")).To(BeFalse())
+		})
+	})
+
+	Context("conditions", func() {
+		It("resets ready conditions when paused", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentRunning)
+			status.SetCondition(hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionTrue, "PodReady", "")
+			status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue, "EndpointsReady", "")
+
+			Expect(status.Transit(eventPause, "")).To(BeTrue())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse)).To(BeTrue())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse)).To(BeTrue())
+		})
+
+		It("reports running experiment available once endpoints ready", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentRunning)
+			status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionFalse, "ProbeFailed", "")
+			_, expr := status.Apply()
+			Expect(Available(expr)).To(BeFalse())
+
+			status.SetCondition(hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue, "EndpointsReady", "")
+			_, expr = status.Apply()
+			Expect(Available(expr)).To(BeTrue())
+
+			expr.Spec.Pause = true
+			Expect(Available(expr)).To(BeFalse())
+		})
+
+		It("records warning when failed", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentProvisioning)
+			Expect(status.Transit(eventFail, "container experiment CrashLoopBackOff")).To(BeTrue())
+			Expect(status.Events[0].EventType).To(Equal(corev1.EventTypeWarning))
+			Expect(status.Events[0].Message).To(ContainSubstring("CrashLoopBackOff"))
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentPodReady)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal("PodFailed"))
+		})
+
+		It("keeps transition time when condition status not changed", func() {
+			past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+			conditions := []hackathonv1.ExperimentCondition{{
+				Type:               hackathonv1.ExperimentPodReady,
+				Status:             hackathonv1.ExperimentConditionFalse,
+				Reason:             "PodNotReady",
+				LastProbeTime:      past,
+				LastTransitionTime: past,
+			}}
+
+			conditions = hackathonv1.UpdateExperimentConditions(conditions, hackathonv1.NewExperimentCondition(
+				hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionFalse, "PodFailed", ""))
+			Expect(conditions).To(HaveLen(1))
+			Expect(conditions[0].Reason).To(Equal("PodFailed"))
+			Expect(conditions[0].LastTransitionTime).To(Equal(past))
+			Expect(conditions[0].LastProbeTime.After(past.Time)).To(BeTrue())
+
+			conditions = hackathonv1.UpdateExperimentConditions(conditions, hackathonv1.NewExperimentCondition(
+				hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionTrue, "PodReady", ""))
+			Expect(conditions[0].LastTransitionTime.After(past.Time)).To(BeTrue())
+		})
+	})
+
+	Context("pod failure", func() {
+		It("detects failed pod and crashing containers", func() {
+			pod := &corev1.Pod{}
+			Expect(diagnosePod(pod, nil).Fatal).To(BeFalse())
+
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "experiment",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+			}}
+			Expect(diagnosePod(pod, nil).Fatal).To(BeFalse())
+
+			pod.Status.ContainerStatuses[0].State.Waiting.Reason = "ErrImagePull"
+			diagnosis := diagnosePod(pod, nil)
+			Expect(diagnosis.Reason).To(Equal(diagnoseImagePullFailed))
+			Expect(diagnosis.Fatal).To(BeFalse())
+
+			pod.Status.ContainerStatuses[0].State.Waiting.Reason = "ImagePullBackOff"
+			diagnosis = diagnosePod(pod, nil)
+			Expect(diagnosis.Fatal).To(BeTrue())
+			Expect(diagnosis.Message).To(ContainSubstring("ImagePullBackOff"))
+
+			pod = &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}}
+			diagnosis = diagnosePod(pod, nil)
+			Expect(diagnosis.Fatal).To(BeTrue())
+			Expect(diagnosis.Message).To(ContainSubstring("Evicted"))
+		})
+
+		It("maps pod conditions and events to reasons", func() {
+			pod := &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{{
+					Type:    corev1.PodScheduled,
+					Status:  corev1.ConditionFalse,
+					Reason:  corev1.PodReasonUnschedulable,
+					Message: "0/1 nodes are available: 1 Insufficient memory.",
+				}},
+			}}
+			diagnosis := diagnosePod(pod, nil)
+			Expect(diagnosis.Reason).To(Equal(diagnoseUnschedulable))
+			Expect(diagnosis.Fatal).To(BeFalse())
+
+			pod.Status.Conditions = nil
+			now := time.Now()
+			events := []corev1.Event{
+				{Type: corev1.EventTypeWarning, Reason: "FailedScheduling", LastTimestamp: metav1.NewTime(now.Add(-time.Minute))},
+				{Type: corev1.EventTypeWarning, Reason: "FailedMount", Message: "secret not found", LastTimestamp: metav1.NewTime(now)},
+				{Type: corev1.EventTypeNormal, Reason: "Scheduled", LastTimestamp: metav1.NewTime(now.Add(time.Minute))},
+			}
+			diagnosis = diagnosePod(pod, events)
+			Expect(diagnosis.Reason).To(Equal(diagnoseVolumeMountFailed))
+			Expect(diagnosis.Message).To(ContainSubstring("secret not found"))
+
+			Expect(diagnosePod(pod, nil).Reason).To(Equal(diagnosePodNotReady))
+		})
+
+		It("reports last termination of crashing container", func() {
+			pod := &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:                 "experiment",
+					State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+				}},
+			}}
+			diagnosis := diagnosePod(pod, nil)
+			Expect(diagnosis.Reason).To(Equal(diagnoseCrashLoop))
+			Expect(diagnosis.Fatal).To(BeTrue())
+			Expect(diagnosis.Message).To(ContainSubstring("last exit code 1 Error"))
+		})
+
+		It("reports out of memory containers as their own reason", func() {
+			pod := &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "experiment",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: podReasonOOMKilled}},
+				}},
+			}}
+			diagnosis := diagnosePod(pod, nil)
+			Expect(diagnosis.Reason).To(Equal(diagnoseOOMKilled))
+			Expect(diagnosis.Fatal).To(BeFalse())
+
+			pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+			pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: podReasonOOMKilled}}
+			diagnosis = diagnosePod(pod, nil)
+			Expect(diagnosis.Reason).To(Equal(diagnoseOOMKilled))
+			Expect(diagnosis.Fatal).To(BeTrue())
+			Expect(diagnosis.Message).To(ContainSubstring("OOMKilled"))
+		})
+	})
+})
@@ -0,0 +1,28 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/eventbus"
+)
+
+// LifecycleTopics returns the eventbus topics of lifecycle changes from the observed status,
+// it must be called before Apply overwrites the observed status
+func (s *Status) LifecycleTopics() []eventbus.Topic {
+	pre, crt := &s.Experiment.Status, s.Status
+	topics := make([]eventbus.Topic, 0)
+	if conditionBecameTrue(pre.Conditions, crt.Conditions, hackathonv1.ExperimentReady) {
+		topics = append(topics, eventbus.ExperimentReadyTopic)
+	}
+	if pre.Status != hackathonv1.ExperimentError && crt.Status == hackathonv1.ExperimentError {
+		topics = append(topics, eventbus.ExperimentErrorTopic)
+	}
+	if conditionBecameTrue(pre.Conditions, crt.Conditions, hackathonv1.ExperimentVolumeExpiring) {
+		topics = append(topics, eventbus.ExperimentExpiringTopic)
+	}
+	return topics
+}
+
+func conditionBecameTrue(pre, crt []hackathonv1.ExperimentCondition, conditionType hackathonv1.ExperimentConditionType) bool {
+	return !hackathonv1.CheckExperimentCondition(pre, conditionType, hackathonv1.ExperimentConditionTrue) &&
+		hackathonv1.CheckExperimentCondition(crt, conditionType, hackathonv1.ExperimentConditionTrue)
+}
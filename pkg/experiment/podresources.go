@@ -0,0 +1,80 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// effectiveResources merges container resources in order of namespace LimitRange defaults,
+// template and experiment overrides, the result is clamped by the tightest min and max of all LimitRanges
+func effectiveResources(experiment *hackathonv1.Experiment, template *hackathonv1.Template, limitRanges []corev1.LimitRange) (corev1.ResourceRequirements, []string) {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+		Limits:   corev1.ResourceList{},
+	}
+	warnings := make([]string, 0)
+
+	min, max := corev1.ResourceList{}, corev1.ResourceList{}
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			mergeResourceList(resources.Requests, item.DefaultRequest)
+			mergeResourceList(resources.Limits, item.Default)
+			tightenResourceList(min, item.Min, 1)
+			tightenResourceList(max, item.Max, -1)
+		}
+	}
+
+	if podCfg := template.Data.PodTemplate; podCfg != nil && podCfg.Resources != nil {
+		mergeResourceList(resources.Requests, podCfg.Resources.Requests)
+		mergeResourceList(resources.Limits, podCfg.Resources.Limits)
+	}
+	if experiment.Spec.Resources != nil {
+		mergeResourceList(resources.Requests, experiment.Spec.Resources.Requests)
+		mergeResourceList(resources.Limits, experiment.Spec.Resources.Limits)
+	}
+
+	for _, list := range []corev1.ResourceList{resources.Requests, resources.Limits} {
+		for name, quantity := range list {
+			if bound, ok := max[name]; ok && quantity.Cmp(bound) > 0 {
+				warnings = append(warnings, fmt.Sprintf("%s %s exceeds namespace max %s", name, quantity.String(), bound.String()))
+				list[name] = bound.DeepCopy()
+			}
+			if bound, ok := min[name]; ok && quantity.Cmp(bound) < 0 {
+				warnings = append(warnings, fmt.Sprintf("%s %s is below namespace min %s", name, quantity.String(), bound.String()))
+				list[name] = bound.DeepCopy()
+			}
+		}
+	}
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			resources.Requests[name] = limit.DeepCopy()
+		}
+	}
+
+	if len(resources.Requests) == 0 {
+		resources.Requests = nil
+	}
+	if len(resources.Limits) == 0 {
+		resources.Limits = nil
+	}
+	return resources, warnings
+}
+
+func mergeResourceList(dst, src corev1.ResourceList) {
+	for name, quantity := range src {
+		dst[name] = quantity.DeepCopy()
+	}
+}
+
+// tightenResourceList keeps the larger quantity in dst if sign is 1, or the smaller one if sign is -1
+func tightenResourceList(dst, src corev1.ResourceList, sign int) {
+	for name, quantity := range src {
+		if current, ok := dst[name]; !ok || quantity.Cmp(current) == sign {
+			dst[name] = quantity.DeepCopy()
+		}
+	}
+}
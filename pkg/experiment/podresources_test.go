@@ -0,0 +1,121 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func newLimitRange(item corev1.LimitRangeItem) corev1.LimitRange {
+	item.Type = corev1.LimitTypeContainer
+	return corev1.LimitRange{Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{item}}}
+}
+
+var _ = Describe("experiment-pod-resources", func() {
+	Context("effective resources", func() {
+		It("merges defaults, template and experiment in order", func() {
+			limitRanges := []corev1.LimitRange{newLimitRange(corev1.LimitRangeItem{
+				DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+				Default:        corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			})}
+			tmpl := &hackathonv1.Template{Data: hackathonv1.TemplateData{PodTemplate: &hackathonv1.PodTemplate{
+				Resources: &corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}},
+			}}}
+			expr := newVolumeExperiment(nil)
+			expr.Spec.Resources = &corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}}
+
+			resources, warnings := effectiveResources(expr, tmpl, limitRanges)
+			Expect(warnings).To(BeEmpty())
+			Expect(resources.Requests.Cpu().String()).To(Equal("100m"))
+			Expect(resources.Requests.Memory().String()).To(Equal("256Mi"))
+			Expect(resources.Limits.Cpu().String()).To(Equal("2"))
+		})
+
+		It("clamps by the tightest bounds of all limit ranges", func() {
+			limitRanges := []corev1.LimitRange{
+				newLimitRange(corev1.LimitRangeItem{
+					Min: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+					Max: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				}),
+				newLimitRange(corev1.LimitRangeItem{
+					Min: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+					Max: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+				}),
+			}
+			expr := newVolumeExperiment(nil)
+			expr.Spec.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+			}
+
+			resources, warnings := effectiveResources(expr, &hackathonv1.Template{}, limitRanges)
+			Expect(warnings).To(HaveLen(3))
+			Expect(resources.Requests.Cpu().String()).To(Equal("200m"))
+			Expect(resources.Limits.Cpu().String()).To(Equal("1"))
+			Expect(resources.Limits.Memory().String()).To(Equal("1Gi"))
+		})
+
+		It("keeps request below limit", func() {
+			expr := newVolumeExperiment(nil)
+			expr.Spec.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			}
+			resources, _ := effectiveResources(expr, &hackathonv1.Template{}, nil)
+			Expect(resources.Requests.Memory().String()).To(Equal("1Gi"))
+
+			resources, _ = effectiveResources(newVolumeExperiment(nil), &hackathonv1.Template{}, nil)
+			Expect(resources.Requests).To(BeNil())
+			Expect(resources.Limits).To(BeNil())
+		})
+	})
+
+	Context("out of resource", func() {
+		It("keeps OOM until container recovered", func() {
+			c := &Controller{}
+			status := newLifecycleStatus(hackathonv1.ExperimentRunning)
+			pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "experiment",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: podReasonOOMKilled, ExitCode: 137}},
+			}}}}
+			deleted, err := c.reconcileOutOfResource(context.Background(), status, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeFalse())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentOutOfResource, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+
+			pod.Status.ContainerStatuses[0].LastTerminationState = pod.Status.ContainerStatuses[0].State
+			pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+			_, err = c.reconcileOutOfResource(context.Background(), status, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentOutOfResource, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+
+			pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+			pod.Status.ContainerStatuses[0].Ready = true
+			_, err = c.reconcileOutOfResource(context.Background(), status, pod)
+			Expect(err).NotTo(HaveOccurred())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentOutOfResource)
+			Expect(cond.Status).To(Equal(hackathonv1.ExperimentConditionFalse))
+			Expect(cond.Reason).To(Equal(podReasonResourceSufficient))
+		})
+
+		It("checks init containers", func() {
+			c := &Controller{}
+			status := newLifecycleStatus(hackathonv1.ExperimentProvisioning)
+			pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending, InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "data-init",
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: podReasonOOMKilled, ExitCode: 137}},
+			}}}}
+			_, err := c.reconcileOutOfResource(context.Background(), status, pod)
+			Expect(err).NotTo(HaveOccurred())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentOutOfResource)
+			Expect(cond.Status).To(Equal(hackathonv1.ExperimentConditionTrue))
+			Expect(cond.Message).To(ContainSubstring("data-init"))
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	podReasonEvicted   = "Evicted"
+	podReasonOOMKilled = "OOMKilled"
+
+	podReasonResourceSufficient = "ResourceSufficient"
+)
+
+// reconcileOutOfResource records OOMKilled and evicted env pod in OutOfResource condition,
+// evicted pods are never restarted by kubelet so they are deleted to be recreated
+func (c *Controller) reconcileOutOfResource(ctx context.Context, status *Status, pod *corev1.Pod) (bool, error) {
+	if pod.Status.Phase == corev1.PodFailed && pod.Status.Reason == podReasonEvicted {
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonUnhealthy, fmt.Sprintf("env pod evicted: %s", pod.Status.Message))
+		status.SetCondition(hackathonv1.ExperimentOutOfResource, hackathonv1.ExperimentConditionTrue, podReasonEvicted, pod.Status.Message)
+		if err := client.IgnoreNotFound(c.Client.Delete(ctx, pod)); err != nil {
+			return false, fmt.Errorf("delete evicted env pod failed: %s", err.Error())
+		}
+		return true, nil
+	}
+
+	// a crash looping container waits with the OOM in last termination state, it is only cleared once ready
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if containerOOMKilled(&cs) {
+			status.SetCondition(hackathonv1.ExperimentOutOfResource, hackathonv1.ExperimentConditionTrue, podReasonOOMKilled,
+				fmt.Sprintf("container %s killed for exceeding memory limit", cs.Name))
+			return false, nil
+		}
+	}
+
+	if hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentOutOfResource) != nil {
+		status.SetCondition(hackathonv1.ExperimentOutOfResource, hackathonv1.ExperimentConditionFalse, podReasonResourceSufficient,
+			"containers are running within resource limits")
+	}
+	return false, nil
+}
+
+// containerOOMKilled tells whether container is killed for memory now or was killed last time and not ready since
+func containerOOMKilled(cs *corev1.ContainerStatus) bool {
+	if terminated := cs.State.Terminated; terminated != nil && terminated.Reason == podReasonOOMKilled {
+		return true
+	}
+	last := cs.LastTerminationState.Terminated
+	return !cs.Ready && last != nil && last.Reason == podReasonOOMKilled
+}
@@ -0,0 +1,114 @@
+package experiment
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	endpointProbeInterval = 10 * time.Second
+)
+
+// endpointProber checks the service behind an endpoint speaks its protocol
+type endpointProber func(ctx context.Context, addr string) error
+
+var endpointProbers = map[hackathonv1.ExperimentIngressProtocol]endpointProber{
+	hackathonv1.ExperimentIngressVNC:  probeBanner("RFB "),
+	hackathonv1.ExperimentIngressSSH:  probeBanner("SSH-"),
+	hackathonv1.ExperimentIngressHTTP: probeHTTP,
+}
+
+// probeEndpoints probes endpoints through cluster ip of ingress services, endpoints of unknown
+// protocols are treated as ready. Endpoints are probed concurrently, so that a reconcile waits
+// at most EndpointProbeTimeout however many endpoints time out
+func probeEndpoints(ctx context.Context, rs *ResourceState, exprName string) error {
+	services := map[string]*corev1.Service{}
+	for i := range rs.IngressSvcs {
+		services[rs.IngressSvcs[i].Name] = &rs.IngressSvcs[i]
+	}
+	endpoints := templateEndpoints(rs.Template)
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		prober, ok := endpointProbers[endpoint.Protocol]
+		if !ok {
+			continue
+		}
+		svc, ok := services[ingressServiceName(exprName, endpointServiceGroup(endpoint))]
+		if !ok || svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone {
+			return fmt.Errorf("service of endpoint %s not ready", endpoint.Name)
+		}
+		addr := net.JoinHostPort(svc.Spec.ClusterIP, strconv.Itoa(int(endpoint.Port)))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, EndpointProbeTimeout)
+			defer cancel()
+			if err := prober(probeCtx, addr); err != nil {
+				errs[i] = fmt.Errorf("probe endpoint %s failed: %s", endpoints[i].Name, err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeBanner expects the server to greet with prefix, such as rfb version or ssh identification
+func probeBanner(prefix string) endpointProber {
+	return func(ctx context.Context, addr string) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		banner, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read banner failed: %s", err.Error())
+		}
+		if !strings.HasPrefix(banner, prefix) {
+			return fmt.Errorf("unexpected banner %q", strings.TrimSpace(banner))
+		}
+		return nil
+	}
+}
+
+// probeHTTP treats any response below 500 as ready, web apps often redirect or require login
+func probeHTTP(ctx context.Context, addr string) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/", addr), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serveBanner accepts connections and greets every client with banner
+func serveBanner(banner string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte(banner))
+			_ = conn.Close()
+		}
+	}()
+	return listener
+}
+
+func probeContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Second)
+}
+
+var _ = Describe("experiment-probe", func() {
+	Context("banner", func() {
+		It("accepts server greeting with prefix", func() {
+			listener := serveBanner("SSH-2.0-OpenSSH_8.2\r\n")
+			defer listener.Close()
+			ctx, cancel := probeContext()
+			defer cancel()
+			Expect(probeBanner("SSH-")(ctx, listener.Addr().String())).To(Succeed())
+		})
+
+		It("rejects unexpected greeting", func() {
+			listener := serveBanner("HTTP/1.1 400 Bad Request\r\n")
+			defer listener.Close()
+			ctx, cancel := probeContext()
+			defer cancel()
+			Expect(probeBanner("RFB ")(ctx, listener.Addr().String())).To(MatchError(ContainSubstring("unexpected banner")))
+		})
+
+		It("fails when server closes without greeting", func() {
+			listener := serveBanner("")
+			defer listener.Close()
+			ctx, cancel := probeContext()
+			defer cancel()
+			Expect(probeBanner("RFB ")(ctx, listener.Addr().String())).To(MatchError(ContainSubstring("read banner failed")))
+		})
+
+		It("gives up when server stays silent until deadline", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			Expect(probeBanner("RFB ")(ctx, listener.Addr().String())).To(HaveOccurred())
+		})
+	})
+
+	Context("http", func() {
+		It("treats responses below 500 as ready", func() {
+			status := http.StatusFound
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if status == http.StatusFound {
+					http.Redirect(w, r, "/login", status)
+					return
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+			addr := strings.TrimPrefix(server.URL, "http://")
+			ctx, cancel := probeContext()
+			defer cancel()
+
+			Expect(probeHTTP(ctx, addr)).To(Succeed())
+			status = http.StatusUnauthorized
+			Expect(probeHTTP(ctx, addr)).To(Succeed())
+			status = http.StatusBadGateway
+			Expect(probeHTTP(ctx, addr)).To(MatchError("http status 502"))
+		})
+	})
+
+	Context("endpoints", func() {
+		It("probes endpoints through ingress service cluster ip", func() {
+			listener := serveBanner("RFB 003.008\n")
+			defer listener.Close()
+			_, port, err := net.SplitHostPort(listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			portNum, err := strconv.Atoi(port)
+			Expect(err).NotTo(HaveOccurred())
+
+			endpoint := hackathonv1.EndpointTemplate{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Port: int32(portNum)}
+			rs := &ResourceState{Template: &hackathonv1.Template{Data: hackathonv1.TemplateData{
+				Endpoints: []hackathonv1.EndpointTemplate{endpoint, {Name: "rdp", Protocol: "rdp", Port: 3389}},
+			}}}
+			Expect(probeEndpoints(context.Background(), rs, "test-expr")).To(MatchError(ContainSubstring("service of endpoint vnc not ready")))
+
+			rs.IngressSvcs = []corev1.Service{{
+				ObjectMeta: metav1.ObjectMeta{Name: ingressServiceName("test-expr", endpointServiceGroup(&endpoint))},
+				Spec:       corev1.ServiceSpec{ClusterIP: "127.0.0.1"},
+			}}
+			Expect(probeEndpoints(context.Background(), rs, "test-expr")).To(Succeed())
+
+			rs.Template.Data.Endpoints[0].Protocol = hackathonv1.ExperimentIngressSSH
+			Expect(probeEndpoints(context.Background(), rs, "test-expr")).To(MatchError(ContainSubstring("probe endpoint vnc failed")))
+		})
+
+		It("reports experiment running only after endpoints answer", func() {
+			listener := serveBanner("RFB 003.008\n")
+			defer listener.Close()
+			endpoint := hackathonv1.EndpointTemplate{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC,
+				Port: int32(listener.Addr().(*net.TCPAddr).Port)}
+			rs := &ResourceState{Template: &hackathonv1.Template{Data: hackathonv1.TemplateData{
+				PodTemplate: &hackathonv1.PodTemplate{Image: "ubuntu"},
+				Endpoints:   []hackathonv1.EndpointTemplate{endpoint},
+			}}}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-expr", CreationTimestamp: metav1.Now()},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{
+					{Name: mainContainerName, Ready: true},
+				}},
+			}
+			rs.EnvPod = []corev1.Pod{pod}
+			status := newLifecycleStatus(hackathonv1.ExperimentProvisioning)
+			c := &Controller{Client: &actionClient{}, Logger: zap.New()}
+
+			result, err := c.reconcileExperimentPods(context.Background(), status, rs).Aggregate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(endpointProbeInterval))
+			Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentProvisioning))
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentPodReady, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentReady)
+			Expect(cond.Reason).To(Equal("ProbeFailed"))
+
+			rs.IngressSvcs = []corev1.Service{{
+				ObjectMeta: metav1.ObjectMeta{Name: ingressServiceName("test-expr", endpointServiceGroup(&endpoint))},
+				Spec:       corev1.ServiceSpec{ClusterIP: "127.0.0.1"},
+			}}
+			result, err = c.reconcileExperimentPods(context.Background(), status, rs).Aggregate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentRunning))
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+			// running experiments keep being probed
+			Expect(result.RequeueAfter).To(Equal(endpointProbeInterval))
+		})
+
+		It("probes endpoints concurrently", func() {
+			timeout := EndpointProbeTimeout
+			defer func() { EndpointProbeTimeout = timeout }()
+			EndpointProbeTimeout = 200 * time.Millisecond
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+			port := int32(listener.Addr().(*net.TCPAddr).Port)
+			endpoints := []hackathonv1.EndpointTemplate{
+				{Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Port: port, Service: "desktop"},
+				{Name: "ssh", Protocol: hackathonv1.ExperimentIngressSSH, Port: port, Service: "desktop"},
+				{Name: "web", Protocol: hackathonv1.ExperimentIngressHTTP, Port: port, Service: "desktop"},
+			}
+			rs := &ResourceState{
+				Template: &hackathonv1.Template{Data: hackathonv1.TemplateData{Endpoints: endpoints}},
+				IngressSvcs: []corev1.Service{{
+					ObjectMeta: metav1.ObjectMeta{Name: ingressServiceName("test-expr", "desktop")},
+					Spec:       corev1.ServiceSpec{ClusterIP: "127.0.0.1"},
+				}},
+			}
+
+			start := time.Now()
+			Expect(probeEndpoints(context.Background(), rs, "test-expr")).To(MatchError(ContainSubstring("probe endpoint vnc failed")))
+			Expect(time.Since(start)).To(BeNumerically("<", 2*EndpointProbeTimeout))
+		})
+	})
+})
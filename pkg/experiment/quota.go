@@ -0,0 +1,94 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// QuotaUsage is the resources of an experiment accounted to ExperimentQuota
+type QuotaUsage struct {
+	CPU        resource.Quantity
+	Memory     resource.Quantity
+	DataVolume resource.Quantity
+}
+
+// ExperimentQuotaUsage resolves the resources of experiment in the same way as env pod and data volume are built,
+// cpu and memory of paused experiment are not accounted since its env pod is deleted.
+// Template defaults are used if template or pinned revision not found.
+func ExperimentQuotaUsage(ctx context.Context, k8sClient client.Client, expr *hackathonv1.Experiment, limitRanges []corev1.LimitRange) (*QuotaUsage, error) {
+	template := &hackathonv1.Template{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: expr.Namespace, Name: expr.Spec.Template}, template); client.IgnoreNotFound(err) != nil {
+		return nil, fmt.Errorf("query template failed %s", err.Error())
+	}
+	if expr.Spec.TemplateRevision != "" {
+		rev := &hackathonv1.TemplateRevision{}
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: expr.Namespace, Name: expr.Spec.TemplateRevision}, rev)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("query template revision failed %s", err.Error())
+		}
+		if err == nil {
+			template.Data = *rev.Data.DeepCopy()
+		}
+	}
+
+	dvConfig, _ := effectiveDataVolume(expr, template)
+	usage := &QuotaUsage{DataVolume: dvConfig.Size}
+	if expr.Spec.Pause {
+		return usage, nil
+	}
+	requests := podRequests(expr, template, limitRanges)
+	usage.CPU = requests[corev1.ResourceCPU]
+	usage.Memory = requests[corev1.ResourceMemory]
+	return usage, nil
+}
+
+// podRequests sums requests of containers, init containers run one by one so only the largest counts
+func podRequests(experiment *hackathonv1.Experiment, template *hackathonv1.Template, limitRanges []corev1.LimitRange) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	podCfg := template.Data.PodTemplate
+	if podCfg == nil {
+		return requests
+	}
+
+	if main := mainContainerTemplate(podCfg); main != nil {
+		resources, _ := effectiveResources(experiment, template, limitRanges)
+		addResourceList(requests, containerRequests(resources))
+	}
+	for _, c := range podCfg.Containers {
+		if c.Resources != nil {
+			addResourceList(requests, containerRequests(*c.Resources))
+		}
+	}
+	for _, c := range podCfg.InitContainers {
+		if c.Resources == nil {
+			continue
+		}
+		for name, quantity := range containerRequests(*c.Resources) {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+// containerRequests defaults requests to limits as api server does
+func containerRequests(resources corev1.ResourceRequirements) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	mergeResourceList(requests, resources.Limits)
+	mergeResourceList(requests, resources.Requests)
+	return requests
+}
+
+func addResourceList(dst, src corev1.ResourceList) {
+	for name, quantity := range src {
+		sum := dst[name]
+		sum.Add(quantity)
+		dst[name] = sum
+	}
+}
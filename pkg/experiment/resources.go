@@ -4,7 +4,12 @@ import (
 	"context"
 	"fmt"
 	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	tmplpkg "github.com/kaiyuanshe/cloudengine/pkg/template"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
@@ -12,22 +17,41 @@ import (
 )
 
 type ResourceState struct {
-	Cluster         *hackathonv1.CustomCluster
-	Template        *hackathonv1.Template
-	EnvPod          []corev1.Pod
-	IngressSvc      *corev1.Service
-	DataVolume      *corev1.PersistentVolume
-	DataVolumeClaim *corev1.PersistentVolumeClaim
+	Cluster  *hackathonv1.CustomCluster
+	Template *hackathonv1.Template
+	// TemplateRevision is the revision name of Template data, empty if revision not created yet
+	TemplateRevision string
+	EnvPod           []corev1.Pod
+	IngressSvcs      []corev1.Service
+	HTTPIngress      *networkingv1beta1.Ingress
+	Credentials      *corev1.Secret
+	AuthorizedKeys   *corev1.Secret
+	AccessRole       *rbacv1.Role
+	AccessBinding    *rbacv1.RoleBinding
+	DataVolume       *corev1.PersistentVolume
+	DataVolumeClaim  *corev1.PersistentVolumeClaim
+
+	SourceExperiment *hackathonv1.Experiment
+	CloneJob         *batchv1.Job
+	ResetJob         *batchv1.Job
+	LimitRanges      []corev1.LimitRange
 }
 
 func NewExprResourceStatus(ctx context.Context, k8sClient client.Client, expr *hackathonv1.Experiment) (*ResourceState, error) {
 	var (
-		cluster    = &hackathonv1.CustomCluster{}
-		template   = &hackathonv1.Template{}
-		ingressSvc = &corev1.Service{}
-		pv         = &corev1.PersistentVolume{}
-		pvc        = &corev1.PersistentVolumeClaim{}
-		err        error
+		cluster  = &hackathonv1.CustomCluster{}
+		template = &hackathonv1.Template{}
+		ingress  = &networkingv1beta1.Ingress{}
+		secret   = &corev1.Secret{}
+		keys     = &corev1.Secret{}
+		role     = &rbacv1.Role{}
+		binding  = &rbacv1.RoleBinding{}
+		pv       = &corev1.PersistentVolume{}
+		pvc      = &corev1.PersistentVolumeClaim{}
+		source   = &hackathonv1.Experiment{}
+		cloneJob = &batchv1.Job{}
+		resetJob = &batchv1.Job{}
+		err      error
 	)
 
 	if err = k8sClient.Get(ctx, types.NamespacedName{
@@ -50,21 +74,80 @@ func NewExprResourceStatus(ctx context.Context, k8sClient client.Client, expr *h
 		return nil, fmt.Errorf("template %s not found", expr.Spec.Template)
 	}
 
+	revision, err := resolveTemplateRevision(ctx, k8sClient, expr, template)
+	if err != nil {
+		return nil, err
+	}
+
 	// find ingress svc
+	svcList := &corev1.ServiceList{}
+	if err = k8sClient.List(ctx, svcList, client.InNamespace(expr.Namespace),
+		client.MatchingLabels{LabelKeyExperimentName: expr.Name}); err != nil {
+		return nil, fmt.Errorf("query ingress service failed %s", err.Error())
+	}
+	ingressSvcs := make([]corev1.Service, 0)
+	for _, svc := range svcList.Items {
+		if metav1.IsControlledBy(&svc, expr) {
+			ingressSvcs = append(ingressSvcs, svc)
+		}
+	}
+
+	// find http ingress
 	if err = k8sClient.Get(ctx, types.NamespacedName{
 		Namespace: expr.Namespace,
-		Name:      ingressServiceName(expr.Name, template.Data.IngressProtocol),
-	}, ingressSvc); err != nil {
+		Name:      httpIngressName(expr.Name),
+	}, ingress); err != nil {
 		if client.IgnoreNotFound(err) != nil {
-			return nil, fmt.Errorf("query ingress service failed %s", err.Error())
+			return nil, fmt.Errorf("query http ingress failed: %s", err.Error())
 		}
-		ingressSvc = nil
+		ingress = nil
 	}
 
-	// find pv
+	// find credentials
+	if err = k8sClient.Get(ctx, types.NamespacedName{
+		Namespace: expr.Namespace,
+		Name:      credentialsSecretName(expr.Name),
+	}, secret); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("query credentials secret failed: %s", err.Error())
+		}
+		secret = nil
+	}
+
+	// find authorized keys
 	if err = k8sClient.Get(ctx, types.NamespacedName{
 		Namespace: expr.Namespace,
-		Name:      expr.Name,
+		Name:      authorizedKeysSecretName(expr.Name),
+	}, keys); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("query authorized keys secret failed: %s", err.Error())
+		}
+		keys = nil
+	}
+
+	// find access role and binding
+	if err = k8sClient.Get(ctx, types.NamespacedName{
+		Namespace: expr.Namespace,
+		Name:      accessRoleName(expr.Name),
+	}, role); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("query access role failed: %s", err.Error())
+		}
+		role = nil
+	}
+	if err = k8sClient.Get(ctx, types.NamespacedName{
+		Namespace: expr.Namespace,
+		Name:      accessRoleName(expr.Name),
+	}, binding); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("query access role binding failed: %s", err.Error())
+		}
+		binding = nil
+	}
+
+	// find pv
+	if err = k8sClient.Get(ctx, types.NamespacedName{
+		Name: dataVolumeName(expr),
 	}, pv); err != nil {
 		if client.IgnoreNotFound(err) != nil {
 			return nil, fmt.Errorf("query pv failed: %s", err.Error())
@@ -75,7 +158,7 @@ func NewExprResourceStatus(ctx context.Context, k8sClient client.Client, expr *h
 	// find pvc
 	if err = k8sClient.Get(ctx, types.NamespacedName{
 		Namespace: expr.Namespace,
-		Name:      expr.Name,
+		Name:      dataVolumeClaimName(expr),
 	}, pvc); err != nil {
 		if client.IgnoreNotFound(err) != nil {
 			return nil, fmt.Errorf("query pvc failed: %s", err.Error())
@@ -83,6 +166,41 @@ func NewExprResourceStatus(ctx context.Context, k8sClient client.Client, expr *h
 		pvc = nil
 	}
 
+	// find clone source and job
+	if expr.Spec.Source != nil && expr.Spec.Source.Experiment != "" {
+		if err = k8sClient.Get(ctx, types.NamespacedName{
+			Namespace: expr.Namespace,
+			Name:      expr.Spec.Source.Experiment,
+		}, source); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("query source experiment failed: %s", err.Error())
+			}
+			source = nil
+		}
+
+		if err = k8sClient.Get(ctx, types.NamespacedName{
+			Namespace: expr.Namespace,
+			Name:      cloneJobName(expr),
+		}, cloneJob); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("query clone job failed: %s", err.Error())
+			}
+			cloneJob = nil
+		}
+	} else {
+		source, cloneJob = nil, nil
+	}
+
+	if err = k8sClient.Get(ctx, types.NamespacedName{
+		Namespace: expr.Namespace,
+		Name:      resetJobName(expr),
+	}, resetJob); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("query reset job failed: %s", err.Error())
+		}
+		resetJob = nil
+	}
+
 	podList := &corev1.PodList{}
 	selector := labels.NewSelector()
 	requireExprName, err := labels.NewRequirement(LabelKeyExperimentName, selection.Equals, []string{expr.Name})
@@ -95,12 +213,74 @@ func NewExprResourceStatus(ctx context.Context, k8sClient client.Client, expr *h
 		return nil, err
 	}
 
+	limitRangeList := &corev1.LimitRangeList{}
+	if err = k8sClient.List(ctx, limitRangeList, client.InNamespace(expr.Namespace)); err != nil {
+		return nil, fmt.Errorf("query limit range failed: %s", err.Error())
+	}
+
 	return &ResourceState{
-		Cluster:         cluster,
-		Template:        template,
-		EnvPod:          podList.Items,
-		IngressSvc:      ingressSvc,
-		DataVolume:      pv,
-		DataVolumeClaim: pvc,
+		Cluster:          cluster,
+		Template:         template,
+		TemplateRevision: revision,
+		EnvPod:           podList.Items,
+		IngressSvcs:      ingressSvcs,
+		HTTPIngress:      ingress,
+		Credentials:      secret,
+		AuthorizedKeys:   keys,
+		AccessRole:       role,
+		AccessBinding:    binding,
+		DataVolume:       pv,
+		DataVolumeClaim:  pvc,
+
+		SourceExperiment: source,
+		CloneJob:         cloneJob,
+		ResetJob:         resetJob,
+		LimitRanges:      limitRangeList.Items,
 	}, nil
 }
+
+// revisionError means the pinned template revision can not be used, it is reported
+// by RevisionResolved condition instead of failing the reconcile
+type revisionError struct {
+	reason  string
+	message string
+}
+
+func (e *revisionError) Error() string {
+	return e.message
+}
+
+// resolveTemplateRevision replaces template data with the pinned revision,
+// or finds the revision matching current template data
+func resolveTemplateRevision(ctx context.Context, k8sClient client.Client, expr *hackathonv1.Experiment, template *hackathonv1.Template) (string, error) {
+	if expr.Spec.TemplateRevision == "" {
+		rev, err := tmplpkg.FindRevision(ctx, k8sClient, template)
+		if err != nil || rev == nil {
+			return "", err
+		}
+		return rev.Name, nil
+	}
+
+	rev := &hackathonv1.TemplateRevision{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{
+		Namespace: expr.Namespace,
+		Name:      expr.Spec.TemplateRevision,
+	}, rev); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("query template revision failed %s", err.Error())
+		}
+		return "", &revisionError{"RevisionNotFound", fmt.Sprintf("template revision %s not found", expr.Spec.TemplateRevision)}
+	}
+	if rev.Template != template.Name {
+		return "", &revisionError{"RevisionMismatch", fmt.Sprintf("template revision %s does not belong to template %s", rev.Name, template.Name)}
+	}
+	hash, err := tmplpkg.DataHash(&rev.Data)
+	if err != nil {
+		return "", err
+	}
+	if hash != rev.Hash {
+		return "", &revisionError{"RevisionModified", fmt.Sprintf("data of template revision %s does not match its hash", rev.Name)}
+	}
+	template.Data = *rev.Data.DeepCopy()
+	return rev.Name, nil
+}
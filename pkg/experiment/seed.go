@@ -0,0 +1,114 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	corev1 "k8s.io/api/core/v1"
+	"strconv"
+)
+
+const (
+	dataSeedContainerName = "data-seed"
+	dataSeedVolumeName    = "data-seed"
+	dataSeedSourcePath    = "/seed"
+	dataSeedMarkerFile    = ".cloudengine-seeded"
+)
+
+// needSeedData reports whether the env pod should run the data seed init container,
+// cloned experiments already get their content from the source volume unless data reset
+func needSeedData(experiment *hackathonv1.Experiment, template *hackathonv1.Template) bool {
+	if template.Data.DataSource == nil {
+		return false
+	}
+	seeded := hackathonv1.QueryExperimentCondition(experiment.Status.Conditions, hackathonv1.ExperimentDataSeeded)
+	if experiment.Spec.Source != nil && (seeded == nil || seeded.Reason != "DataReset") {
+		return false
+	}
+	return seeded == nil || seeded.Status != hackathonv1.ExperimentConditionTrue
+}
+
+// buildDataSeedContainer builds the init container which unpacks template data source into data volume,
+// a marker file is left in the volume so that the content is never unpacked twice
+func buildDataSeedContainer(source *hackathonv1.DataSource, mountPath string) (*corev1.Container, []corev1.Volume, error) {
+	var (
+		image   = DataVolumeJobImage
+		envs    []corev1.EnvVar
+		volumes []corev1.Volume
+		mounts  = []corev1.VolumeMount{{Name: dataVolumeVolumeName, MountPath: mountPath}}
+		fetch   string
+	)
+
+	switch {
+	case source.Git != nil:
+		image = DataSeedGitImage
+		envs = []corev1.EnvVar{
+			{Name: "SEED_URL", Value: source.Git.URL},
+			{Name: "SEED_REF", Value: source.Git.Ref},
+			{Name: "SEED_KEEP_HISTORY", Value: strconv.FormatBool(source.Git.KeepHistory)},
+		}
+		fetch = `git clone "$SEED_URL" /tmp/seed
+if [ -n "$SEED_REF" ]; then git -C /tmp/seed checkout "$SEED_REF"; fi
+if [ "$SEED_KEEP_HISTORY" != "true" ]; then rm -rf /tmp/seed/.git; fi
+cp -a /tmp/seed/. "$DATA_PATH"/`
+	case source.Archive != nil:
+		envs = []corev1.EnvVar{{Name: "SEED_URL", Value: source.Archive.URL}}
+		fetch = `wget -O /tmp/seed "$SEED_URL"
+case "$SEED_URL" in
+  *.zip) unzip -o /tmp/seed -d "$DATA_PATH" ;;
+  *.tar.gz|*.tgz) tar -xzf /tmp/seed -C "$DATA_PATH" ;;
+  *) tar -xf /tmp/seed -C "$DATA_PATH" ;;
+esac`
+	case source.ConfigMap != nil:
+		volumes = append(volumes, corev1.Volume{
+			Name: dataSeedVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: source.ConfigMap.Name},
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: dataSeedVolumeName, MountPath: dataSeedSourcePath, ReadOnly: true})
+		fetch = fmt.Sprintf(`cp -L %s/* "$DATA_PATH"/`, dataSeedSourcePath)
+	default:
+		return nil, nil, fmt.Errorf("data source is empty")
+	}
+
+	script := fmt.Sprintf(`set -e
+if [ -f "$DATA_PATH/%s" ]; then echo "data already seeded"; exit 0; fi
+%s
+touch "$DATA_PATH/%s"`, dataSeedMarkerFile, fetch, dataSeedMarkerFile)
+
+	return &corev1.Container{
+		Name:         dataSeedContainerName,
+		Image:        image,
+		Command:      []string{"sh", "-c", script},
+		Env:          append(envs, corev1.EnvVar{Name: "DATA_PATH", Value: mountPath}),
+		VolumeMounts: mounts,
+	}, volumes, nil
+}
+
+// updateDataSeedCondition records the data seed init container result of env pod
+func updateDataSeedCondition(status *Status, pod *corev1.Pod) {
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name != dataSeedContainerName {
+			continue
+		}
+		switch {
+		case cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+			if !hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionTrue) {
+				status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, "data volume seeded")
+			}
+			status.SetCondition(hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionTrue, "Seeded", "")
+		case cs.State.Terminated != nil:
+			status.SetCondition(hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionFalse, "SeedFailed",
+				fmt.Sprintf("data seed exit with code %d: %s", cs.State.Terminated.ExitCode, cs.State.Terminated.Message))
+		case cs.LastTerminationState.Terminated != nil:
+			status.SetCondition(hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionFalse, "SeedFailed",
+				fmt.Sprintf("data seed exit with code %d, retrying", cs.LastTerminationState.Terminated.ExitCode))
+		default:
+			status.SetCondition(hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionFalse, "Seeding", "")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package experiment
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func containerEnv(container *corev1.Container, name string) string {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+var _ = Describe("experiment-data-seed", func() {
+	Context("seed container", func() {
+		It("drops git history unless kept", func() {
+			source := &hackathonv1.DataSource{Git: &hackathonv1.GitDataSource{URL: "https://example.com/repo.git", Ref: "v1"}}
+			container, volumes, err := buildDataSeedContainer(source, "/data")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(BeEmpty())
+			Expect(container.Image).To(Equal(DataSeedGitImage))
+			Expect(container.Command[2]).To(ContainSubstring("rm -rf /tmp/seed/.git"))
+			Expect(containerEnv(container, "SEED_KEEP_HISTORY")).To(Equal("false"))
+			Expect(containerEnv(container, "SEED_REF")).To(Equal("v1"))
+			Expect(containerEnv(container, "DATA_PATH")).To(Equal("/data"))
+
+			source.Git.KeepHistory = true
+			container, _, err = buildDataSeedContainer(source, "/data")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containerEnv(container, "SEED_KEEP_HISTORY")).To(Equal("true"))
+		})
+
+		It("mounts config map source", func() {
+			source := &hackathonv1.DataSource{ConfigMap: &hackathonv1.ConfigMapDataSource{Name: "starter"}}
+			container, volumes, err := buildDataSeedContainer(source, "/data")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(HaveLen(1))
+			Expect(volumes[0].ConfigMap.Name).To(Equal("starter"))
+			Expect(container.VolumeMounts).To(HaveLen(2))
+			Expect(container.VolumeMounts[1].ReadOnly).To(BeTrue())
+		})
+
+		It("refuses empty source", func() {
+			_, _, err := buildDataSeedContainer(&hackathonv1.DataSource{}, "/data")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("seed decision", func() {
+		tmpl := &hackathonv1.Template{Data: hackathonv1.TemplateData{
+			DataSource: &hackathonv1.DataSource{Archive: &hackathonv1.ArchiveDataSource{URL: "https://example.com/a.tgz"}},
+		}}
+
+		It("seeds until data seeded", func() {
+			expr := newVolumeExperiment(nil)
+			Expect(needSeedData(expr, &hackathonv1.Template{})).To(BeFalse())
+			Expect(needSeedData(expr, tmpl)).To(BeTrue())
+
+			expr.Status.Conditions = []hackathonv1.ExperimentCondition{hackathonv1.NewExperimentCondition(
+				hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionTrue, "Seeded", "")}
+			Expect(needSeedData(expr, tmpl)).To(BeFalse())
+		})
+
+		It("skips cloned experiments unless data reset", func() {
+			expr := newVolumeExperiment(&hackathonv1.ExperimentSource{Experiment: "origin"})
+			Expect(needSeedData(expr, tmpl)).To(BeFalse())
+
+			expr.Status.Conditions = []hackathonv1.ExperimentCondition{hackathonv1.NewExperimentCondition(
+				hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionFalse, "DataReset", "")}
+			Expect(needSeedData(expr, tmpl)).To(BeTrue())
+		})
+	})
+
+	Context("seed condition", func() {
+		It("follows seed init container", func() {
+			status := newLifecycleStatus(hackathonv1.ExperimentProvisioning)
+			pod := &corev1.Pod{Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:  dataSeedContainerName,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}}}}
+			updateDataSeedCondition(status, pod)
+			cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataSeeded)
+			Expect(cond.Reason).To(Equal("Seeding"))
+
+			pod.Status.InitContainerStatuses[0].State = corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: "clone failed"}}
+			updateDataSeedCondition(status, pod)
+			cond = hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentDataSeeded)
+			Expect(cond.Reason).To(Equal("SeedFailed"))
+			Expect(cond.Message).To(ContainSubstring("clone failed"))
+
+			pod.Status.InitContainerStatuses[0].State = corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+			updateDataSeedCondition(status, pod)
+			Expect(hackathonv1.CheckExperimentCondition(status.Status.Conditions,
+				hackathonv1.ExperimentDataSeeded, hackathonv1.ExperimentConditionTrue)).To(BeTrue())
+			Expect(status.Events).To(HaveLen(1))
+		})
+	})
+})
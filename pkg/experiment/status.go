@@ -15,34 +15,85 @@ type Status struct {
 }
 
 func (s *Status) UpdateExperimentStatus(state *ResourceState) {
-	if state.IngressSvc != nil && state.IngressSvc.Spec.Type == corev1.ServiceTypeNodePort {
-		ingressIps := make([]string, 0)
-		if len(state.IngressSvc.Spec.ExternalIPs) > 0 {
-			ingressIps = state.IngressSvc.Spec.ExternalIPs
+	services := map[string]*corev1.Service{}
+	for i := range state.IngressSvcs {
+		services[state.IngressSvcs[i].Name] = &state.IngressSvcs[i]
+	}
+
+	endpoints := make([]hackathonv1.ExperimentEndpointStatus, 0)
+	firstHTTP := true
+	s.Status.URL = ""
+	for _, endpoint := range templateEndpoints(state.Template) {
+		endpointStatus := hackathonv1.ExperimentEndpointStatus{
+			Name:     endpoint.Name,
+			Protocol: endpoint.Protocol,
+			Service:  ingressServiceName(s.Experiment.Name, endpointServiceGroup(&endpoint)),
+			Port:     endpoint.Port,
 		}
-		s.Status.IngressIPs = ingressIps
-		if len(state.IngressSvc.Spec.Ports) == 1 {
-			s.Status.IngressPort = state.IngressSvc.Spec.Ports[0].NodePort
-		} else {
-			s.AddEvent(corev1.EventTypeWarning, "NoIngressPortFound", fmt.Sprintf("got ingress port: %d", len(state.IngressSvc.Spec.Ports)))
+		switch endpoint.Protocol {
+		case hackathonv1.ExperimentIngressVNC:
+			if endpoint.VNC != nil {
+				endpointStatus.VNC = &hackathonv1.VNCConfig{Username: endpoint.VNC.Username}
+				endpointStatus.Credentials = endpointCredentials(s.Experiment.Name, endpoint.Name)
+			}
+		case hackathonv1.ExperimentIngressSSH:
+			if endpoint.SSH != nil {
+				endpointStatus.SSH = &hackathonv1.SSHConfig{Username: endpoint.SSH.Username}
+				endpointStatus.Credentials = endpointCredentials(s.Experiment.Name, endpoint.Name)
+			}
+		case hackathonv1.ExperimentIngressHTTP:
+			endpointStatus.URL = endpointURL(s.Experiment, state.Cluster, endpoint.Name, firstHTTP)
+			if firstHTTP {
+				s.Status.URL = endpointStatus.URL
+			}
+			firstHTTP = false
+		default:
+			s.AddEvent(corev1.EventTypeWarning, "NoIngressConfig", fmt.Sprintf("ingress protoco %s not supported", endpoint.Protocol))
+		}
+
+		svc, ok := services[ingressServiceName(s.Experiment.Name, endpointServiceGroup(&endpoint))]
+		if ok && svc.Spec.Type == corev1.ServiceTypeNodePort {
+			endpointStatus.IngressIPs = svc.Spec.ExternalIPs
+			for _, port := range svc.Spec.Ports {
+				if port.Name == endpoint.Name {
+					endpointStatus.IngressPort = port.NodePort
+				}
+			}
+			if endpointStatus.IngressPort == 0 {
+				s.AddEvent(corev1.EventTypeWarning, "NoIngressPortFound", fmt.Sprintf("ingress port of endpoint %s not found", endpoint.Name))
+			}
 		}
+		endpointStatus.Connection = endpointConnection(s.Experiment, &endpointStatus)
+		endpoints = append(endpoints, endpointStatus)
 	}
+	s.Status.Endpoints = endpoints
 
-	// update connect config
-	s.Status.Protocol = state.Template.Data.IngressProtocol
-	switch state.Template.Data.IngressProtocol {
-	case hackathonv1.ExperimentIngressVNC:
-		s.Status.VNC = state.Template.Data.VNC
-	case hackathonv1.ExperimentIngressSSH:
-		s.Status.SSH = state.Template.Data.SSH
-	default:
-		s.AddEvent(corev1.EventTypeWarning, "NoIngressConfig", fmt.Sprintf("ingress protoco %s not supported", state.Template.Data.IngressProtocol))
+	// legacy connect config
+	if len(endpoints) > 0 {
+		first := endpoints[0]
+		s.Status.IngressIPs = first.IngressIPs
+		s.Status.IngressPort = first.IngressPort
+		s.Status.Protocol = first.Protocol
+		s.Status.VNC = first.VNC
+		s.Status.SSH = first.SSH
 	}
 
 	s.Status.Cluster = s.Experiment.Spec.ClusterName
 	s.Status.ClusterSync = false
 }
 
+// SetCondition updates the condition only when status, reason or message changed,
+// so that reconciling an unchanged experiment does not rewrite its status
+func (s *Status) SetCondition(conditionType hackathonv1.ExperimentConditionType, status hackathonv1.ExperimentConditionStatus, reason, message string) {
+	cond := hackathonv1.QueryExperimentCondition(s.Status.Conditions, conditionType)
+	if cond != nil && cond.Status == status && cond.Reason == reason && cond.Message == message {
+		return
+	}
+	s.Status.Conditions = hackathonv1.UpdateExperimentConditions(
+		s.Status.Conditions,
+		hackathonv1.NewExperimentCondition(conditionType, status, reason, message))
+}
+
 func (s *Status) Apply() ([]event.Event, *hackathonv1.Experiment) {
 	pre, crt := s.Experiment.Status, s.Status
 	if reflect.DeepEqual(pre, crt) {
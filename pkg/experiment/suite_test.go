@@ -0,0 +1,17 @@
+package experiment
+
+import (
+	"testing"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestExperiment(t *testing.T) {
+	RegisterFailHandler(Fail)
+	// owner references of built resources need experiment kind
+	Expect(hackathonv1.AddToScheme(scheme.Scheme)).To(Succeed())
+	RunSpecs(t, "Experiment Suite")
+}
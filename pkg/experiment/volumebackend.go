@@ -0,0 +1,147 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+)
+
+type volumeBuilder func(experiment *hackathonv1.Experiment, config *dataVolumeConfig) *corev1.PersistentVolume
+
+// volumeBuilders builds the pre-provisioned volume of each backend,
+// backends not listed here rely on storage class to provision volume
+var volumeBuilders = map[hackathonv1.DataVolumeBackend]volumeBuilder{
+	hackathonv1.HostPathDataVolume: buildHostPathDataVolume,
+	hackathonv1.LocalDataVolume:    buildLocalDataVolume,
+}
+
+func preProvisioned(backend hackathonv1.DataVolumeBackend) bool {
+	_, ok := volumeBuilders[backend]
+	return ok
+}
+
+// ValidateDataVolumeBackend checks the backend is one of HostPath, Local and Dynamic
+func ValidateDataVolumeBackend(backend string) error {
+	if preProvisioned(hackathonv1.DataVolumeBackend(backend)) || hackathonv1.DataVolumeBackend(backend) == hackathonv1.DynamicDataVolume {
+		return nil
+	}
+	return fmt.Errorf("unknown data volume backend %s", backend)
+}
+
+func buildHostPathDataVolume(experiment *hackathonv1.Experiment, config *dataVolumeConfig) *corev1.PersistentVolume {
+	hostType := corev1.HostPathDirectoryOrCreate
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: dataVolumeName(experiment),
+			Labels: map[string]string{
+				LabelKeyClusterName:    experiment.Spec.ClusterName,
+				LabelKeyExperimentName: experiment.Name,
+			},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: map[corev1.ResourceName]resource.Quantity{
+				corev1.ResourceStorage: config.Size,
+			},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: dataVolumeHostPath(experiment),
+					Type: &hostType,
+				}},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              config.StorageClass,
+			ClaimRef:                      &corev1.ObjectReference{Namespace: experiment.Namespace, Name: dataVolumeClaimName(experiment)},
+		},
+	}
+}
+
+// buildLocalDataVolume pins a hostPath volume to node by node affinity,
+// hostPath is used instead of local volume source so that kubelet creates the directory
+func buildLocalDataVolume(experiment *hackathonv1.Experiment, config *dataVolumeConfig) *corev1.PersistentVolume {
+	pv := buildHostPathDataVolume(experiment, config)
+	pv.Labels[LabelKeyNodeName] = config.Node
+	hostname := config.NodeHostname
+	if hostname == "" {
+		hostname = config.Node
+	}
+	pv.Spec.NodeAffinity = &corev1.VolumeNodeAffinity{
+		Required: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{
+							Key:      corev1.LabelHostname,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{hostname},
+						},
+					},
+				},
+			},
+		},
+	}
+	return pv
+}
+
+func dataVolumeHostPath(experiment *hackathonv1.Experiment) string {
+	return fmt.Sprintf("%s/%s", DataVolumeHostPathDir, experiment.UID)
+}
+
+// pickVolumeNode chooses the ready node holding the fewest local data volumes,
+// it returns the node name and the hostname label matched by volume node affinity
+func pickVolumeNode(ctx context.Context, k8sClient client.Client) (string, string, error) {
+	nodeList := &corev1.NodeList{}
+	if err := k8sClient.List(ctx, nodeList); err != nil {
+		return "", "", fmt.Errorf("list nodes failed: %s", err.Error())
+	}
+	pvList := &corev1.PersistentVolumeList{}
+	if err := k8sClient.List(ctx, pvList, client.HasLabels{LabelKeyNodeName}); err != nil {
+		return "", "", fmt.Errorf("list local data volumes failed: %s", err.Error())
+	}
+	node, err := chooseVolumeNode(nodeList.Items, pvList.Items)
+	if err != nil {
+		return "", "", err
+	}
+	return node.Name, node.Labels[corev1.LabelHostname], nil
+}
+
+// chooseVolumeNode skips nodes without hostname label, since volume node affinity can only match labels
+func chooseVolumeNode(nodes []corev1.Node, volumes []corev1.PersistentVolume) (*corev1.Node, error) {
+	volumeCount := map[string]int{}
+	for _, pv := range volumes {
+		volumeCount[pv.Labels[LabelKeyNodeName]]++
+	}
+
+	candidates := make([]*corev1.Node, 0)
+	for i := range nodes {
+		no := &nodes[i]
+		if no.Spec.Unschedulable || !isNodeReady(no) || no.Labels[corev1.LabelHostname] == "" {
+			continue
+		}
+		candidates = append(candidates, no)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no ready node with %s label for local data volume", corev1.LabelHostname)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if volumeCount[candidates[i].Name] != volumeCount[candidates[j].Name] {
+			return volumeCount[candidates[i].Name] < volumeCount[candidates[j].Name]
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0], nil
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
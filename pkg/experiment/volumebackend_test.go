@@ -0,0 +1,138 @@
+package experiment
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newVolumeNode(name, hostname string, ready bool) corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}},
+	}
+	if hostname != "" {
+		node.Labels[corev1.LabelHostname] = hostname
+	}
+	return node
+}
+
+// nodeClient serves nodes and local volumes to volume node selection
+type nodeClient struct {
+	client.Client
+	nodes   []corev1.Node
+	volumes []corev1.PersistentVolume
+}
+
+func (c *nodeClient) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	for i := range c.nodes {
+		if c.nodes[i].Name == key.Name {
+			c.nodes[i].DeepCopyInto(obj.(*corev1.Node))
+			return nil
+		}
+	}
+	return errors.NewNotFound(schema.GroupResource{Resource: "nodes"}, key.Name)
+}
+
+func (c *nodeClient) List(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+	switch list := obj.(type) {
+	case *corev1.NodeList:
+		list.Items = c.nodes
+	case *corev1.PersistentVolumeList:
+		list.Items = c.volumes
+	}
+	return nil
+}
+
+func newNodeVolume(node string) corev1.PersistentVolume {
+	return corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{LabelKeyNodeName: node}}}
+}
+
+var _ = Describe("experiment-volume-backend", func() {
+	It("validates backend", func() {
+		Expect(ValidateDataVolumeBackend("HostPath")).To(Succeed())
+		Expect(ValidateDataVolumeBackend("Local")).To(Succeed())
+		Expect(ValidateDataVolumeBackend("Dynamic")).To(Succeed())
+		Expect(ValidateDataVolumeBackend("")).NotTo(Succeed())
+		Expect(ValidateDataVolumeBackend("local")).NotTo(Succeed())
+	})
+
+	It("refuses experiment with unknown backend", func() {
+		expr := newVolumeExperiment(nil)
+		tmpl := &hackathonv1.Template{Data: hackathonv1.TemplateData{
+			DataVolume: &hackathonv1.DataVolumeTemplate{Backend: "NFS"},
+		}}
+		status := NewStatus(expr)
+		v := &DataVolume{status: status, resourceState: &ResourceState{Template: tmpl}}
+		v.Reconcile(context.Background())
+		cond := hackathonv1.QueryExperimentCondition(status.Status.Conditions, hackathonv1.ExperimentVolumeCreated)
+		Expect(cond.Reason).To(Equal("InvalidBackend"))
+		Expect(status.Events).To(HaveLen(1))
+
+		v.Reconcile(context.Background())
+		Expect(status.Events).To(HaveLen(1))
+	})
+
+	It("chooses ready node with fewest volumes", func() {
+		nodes := []corev1.Node{
+			newVolumeNode("node-a", "node-a", true),
+			newVolumeNode("node-b", "host-b", true),
+			newVolumeNode("node-c", "node-c", false),
+			newVolumeNode("node-d", "", true),
+		}
+		volumes := []corev1.PersistentVolume{newNodeVolume("node-a"), newNodeVolume("node-a")}
+
+		node, err := chooseVolumeNode(nodes, volumes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.Name).To(Equal("node-b"))
+		Expect(node.Labels[corev1.LabelHostname]).To(Equal("host-b"))
+
+		volumes = append(volumes, newNodeVolume("node-b"), newNodeVolume("node-b"), newNodeVolume("node-b"))
+		node, err = chooseVolumeNode(nodes, volumes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.Name).To(Equal("node-a"))
+
+		_, err = chooseVolumeNode(nodes[2:], nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("puts cloned volume on the node of source volume", func() {
+		nodes := []corev1.Node{newVolumeNode("node-a", "node-a", true), newVolumeNode("node-b", "host-b", true)}
+		cli := &nodeClient{nodes: nodes, volumes: []corev1.PersistentVolume{newNodeVolume("node-b")}}
+		source := newVolumeExperiment(nil)
+		source.Name = "source-expr"
+		source.Status.DataVolume = &hackathonv1.ExperimentDataVolumeStatus{Backend: hackathonv1.LocalDataVolume, Node: "node-b"}
+		v := &DataVolume{
+			client:        cli,
+			status:        NewStatus(newVolumeExperiment(&hackathonv1.ExperimentSource{Experiment: "source-expr"})),
+			resourceState: &ResourceState{SourceExperiment: source},
+		}
+		node, hostname, err := v.volumeNode(context.Background(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node).To(Equal("node-b"))
+		Expect(hostname).To(Equal("host-b"))
+
+		source.Status.DataVolume.Backend = hackathonv1.DynamicDataVolume
+		node, _, err = v.volumeNode(context.Background(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node).To(Equal("node-a"))
+	})
+
+	It("pins local volume by hostname label", func() {
+		expr := newVolumeExperiment(nil)
+		pv := buildLocalDataVolume(expr, &dataVolumeConfig{Node: "node-b", NodeHostname: "host-b"})
+		Expect(pv.Labels[LabelKeyNodeName]).To(Equal("node-b"))
+		Expect(pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values).To(Equal([]string{"host-b"}))
+	})
+})
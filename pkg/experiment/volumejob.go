@@ -0,0 +1,85 @@
+package experiment
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	volumeJobBackoffLimit = 3
+)
+
+// newVolumeJob builds a job which runs a shell script against experiment volumes,
+// the job pods are labeled differently from env pods so they are never treated as experiment pods
+func newVolumeJob(experiment *hackathonv1.Experiment, name, script string, volumes []corev1.Volume, mounts []corev1.VolumeMount) (*batchv1.Job, error) {
+	backoffLimit := int32(volumeJobBackoffLimit)
+	labels := map[string]string{
+		LabelKeyClusterName: experiment.Spec.ClusterName,
+		LabelKeyVolumeJob:   experiment.Name,
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: experiment.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Containers: []corev1.Container{
+						{
+							Name:         "volume-job",
+							Image:        DataVolumeJobImage,
+							Command:      []string{"sh", "-c", script},
+							VolumeMounts: mounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+
+	err := controllerutil.SetControllerReference(experiment, job.GetObjectMeta(), scheme.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("set volume job owner ref failed: %s", err.Error())
+	}
+	return job, nil
+}
+
+func jobFinished(job *batchv1.Job) (succeeded, failed bool) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			succeeded = true
+		case batchv1.JobFailed:
+			failed = true
+		}
+	}
+	return
+}
+
+func claimVolume(name, claimName string, readOnly bool) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+				ReadOnly:  readOnly,
+			},
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"net/http"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// AccessValidatePath is the path of owner and mentors validating webhook
+const AccessValidatePath = "/validate-hackathon-kaiyuanshe-cn-v1-access"
+
+// accessBindVerb on experiments is required to set owner and mentors freely, the manager has it
+// as subjects of the objects it copies them from are checked already
+const accessBindVerb = "bind"
+
+// +kubebuilder:webhook:path=/validate-hackathon-kaiyuanshe-cn-v1-access,mutating=false,failurePolicy=fail,groups=hackathon.kaiyuanshe.cn,resources=experiments;experimentsets;experimentpools;experimentclaims,verbs=create;update,versions=v1,name=vaccess.kaiyuanshe.cn
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experiments,verbs=bind
+
+// AccessValidator guards owner and mentors, who are granted to read experiment credentials.
+// Users allowed to bind experiments in namespace may set any subjects, other users may only
+// name themselves as owner on creation and can not change owner or mentors afterwards
+type AccessValidator struct {
+	Client  client.Client
+	Logger  logr.Logger
+	decoder *admission.Decoder
+}
+
+// accessSubjects are owners and mentors of an object, the manager copies those of experiment sets,
+// pools and claims to experiments, experiment sets have one per team override
+type accessSubjects struct {
+	Owners  []hackathonv1.ExperimentSubject
+	Mentors []hackathonv1.ExperimentSubject
+}
+
+func (v *AccessValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *AccessValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	subjects, err := v.decodeSubjects(req.Kind.Kind, req.Object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *accessSubjects
+	if req.Operation == admissionv1beta1.Update {
+		if old, err = v.decodeSubjects(req.Kind.Kind, req.OldObject); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	denied := checkSubjects(&req.UserInfo, req.Namespace, subjects, old)
+	if denied == nil {
+		return admission.Allowed("")
+	}
+	allowed, err := v.canBind(ctx, &req.UserInfo, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if allowed {
+		return admission.Allowed("")
+	}
+	v.Logger.Info("owner or mentors change rejected", "user", req.UserInfo.Username, "kind", req.Kind.Kind,
+		"namespace", req.Namespace, "name", req.Name, "error", denied.Error())
+	return admission.Denied(denied.Error())
+}
+
+func (v *AccessValidator) decodeSubjects(kind string, raw runtime.RawExtension) (*accessSubjects, error) {
+	subjects := &accessSubjects{}
+	addSpec := func(owner *hackathonv1.ExperimentSubject, mentors []hackathonv1.ExperimentSubject) {
+		if owner != nil {
+			subjects.Owners = append(subjects.Owners, *owner)
+		}
+		subjects.Mentors = append(subjects.Mentors, mentors...)
+	}
+
+	switch kind {
+	case "Experiment":
+		expr := &hackathonv1.Experiment{}
+		if err := v.decoder.DecodeRaw(raw, expr); err != nil {
+			return nil, err
+		}
+		addSpec(expr.Spec.Owner, expr.Spec.Mentors)
+	case "ExperimentSet":
+		set := &hackathonv1.ExperimentSet{}
+		if err := v.decoder.DecodeRaw(raw, set); err != nil {
+			return nil, err
+		}
+		addSpec(set.Spec.Template.Spec.Owner, set.Spec.Template.Spec.Mentors)
+		for _, team := range set.Spec.Teams {
+			if team.Override != nil {
+				addSpec(team.Override.Owner, team.Override.Mentors)
+			}
+		}
+	case "ExperimentPool":
+		pool := &hackathonv1.ExperimentPool{}
+		if err := v.decoder.DecodeRaw(raw, pool); err != nil {
+			return nil, err
+		}
+		addSpec(pool.Spec.Template.Spec.Owner, pool.Spec.Template.Spec.Mentors)
+	case "ExperimentClaim":
+		claim := &hackathonv1.ExperimentClaim{}
+		if err := v.decoder.DecodeRaw(raw, claim); err != nil {
+			return nil, err
+		}
+		addSpec(claim.Spec.Owner, claim.Spec.Mentors)
+	default:
+		return nil, fmt.Errorf("kind %s not supported", kind)
+	}
+	return subjects, nil
+}
+
+// checkSubjects returns why subjects can not be set by user without bind permission, old is nil for creation
+func checkSubjects(user *authenticationv1.UserInfo, namespace string, subjects, old *accessSubjects) error {
+	if old != nil {
+		if reflect.DeepEqual(old, subjects) {
+			return nil
+		}
+		return fmt.Errorf("owner and mentors can only be changed by users allowed to bind experiments")
+	}
+	if len(subjects.Mentors) > 0 {
+		return fmt.Errorf("mentors can only be set by users allowed to bind experiments")
+	}
+	for i := range subjects.Owners {
+		// groups are not matched, a group owner grants access to other users
+		self := &hackathonv1.Experiment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace},
+			Spec:       hackathonv1.ExperimentSpec{Owner: &subjects.Owners[i]},
+		}
+		if !self.Authorized(user.Username, nil) {
+			return fmt.Errorf("%s can only set itself as owner", user.Username)
+		}
+	}
+	return nil
+}
+
+// canBind reviews whether user is allowed to bind experiments in namespace
+func (v *AccessValidator) canBind(ctx context.Context, user *authenticationv1.UserInfo, namespace string) (bool, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, values := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(values)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      accessBindVerb,
+				Group:     hackathonv1.GroupVersion.Group,
+				Resource:  "experiments",
+			},
+		},
+	}
+	if err := v.Client.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("review bind permission failed: %s", err.Error())
+	}
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,157 @@
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// reviewClient allows binding experiments to listed users only
+type reviewClient struct {
+	client.Client
+	binders map[string]bool
+}
+
+func (c *reviewClient) Create(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+	review := obj.(*authorizationv1.SubjectAccessReview)
+	attrs := review.Spec.ResourceAttributes
+	review.Status.Allowed = c.binders[review.Spec.User] && attrs.Verb == "bind" && attrs.Resource == "experiments"
+	return nil
+}
+
+func newAccessRequest(user string, obj, old runtime.Object) admission.Request {
+	encode := func(o runtime.Object) runtime.RawExtension {
+		raw, err := json.Marshal(o)
+		Expect(err).NotTo(HaveOccurred())
+		return runtime.RawExtension{Raw: raw}
+	}
+	kind := obj.GetObjectKind().GroupVersionKind()
+	req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Group: kind.Group, Version: kind.Version, Kind: kind.Kind},
+		Namespace: "default",
+		Operation: admissionv1beta1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: user},
+		Object:    encode(obj),
+	}}
+	if old != nil {
+		req.Operation, req.OldObject = admissionv1beta1.Update, encode(old)
+	}
+	return req
+}
+
+func newAccessExperiment(owner string, mentors ...string) *hackathonv1.Experiment {
+	expr := newVolumeExperiment(nil)
+	expr.TypeMeta = metav1.TypeMeta{APIVersion: hackathonv1.GroupVersion.String(), Kind: "Experiment"}
+	if owner != "" {
+		expr.Spec.Owner = &hackathonv1.ExperimentSubject{Kind: hackathonv1.ExperimentSubjectUser, Name: owner}
+	}
+	for _, mentor := range mentors {
+		expr.Spec.Mentors = append(expr.Spec.Mentors, hackathonv1.ExperimentSubject{Kind: hackathonv1.ExperimentSubjectUser, Name: mentor})
+	}
+	return expr
+}
+
+var _ = Describe("experiment-access-webhook", func() {
+	var v *AccessValidator
+	BeforeEach(func() {
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+		v = &AccessValidator{Client: &reviewClient{binders: map[string]bool{"admin": true}}, Logger: zap.New()}
+		Expect(v.InjectDecoder(decoder)).To(Succeed())
+	})
+
+	allowed := func(req admission.Request) bool {
+		return v.Handle(context.Background(), req).Allowed
+	}
+
+	It("lets creator set itself as owner", func() {
+		Expect(allowed(newAccessRequest("alice", newAccessExperiment(""), nil))).To(BeTrue())
+		Expect(allowed(newAccessRequest("alice", newAccessExperiment("alice"), nil))).To(BeTrue())
+		Expect(allowed(newAccessRequest("alice", newAccessExperiment("bob"), nil))).To(BeFalse())
+		Expect(allowed(newAccessRequest("alice", newAccessExperiment("alice", "bob"), nil))).To(BeFalse())
+
+		group := newAccessExperiment("")
+		group.Spec.Owner = &hackathonv1.ExperimentSubject{Kind: hackathonv1.ExperimentSubjectGroup, Name: "team-a"}
+		Expect(allowed(newAccessRequest("alice", group, nil))).To(BeFalse())
+		Expect(allowed(newAccessRequest("admin", group, nil))).To(BeTrue())
+	})
+
+	It("only lets users allowed to bind change owner and mentors", func() {
+		old := newAccessExperiment("alice")
+		changed := newAccessExperiment("alice", "bob")
+		Expect(allowed(newAccessRequest("alice", changed, old))).To(BeFalse())
+		Expect(allowed(newAccessRequest("admin", changed, old))).To(BeTrue())
+
+		taken := newAccessExperiment("mallory")
+		Expect(allowed(newAccessRequest("mallory", taken, old))).To(BeFalse())
+
+		updated := newAccessExperiment("alice")
+		updated.Spec.Pause = true
+		Expect(allowed(newAccessRequest("alice", updated, old))).To(BeTrue())
+	})
+
+	It("checks subjects copied by sets and claims", func() {
+		set := &hackathonv1.ExperimentSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: hackathonv1.GroupVersion.String(), Kind: "ExperimentSet"},
+			ObjectMeta: metav1.ObjectMeta{Name: "set", Namespace: "default"},
+			Spec: hackathonv1.ExperimentSetSpec{Teams: []hackathonv1.ExperimentSetTeam{{
+				Name:     "a",
+				Override: &hackathonv1.ExperimentOverride{Owner: &hackathonv1.ExperimentSubject{Kind: hackathonv1.ExperimentSubjectUser, Name: "bob"}},
+			}}},
+		}
+		Expect(allowed(newAccessRequest("alice", set, nil))).To(BeFalse())
+		Expect(allowed(newAccessRequest("admin", set, nil))).To(BeTrue())
+
+		claim := &hackathonv1.ExperimentClaim{
+			TypeMeta:   metav1.TypeMeta{APIVersion: hackathonv1.GroupVersion.String(), Kind: "ExperimentClaim"},
+			ObjectMeta: metav1.ObjectMeta{Name: "claim", Namespace: "default"},
+			Spec: hackathonv1.ExperimentClaimSpec{Pool: "pool", Mentors: []hackathonv1.ExperimentSubject{
+				{Kind: hackathonv1.ExperimentSubjectServiceAccount, Name: "bot"},
+			}},
+		}
+		Expect(allowed(newAccessRequest("alice", claim, nil))).To(BeFalse())
+		claim.Spec.Mentors = nil
+		claim.Spec.Owner = &hackathonv1.ExperimentSubject{Kind: hackathonv1.ExperimentSubjectServiceAccount, Name: "bot"}
+		Expect(allowed(newAccessRequest("system:serviceaccount:default:bot", claim, nil))).To(BeTrue())
+	})
+
+	It("grants access role binding only when webhook guards owner", func() {
+		enabled := AccessWebhookEnabled
+		defer func() { AccessWebhookEnabled = enabled }()
+		newAccess := func(cli client.Client, rs *ResourceState) *Access {
+			return &Access{client: cli, status: NewStatus(newAccessExperiment("alice")), resourceState: rs, logger: zap.New()}
+		}
+
+		AccessWebhookEnabled = false
+		cli := &actionClient{}
+		_, err := newAccess(cli, &ResourceState{}).Reconcile(context.Background()).Aggregate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cli.created).To(BeEmpty())
+
+		AccessWebhookEnabled = true
+		_, err = newAccess(cli, &ResourceState{}).Reconcile(context.Background()).Aggregate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cli.created).To(HaveLen(2))
+
+		AccessWebhookEnabled = false
+		role, binding, err := buildExpectedAccess(newAccessExperiment("alice"), newAccessExperiment("alice").Subjects())
+		Expect(err).NotTo(HaveOccurred())
+		access := newAccess(cli, &ResourceState{AccessRole: role, AccessBinding: binding})
+		_, err = access.Reconcile(context.Background()).Aggregate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cli.deleted).To(HaveLen(2))
+		Expect(access.status.Events[0].EventType).To(Equal(corev1.EventTypeWarning))
+	})
+})
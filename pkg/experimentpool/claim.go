@@ -0,0 +1,205 @@
+package experimentpool
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// poolNotFoundRequeue is the delay before claim of a missing pool is retried
+const poolNotFoundRequeue = 30 * time.Second
+
+type ClaimController struct {
+	Client client.Client
+	Logger logr.Logger
+}
+
+// Reconcile binds claim to a ready experiment of pool, the experiment is relabeled,
+// owned by claim and its credentials are rotated so that the previous state is not reused.
+// Rotation recreates the env pod, claim reports the experiment provisioning until the new pod is ready
+func (c *ClaimController) Reconcile(ctx context.Context, status *ClaimStatus) *results.Results {
+	result := results.NewResults(ctx)
+	claim := status.Claim
+
+	expr, err := c.boundExperiment(ctx, claim)
+	if err != nil {
+		return result.WithError(err)
+	}
+	if expr == nil && claim.Status.Experiment != "" {
+		if claim.Status.Phase != hackathonv1.ExperimentClaimLost {
+			status.AddEvent(corev1.EventTypeWarning, event.ReasonDeleted, fmt.Sprintf("bound experiment %s deleted", claim.Status.Experiment))
+		}
+		status.Status.Phase = hackathonv1.ExperimentClaimLost
+		status.Status.Status = ""
+		status.Status.URL = ""
+		return result
+	}
+	if expr != nil {
+		status.Status.Phase = hackathonv1.ExperimentClaimBound
+		status.Status.Experiment = expr.Name
+		status.Status.Status, status.Status.URL = boundState(expr)
+		if status.Status.BoundTime == nil {
+			now := metav1.Now()
+			status.Status.BoundTime = &now
+		}
+		return result
+	}
+
+	status.Status.Phase = hackathonv1.ExperimentClaimPending
+	pool := &hackathonv1.ExperimentPool{}
+	if err = c.Client.Get(ctx, types.NamespacedName{Namespace: claim.Namespace, Name: claim.Spec.Pool}, pool); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return result.WithError(fmt.Errorf("query experiment pool failed: %s", err.Error()))
+		}
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, fmt.Sprintf("experiment pool %s not found", claim.Spec.Pool))
+		return result.With("wait-pool-created", func() (reconcile.Result, error) {
+			return reconcile.Result{RequeueAfter: poolNotFoundRequeue}, nil
+		})
+	}
+
+	candidates, err := c.readyExperiments(ctx, pool)
+	if err != nil {
+		return result.WithError(err)
+	}
+	// claim is requeued by controller once a pooled experiment gets ready
+	if len(candidates) == 0 {
+		c.Logger.Info("no ready experiment in pool", "pool", pool.Name)
+		return result
+	}
+
+	bound := candidates[0].DeepCopy()
+	if err = c.bind(ctx, claim, pool, bound); err != nil {
+		if errors.IsConflict(err) {
+			// the experiment is taken by another claim
+			return result.With("retry-bind", func() (reconcile.Result, error) {
+				return reconcile.Result{Requeue: true}, nil
+			})
+		}
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonUpdated, fmt.Sprintf("bind experiment %s failed: %s", bound.Name, err.Error()))
+		return result.WithError(fmt.Errorf("bind experiment failed: %s", err.Error()))
+	}
+	now := metav1.Now()
+	status.Status.Phase = hackathonv1.ExperimentClaimBound
+	status.Status.Experiment = bound.Name
+	status.Status.BoundTime = &now
+	status.Status.Status, status.Status.URL = boundState(bound)
+	status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("bind experiment %s of pool %s", bound.Name, pool.Name))
+	return result
+}
+
+// boundExperiment finds experiment by claim label if claim status was not saved after binding
+func (c *ClaimController) boundExperiment(ctx context.Context, claim *hackathonv1.ExperimentClaim) (*hackathonv1.Experiment, error) {
+	if name := claim.Status.Experiment; name != "" {
+		expr := &hackathonv1.Experiment{}
+		if err := c.Client.Get(ctx, types.NamespacedName{Namespace: claim.Namespace, Name: name}, expr); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("query bound experiment failed: %s", err.Error())
+			}
+			return nil, nil
+		}
+		if !metav1.IsControlledBy(expr, claim) {
+			// cache has not observed the binding yet
+			return nil, fmt.Errorf("experiment %s is not controlled by claim", name)
+		}
+		return expr, nil
+	}
+
+	exprList := &hackathonv1.ExperimentList{}
+	if err := c.Client.List(ctx, exprList, client.InNamespace(claim.Namespace), client.MatchingLabels{LabelKeyClaim: claim.Name}); err != nil {
+		return nil, fmt.Errorf("list bound experiments failed: %s", err.Error())
+	}
+	for i := range exprList.Items {
+		if metav1.IsControlledBy(&exprList.Items[i], claim) {
+			return &exprList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// readyExperiments returns unassigned available experiments matching pool template, oldest first
+func (c *ClaimController) readyExperiments(ctx context.Context, pool *hackathonv1.ExperimentPool) ([]hackathonv1.Experiment, error) {
+	hash, err := templateHash(pool)
+	if err != nil {
+		return nil, err
+	}
+	exprList := &hackathonv1.ExperimentList{}
+	if err = c.Client.List(ctx, exprList, client.InNamespace(pool.Namespace), client.MatchingLabels{LabelKeyExperimentPool: pool.Name}); err != nil {
+		return nil, fmt.Errorf("list experiments of pool failed: %s", err.Error())
+	}
+	candidates := make([]hackathonv1.Experiment, 0)
+	for _, expr := range exprList.Items {
+		if _, ok := expr.Labels[LabelKeyClaim]; ok {
+			continue
+		}
+		if metav1.IsControlledBy(&expr, pool) && expr.DeletionTimestamp.IsZero() &&
+			expr.Annotations[AnnotationKeyTemplateHash] == hash && experiment.Available(&expr) {
+			candidates = append(candidates, expr)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+	})
+	return candidates, nil
+}
+
+// bind moves controller of experiment from pool to claim, the update fails with conflict
+// if the experiment is changed, such as bound by another claim
+func (c *ClaimController) bind(ctx context.Context, claim *hackathonv1.ExperimentClaim, pool *hackathonv1.ExperimentPool, expr *hackathonv1.Experiment) error {
+	owners := make([]metav1.OwnerReference, 0)
+	for _, ref := range expr.OwnerReferences {
+		if ref.UID != pool.UID {
+			owners = append(owners, ref)
+		}
+	}
+	expr.OwnerReferences = owners
+	if err := controllerutil.SetControllerReference(claim, expr.GetObjectMeta(), scheme.Scheme); err != nil {
+		return fmt.Errorf("set experiment owner ref failed: %s", err.Error())
+	}
+
+	for k, v := range claim.Spec.Labels {
+		expr.Labels[k] = v
+	}
+	expr.Labels[LabelKeyClaim] = claim.Name
+	if claim.Spec.AuthorizedKeys != nil {
+		expr.Spec.AuthorizedKeys = append([]hackathonv1.AuthorizedKeySource{}, claim.Spec.AuthorizedKeys...)
+	}
+	if claim.Spec.Owner != nil {
+		expr.Spec.Owner = claim.Spec.Owner.DeepCopy()
+	}
+	if claim.Spec.Mentors != nil {
+		expr.Spec.Mentors = append([]hackathonv1.ExperimentSubject{}, claim.Spec.Mentors...)
+	}
+	expr.Spec.CredentialsRotation++
+	if expr.Annotations == nil {
+		expr.Annotations = map[string]string{}
+	}
+	expr.Annotations[AnnotationKeyBoundRotation] = strconv.FormatInt(expr.Spec.CredentialsRotation, 10)
+
+	c.Logger.Info("bind experiment", "experiment", expr.Name, "pool", pool.Name)
+	return c.Client.Update(ctx, expr)
+}
+
+// boundState returns status and url of bound experiment, the experiment is provisioning until
+// the rotation requested by binding is carried out, as its status still describes the pod before binding
+func boundState(expr *hackathonv1.Experiment) (hackathonv1.ExperimentEnvStatus, string) {
+	rotation, err := strconv.ParseInt(expr.Annotations[AnnotationKeyBoundRotation], 10, 64)
+	if err == nil && expr.Status.ObservedCredentialsRotation < rotation {
+		return hackathonv1.ExperimentProvisioning, ""
+	}
+	return expr.Status.Status, expr.Status.URL
+}
@@ -0,0 +1,146 @@
+package experimentpool
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// claimClient serves a pool and its experiments, updates replace the served experiment
+type claimClient struct {
+	client.Client
+	pool        *hackathonv1.ExperimentPool
+	experiments []hackathonv1.Experiment
+}
+
+func (c *claimClient) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *hackathonv1.ExperimentPool:
+		if c.pool == nil || c.pool.Name != key.Name {
+			return errors.NewNotFound(schema.GroupResource{}, key.Name)
+		}
+		c.pool.DeepCopyInto(o)
+		return nil
+	case *hackathonv1.Experiment:
+		for i := range c.experiments {
+			if c.experiments[i].Name == key.Name {
+				c.experiments[i].DeepCopyInto(o)
+				return nil
+			}
+		}
+	}
+	return errors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *claimClient) List(_ context.Context, obj runtime.Object, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	list := obj.(*hackathonv1.ExperimentList)
+	for _, expr := range c.experiments {
+		if listOpts.LabelSelector == nil || listOpts.LabelSelector.Matches(labels.Set(expr.Labels)) {
+			list.Items = append(list.Items, expr)
+		}
+	}
+	return nil
+}
+
+func (c *claimClient) Update(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+	expr := obj.(*hackathonv1.Experiment)
+	for i := range c.experiments {
+		if c.experiments[i].Name == expr.Name {
+			expr.DeepCopyInto(&c.experiments[i])
+		}
+	}
+	return nil
+}
+
+func newPooledExperiment(pool *hackathonv1.ExperimentPool) hackathonv1.Experiment {
+	hash, err := templateHash(pool)
+	Expect(err).NotTo(HaveOccurred())
+	expr, err := buildPooledExperiment(pool, hash)
+	Expect(err).NotTo(HaveOccurred())
+	expr.Name = "pool-abcde"
+	expr.Status.Status = hackathonv1.ExperimentRunning
+	expr.Status.Conditions = []hackathonv1.ExperimentCondition{hackathonv1.NewExperimentCondition(
+		hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue, "EndpointsReady", "")}
+	expr.Status.URL = "http://pool-abcde.example.com/"
+	return *expr
+}
+
+var _ = Describe("experimentpool-claim", func() {
+	var (
+		cli   *claimClient
+		c     *ClaimController
+		claim *hackathonv1.ExperimentClaim
+	)
+	BeforeEach(func() {
+		pool := &hackathonv1.ExperimentPool{
+			ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default", UID: "pool-uid"},
+			Spec: hackathonv1.ExperimentPoolSpec{
+				Size:     1,
+				Template: hackathonv1.ExperimentTemplateSpec{Spec: hackathonv1.ExperimentSpec{Template: "ubuntu"}},
+			},
+		}
+		cli = &claimClient{pool: pool, experiments: []hackathonv1.Experiment{newPooledExperiment(pool)}}
+		c = &ClaimController{Client: cli, Logger: zap.New()}
+		claim = &hackathonv1.ExperimentClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "claim", Namespace: "default", UID: "claim-uid"},
+			Spec:       hackathonv1.ExperimentClaimSpec{Pool: "pool"},
+		}
+	})
+
+	It("binds ready experiment and rotates its credentials", func() {
+		status := NewClaimStatus(claim)
+		_, err := c.Reconcile(context.Background(), status).Aggregate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Status.Phase).To(Equal(hackathonv1.ExperimentClaimBound))
+		Expect(status.Status.Experiment).To(Equal("pool-abcde"))
+
+		bound := &cli.experiments[0]
+		Expect(metav1.IsControlledBy(bound, claim)).To(BeTrue())
+		Expect(bound.Labels[LabelKeyClaim]).To(Equal("claim"))
+		Expect(bound.Spec.CredentialsRotation).To(BeEquivalentTo(1))
+		Expect(bound.Annotations[AnnotationKeyBoundRotation]).To(Equal("1"))
+	})
+
+	It("reports experiment provisioning until bound rotation is carried out", func() {
+		status := NewClaimStatus(claim)
+		c.Reconcile(context.Background(), status)
+		Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentProvisioning))
+		Expect(status.Status.URL).To(BeEmpty())
+
+		// experiment still reports the pod created before binding
+		_, claim = status.Apply()
+		status = NewClaimStatus(claim)
+		c.Reconcile(context.Background(), status)
+		Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentProvisioning))
+
+		cli.experiments[0].Status.ObservedCredentialsRotation = 1
+		cli.experiments[0].Status.Status = hackathonv1.ExperimentProvisioning
+		status = NewClaimStatus(claim)
+		c.Reconcile(context.Background(), status)
+		Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentProvisioning))
+
+		cli.experiments[0].Status.Status = hackathonv1.ExperimentRunning
+		status = NewClaimStatus(claim)
+		c.Reconcile(context.Background(), status)
+		Expect(status.Status.Status).To(Equal(hackathonv1.ExperimentRunning))
+		Expect(status.Status.URL).To(Equal("http://pool-abcde.example.com/"))
+	})
+
+	It("waits for pool experiments to get ready", func() {
+		cli.experiments[0].Status.Status = hackathonv1.ExperimentProvisioning
+		status := NewClaimStatus(claim)
+		c.Reconcile(context.Background(), status)
+		Expect(status.Status.Phase).To(Equal(hackathonv1.ExperimentClaimPending))
+		Expect(cli.experiments[0].Labels).NotTo(HaveKey(LabelKeyClaim))
+	})
+})
@@ -0,0 +1,10 @@
+package experimentpool
+
+const (
+	LabelKeyExperimentPool = "hackathon.kaiyuanshe.cn/experiment-pool"
+	LabelKeyClaim          = "hackathon.kaiyuanshe.cn/experiment-claim"
+	// AnnotationKeyTemplateHash is the hash of pool template which pooled experiment is created from
+	AnnotationKeyTemplateHash = "hackathon.kaiyuanshe.cn/experiment-pool-hash"
+	// AnnotationKeyBoundRotation is the credentials rotation requested when experiment is bound to claim
+	AnnotationKeyBoundRotation = "hackathon.kaiyuanshe.cn/experiment-claim-rotation"
+)
@@ -0,0 +1,145 @@
+package experimentpool
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/k8stools"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sort"
+)
+
+type PoolController struct {
+	Client client.Client
+	// APIReader lists pooled experiments without cache lag, so that a refill is not repeated
+	APIReader client.Reader
+	Logger    logr.Logger
+}
+
+// Reconcile keeps spec size of unassigned experiments matching current template,
+// outdated experiments are deleted once enough new ones are ready
+func (c *PoolController) Reconcile(ctx context.Context, status *PoolStatus) *results.Results {
+	result := results.NewResults(ctx)
+	pool := status.Pool
+
+	hash, err := templateHash(pool)
+	if err != nil {
+		return result.WithError(err)
+	}
+	exprList := &hackathonv1.ExperimentList{}
+	if err = c.APIReader.List(ctx, exprList, client.InNamespace(pool.Namespace), client.MatchingLabels{LabelKeyExperimentPool: pool.Name}); err != nil {
+		return result.WithError(fmt.Errorf("list experiments of pool failed: %s", err.Error()))
+	}
+
+	var claimed int32
+	upToDate := make([]*hackathonv1.Experiment, 0)
+	outdated := make([]*hackathonv1.Experiment, 0)
+	for i := range exprList.Items {
+		expr := &exprList.Items[i]
+		if _, ok := expr.Labels[LabelKeyClaim]; ok {
+			claimed++
+			continue
+		}
+		if !metav1.IsControlledBy(expr, pool) || !expr.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if expr.Annotations[AnnotationKeyTemplateHash] == hash {
+			upToDate = append(upToDate, expr)
+		} else {
+			outdated = append(outdated, expr)
+		}
+	}
+
+	size := int(pool.Spec.Size)
+	for i := len(upToDate); i < size; i++ {
+		expr, err := buildPooledExperiment(pool, hash)
+		if err != nil {
+			return result.WithError(err)
+		}
+		if err = c.Client.Create(ctx, expr); err != nil {
+			status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("refill pool failed: %s", err.Error()))
+			return result.WithError(fmt.Errorf("create pooled experiment failed: %s", err.Error()))
+		}
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("create pooled experiment %s", expr.Name))
+	}
+
+	// unavailable experiments are deleted first when pool shrinks
+	sort.SliceStable(upToDate, func(i, j int) bool {
+		return experiment.Available(upToDate[i]) && !experiment.Available(upToDate[j])
+	})
+	deleting := make([]*hackathonv1.Experiment, 0)
+	if len(upToDate) > size {
+		deleting = append(deleting, upToDate[size:]...)
+		upToDate = upToDate[:size]
+	}
+	var ready int32
+	for _, expr := range upToDate {
+		if experiment.Available(expr) {
+			ready++
+		}
+	}
+	for _, expr := range outdated {
+		if !experiment.Available(expr) || ready >= pool.Spec.Size {
+			deleting = append(deleting, expr)
+		}
+	}
+	for _, expr := range deleting {
+		c.Logger.Info("delete pooled experiment", "experiment", expr.Name)
+		if err = client.IgnoreNotFound(c.Client.Delete(ctx, expr)); err != nil {
+			return result.WithError(fmt.Errorf("delete pooled experiment %s failed: %s", expr.Name, err.Error()))
+		}
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonDeleted, fmt.Sprintf("delete pooled experiment %s", expr.Name))
+	}
+
+	status.Status.Size = int32(len(upToDate))
+	status.Status.Ready = ready
+	status.Status.Claimed = claimed
+	status.Status.ObservedGeneration = pool.Generation
+	return result
+}
+
+func templateHash(pool *hackathonv1.ExperimentPool) (string, error) {
+	hash, err := k8stools.HashObject(&pool.Spec.Template)
+	if err != nil {
+		return "", fmt.Errorf("hash pool template failed: %s", err.Error())
+	}
+	return hash, nil
+}
+
+func buildPooledExperiment(pool *hackathonv1.ExperimentPool, hash string) (*hackathonv1.Experiment, error) {
+	tmpl := &pool.Spec.Template
+	labels := map[string]string{}
+	for k, v := range tmpl.Labels {
+		labels[k] = v
+	}
+	labels[LabelKeyExperimentPool] = pool.Name
+	annotations := map[string]string{}
+	for k, v := range tmpl.Annotations {
+		annotations[k] = v
+	}
+	annotations[AnnotationKeyTemplateHash] = hash
+
+	expr := &hackathonv1.Experiment{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-", pool.Name),
+			Namespace:    pool.Namespace,
+			Labels:       labels,
+			Annotations:  annotations,
+		},
+		Spec: *tmpl.Spec.DeepCopy(),
+	}
+	// pooled experiments are kept running, so that claims only wait for the env pod restarted on binding
+	expr.Spec.Pause = false
+	if err := controllerutil.SetControllerReference(pool, expr.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("set pooled experiment owner ref failed: %s", err.Error())
+	}
+	return expr, nil
+}
@@ -0,0 +1,55 @@
+package experimentpool
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"reflect"
+)
+
+type PoolStatus struct {
+	*event.Recorder
+	Pool   *hackathonv1.ExperimentPool
+	Status *hackathonv1.ExperimentPoolStatus
+}
+
+func (s *PoolStatus) Apply() ([]event.Event, *hackathonv1.ExperimentPool) {
+	pre, crt := s.Pool.Status, s.Status
+	if reflect.DeepEqual(pre, crt) {
+		return s.Events, nil
+	}
+	pool := s.Pool
+	pool.Status = *crt
+	return s.Events, pool
+}
+
+func NewPoolStatus(pool *hackathonv1.ExperimentPool) *PoolStatus {
+	return &PoolStatus{
+		Recorder: event.NewEventRecorder(),
+		Pool:     pool,
+		Status:   pool.Status.DeepCopy(),
+	}
+}
+
+type ClaimStatus struct {
+	*event.Recorder
+	Claim  *hackathonv1.ExperimentClaim
+	Status *hackathonv1.ExperimentClaimStatus
+}
+
+func (s *ClaimStatus) Apply() ([]event.Event, *hackathonv1.ExperimentClaim) {
+	pre, crt := s.Claim.Status, s.Status
+	if reflect.DeepEqual(pre, crt) {
+		return s.Events, nil
+	}
+	claim := s.Claim
+	claim.Status = *crt
+	return s.Events, claim
+}
+
+func NewClaimStatus(claim *hackathonv1.ExperimentClaim) *ClaimStatus {
+	return &ClaimStatus{
+		Recorder: event.NewEventRecorder(),
+		Claim:    claim,
+		Status:   claim.Status.DeepCopy(),
+	}
+}
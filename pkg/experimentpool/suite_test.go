@@ -0,0 +1,17 @@
+package experimentpool
+
+import (
+	"testing"
+
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestExperimentPool(t *testing.T) {
+	RegisterFailHandler(Fail)
+	// owner references of pooled experiments need pool and claim kinds
+	Expect(hackathonv1.AddToScheme(scheme.Scheme)).To(Succeed())
+	RunSpecs(t, "ExperimentPool Suite")
+}
@@ -0,0 +1,11 @@
+package experimentset
+
+const (
+	LabelKeyExperimentSet = "hackathon.kaiyuanshe.cn/experiment-set"
+	LabelKeyTeam          = "hackathon.kaiyuanshe.cn/team"
+	// AnnotationKeySpecHash is the hash of set spec which child experiment is created or updated from
+	AnnotationKeySpecHash = "hackathon.kaiyuanshe.cn/experiment-set-hash"
+
+	defaultMaxSurge       = "25%"
+	defaultMaxUnavailable = "25%"
+)
@@ -0,0 +1,232 @@
+package experimentset
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type Controller struct {
+	Client client.Client
+	Logger logr.Logger
+}
+
+// Reconcile deletes children of removed teams at once, creates missing children limited by max surge
+// and updates outdated children limited by max unavailable
+func (c *Controller) Reconcile(ctx context.Context, status *Status) *results.Results {
+	result := results.NewResults(ctx)
+	set := status.Set
+
+	members, err := desiredMembers(set)
+	if err != nil {
+		status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation, err.Error())
+		return result.WithError(err)
+	}
+	children, err := c.listChildren(ctx, set)
+	if err != nil {
+		return result.WithError(err)
+	}
+
+	desired := map[string]bool{}
+	for _, m := range members {
+		desired[m.Experiment.Name] = true
+	}
+	existing := map[string]*hackathonv1.Experiment{}
+	for i := range children {
+		child := &children[i]
+		if desired[child.Name] {
+			existing[child.Name] = child
+			continue
+		}
+		if !child.DeletionTimestamp.IsZero() {
+			continue
+		}
+		c.Logger.Info("delete experiment of removed team", "experiment", child.Name)
+		if err = client.IgnoreNotFound(c.Client.Delete(ctx, child)); err != nil {
+			return result.WithError(fmt.Errorf("delete experiment %s failed: %s", child.Name, err.Error()))
+		}
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonDeleted, fmt.Sprintf("delete experiment %s", child.Name))
+	}
+
+	// failed children never become available by waiting, they are left out of surge budget
+	// so that they do not block creating children of other teams
+	maxSurge, maxUnavailable := rolloutLimits(set, len(members))
+	inProgress, unavailable := 0, 0
+	for i := range members {
+		if child, ok := existing[members[i].Experiment.Name]; ok && upToDate(child, &members[i]) && !experiment.Available(child) {
+			unavailable++
+			if child.Status.Status != hackathonv1.ExperimentError {
+				inProgress++
+			}
+		}
+	}
+
+	conflicts := map[string]bool{}
+	created, updated := 0, 0
+	for i := range members {
+		m := &members[i]
+		child, ok := existing[m.Experiment.Name]
+		switch {
+		case !ok:
+			conflict, err := c.nameTaken(ctx, m.Experiment)
+			if err != nil {
+				result.WithError(err)
+				continue
+			}
+			if conflict {
+				conflicts[m.Team] = true
+				continue
+			}
+			if inProgress+created >= maxSurge {
+				continue
+			}
+			if err = c.Client.Create(ctx, m.Experiment); err != nil {
+				status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, fmt.Sprintf("create experiment %s failed: %s", m.Experiment.Name, err.Error()))
+				result.WithError(fmt.Errorf("create experiment %s failed: %s", m.Experiment.Name, err.Error()))
+				continue
+			}
+			created++
+			status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("create experiment %s for team %s", m.Experiment.Name, m.Team))
+		case !upToDate(child, m):
+			// updating an unavailable child does not make the set less available
+			if experiment.Available(child) {
+				if unavailable+updated >= maxUnavailable {
+					continue
+				}
+				updated++
+			}
+			if err = c.updateChild(ctx, child, m); err != nil {
+				status.AddEvent(corev1.EventTypeWarning, event.ReasonUpdated, fmt.Sprintf("update experiment %s failed: %s", child.Name, err.Error()))
+				result.WithError(err)
+				continue
+			}
+			status.AddEvent(corev1.EventTypeNormal, event.ReasonUpdated, fmt.Sprintf("update experiment %s for team %s", child.Name, m.Team))
+		}
+	}
+
+	updateSetStatus(status, members, existing, conflicts)
+	return result
+}
+
+// nameTaken reports whether name of child experiment is used by an experiment not controlled by set,
+// e.g. team b-c of set a and team c of set a-b both map to a-b-c
+func (c *Controller) nameTaken(ctx context.Context, expr *hackathonv1.Experiment) (bool, error) {
+	found := &hackathonv1.Experiment{}
+	err := c.Client.Get(ctx, client.ObjectKey{Namespace: expr.Namespace, Name: expr.Name}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("query experiment %s failed: %s", expr.Name, err.Error())
+	}
+	return true, nil
+}
+
+func (c *Controller) listChildren(ctx context.Context, set *hackathonv1.ExperimentSet) ([]hackathonv1.Experiment, error) {
+	exprList := &hackathonv1.ExperimentList{}
+	if err := c.Client.List(ctx, exprList, client.InNamespace(set.Namespace), client.MatchingLabels{LabelKeyExperimentSet: set.Name}); err != nil {
+		return nil, fmt.Errorf("list experiments of set failed: %s", err.Error())
+	}
+	children := make([]hackathonv1.Experiment, 0)
+	for _, expr := range exprList.Items {
+		if metav1.IsControlledBy(&expr, set) {
+			children = append(children, expr)
+		}
+	}
+	return children, nil
+}
+
+// updateChild replaces spec, labels and annotations managed by set, other metadata of child is kept
+func (c *Controller) updateChild(ctx context.Context, child *hackathonv1.Experiment, m *member) error {
+	expected := child.DeepCopy()
+	expected.Spec = m.Experiment.Spec
+	if expected.Labels == nil {
+		expected.Labels = map[string]string{}
+	}
+	for k, v := range m.Experiment.Labels {
+		expected.Labels[k] = v
+	}
+	if expected.Annotations == nil {
+		expected.Annotations = map[string]string{}
+	}
+	for k, v := range m.Experiment.Annotations {
+		expected.Annotations[k] = v
+	}
+	c.Logger.Info("update experiment of team", "experiment", child.Name, "team", m.Team)
+	if err := c.Client.Update(ctx, expected); err != nil {
+		return fmt.Errorf("update experiment %s failed: %s", child.Name, err.Error())
+	}
+	return nil
+}
+
+func rolloutLimits(set *hackathonv1.ExperimentSet, total int) (int, int) {
+	maxSurge := intstr.FromString(defaultMaxSurge)
+	maxUnavailable := intstr.FromString(defaultMaxUnavailable)
+	if rollout := set.Spec.Rollout; rollout != nil {
+		if rollout.MaxSurge != nil {
+			maxSurge = *rollout.MaxSurge
+		}
+		if rollout.MaxUnavailable != nil {
+			maxUnavailable = *rollout.MaxUnavailable
+		}
+	}
+	return scaledValue(&maxSurge, total, true), scaledValue(&maxUnavailable, total, false)
+}
+
+// scaledValue resolves percent of total, at least one child is processed at a time
+func scaledValue(value *intstr.IntOrString, total int, roundUp bool) int {
+	n, err := intstr.GetValueFromIntOrPercent(value, total, roundUp)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// updateSetStatus aggregates children observed before this reconcile
+func updateSetStatus(status *Status, members []member, existing map[string]*hackathonv1.Experiment, conflicts map[string]bool) {
+	conflicted := map[string]bool{}
+	for _, team := range status.Set.Status.Teams {
+		conflicted[team.Name] = team.Conflict
+	}
+	crt := status.Status
+	crt.ObservedGeneration = status.Set.Generation
+	crt.Replicas, crt.Ready, crt.Updated, crt.Failed = 0, 0, 0, 0
+	crt.Teams = make([]hackathonv1.ExperimentSetTeamStatus, 0, len(members))
+	for i := range members {
+		m := &members[i]
+		teamStatus := hackathonv1.ExperimentSetTeamStatus{Name: m.Team, Experiment: m.Experiment.Name}
+		if child, ok := existing[m.Experiment.Name]; ok {
+			teamStatus.Status = child.Status.Status
+			teamStatus.Ready = experiment.Available(child)
+			teamStatus.Updated = upToDate(child, m)
+			teamStatus.URL = child.Status.URL
+			crt.Replicas++
+		}
+		if conflicts[m.Team] {
+			teamStatus.Conflict = true
+			if !conflicted[m.Team] {
+				status.AddEvent(corev1.EventTypeWarning, event.ReasonValidation,
+					fmt.Sprintf("experiment %s of team %s is taken by another object", m.Experiment.Name, m.Team))
+			}
+		}
+		if teamStatus.Ready {
+			crt.Ready++
+		}
+		if teamStatus.Updated {
+			crt.Updated++
+		}
+		if teamStatus.Status == hackathonv1.ExperimentError {
+			crt.Failed++
+		}
+		crt.Teams = append(crt.Teams, teamStatus)
+	}
+}
@@ -0,0 +1,158 @@
+package experimentset
+
+import (
+	"context"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// setClient lists children of set, finds experiments by name and records created and updated ones
+type setClient struct {
+	client.Client
+	children []hackathonv1.Experiment
+	others   map[string]bool
+	created  []string
+	updated  []string
+}
+
+func (c *setClient) List(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+	obj.(*hackathonv1.ExperimentList).Items = c.children
+	return nil
+}
+
+func (c *setClient) Get(_ context.Context, key client.ObjectKey, _ runtime.Object) error {
+	for _, child := range c.children {
+		if child.Name == key.Name {
+			return nil
+		}
+	}
+	if c.others[key.Name] {
+		return nil
+	}
+	return errors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *setClient) Create(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+	c.created = append(c.created, obj.(*hackathonv1.Experiment).Name)
+	return nil
+}
+
+func (c *setClient) Update(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+	c.updated = append(c.updated, obj.(*hackathonv1.Experiment).Name)
+	return nil
+}
+
+func newExperimentSet(replicas int32, maxSurge, maxUnavailable int) *hackathonv1.ExperimentSet {
+	surge, unavailable := intstr.FromInt(maxSurge), intstr.FromInt(maxUnavailable)
+	return &hackathonv1.ExperimentSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "set", Namespace: "default", UID: "set-uid"},
+		Spec: hackathonv1.ExperimentSetSpec{
+			Replicas: &replicas,
+			Template: hackathonv1.ExperimentTemplateSpec{Spec: hackathonv1.ExperimentSpec{Template: "ubuntu"}},
+			Rollout:  &hackathonv1.ExperimentSetRollout{MaxSurge: &surge, MaxUnavailable: &unavailable},
+		},
+	}
+}
+
+// newChild builds child of team from current set spec in given state
+func newChild(set *hackathonv1.ExperimentSet, team string, state hackathonv1.ExperimentEnvStatus) hackathonv1.Experiment {
+	expr, _, err := buildExperiment(set, &hackathonv1.ExperimentSetTeam{Name: team})
+	Expect(err).NotTo(HaveOccurred())
+	setChildState(expr, state)
+	return *expr
+}
+
+// setChildState moves child to state, running children have endpoints ready
+func setChildState(expr *hackathonv1.Experiment, state hackathonv1.ExperimentEnvStatus) {
+	expr.Status.Status = state
+	if state == hackathonv1.ExperimentRunning {
+		expr.Status.Conditions = []hackathonv1.ExperimentCondition{hackathonv1.NewExperimentCondition(
+			hackathonv1.ExperimentReady, hackathonv1.ExperimentConditionTrue, "EndpointsReady", "")}
+	}
+}
+
+var _ = Describe("experimentset-controller", func() {
+	var (
+		cli *setClient
+		c   *Controller
+	)
+	BeforeEach(func() {
+		cli = &setClient{}
+		c = &Controller{Client: cli, Logger: zap.New()}
+	})
+
+	It("resolves rollout limits from percent of teams", func() {
+		set := newExperimentSet(10, 0, 0)
+		set.Spec.Rollout = nil
+		surge, unavailable := rolloutLimits(set, 10)
+		Expect(surge).To(Equal(3))
+		Expect(unavailable).To(Equal(2))
+
+		value := intstr.FromString("10%")
+		Expect(scaledValue(&value, 4, false)).To(Equal(1))
+		value = intstr.FromString("bad")
+		Expect(scaledValue(&value, 4, true)).To(Equal(1))
+	})
+
+	It("creates missing children limited by max surge", func() {
+		set := newExperimentSet(4, 1, 1)
+		cli.children = []hackathonv1.Experiment{newChild(set, "0", hackathonv1.ExperimentCreated)}
+		_, err := c.Reconcile(context.Background(), NewStatus(set)).Aggregate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cli.created).To(BeEmpty())
+
+		setChildState(&cli.children[0], hackathonv1.ExperimentRunning)
+		c.Reconcile(context.Background(), NewStatus(set))
+		Expect(cli.created).To(Equal([]string{"set-1"}))
+	})
+
+	It("does not let failed children block creating others", func() {
+		set := newExperimentSet(3, 1, 1)
+		cli.children = []hackathonv1.Experiment{newChild(set, "0", hackathonv1.ExperimentError)}
+		status := NewStatus(set)
+		c.Reconcile(context.Background(), status)
+		Expect(cli.created).To(Equal([]string{"set-1"}))
+		Expect(status.Status.Failed).To(BeEquivalentTo(1))
+	})
+
+	It("keeps failed children in max unavailable budget", func() {
+		set := newExperimentSet(2, 1, 1)
+		cli.children = []hackathonv1.Experiment{
+			newChild(set, "0", hackathonv1.ExperimentError),
+			newChild(set, "1", hackathonv1.ExperimentRunning),
+		}
+		cli.children[1].Annotations[AnnotationKeySpecHash] = "outdated"
+		c.Reconcile(context.Background(), NewStatus(set))
+		Expect(cli.updated).To(BeEmpty())
+
+		setChildState(&cli.children[0], hackathonv1.ExperimentRunning)
+		c.Reconcile(context.Background(), NewStatus(set))
+		Expect(cli.updated).To(Equal([]string{"set-1"}))
+	})
+
+	It("reports teams whose experiment name is taken", func() {
+		set := newExperimentSet(2, 2, 1)
+		cli.others = map[string]bool{"set-1": true}
+		status := NewStatus(set)
+		c.Reconcile(context.Background(), status)
+		Expect(cli.created).To(Equal([]string{"set-0"}))
+		Expect(status.Status.Teams[0].Conflict).To(BeFalse())
+		Expect(status.Status.Teams[1].Conflict).To(BeTrue())
+		Expect(status.Events).To(ContainElement(WithTransform(func(e event.Event) string { return e.Reason }, Equal(event.ReasonValidation))))
+
+		_, set = status.Apply()
+		status = NewStatus(set)
+		c.Reconcile(context.Background(), status)
+		Expect(status.Status.Teams[1].Conflict).To(BeTrue())
+		Expect(status.Events).NotTo(ContainElement(WithTransform(func(e event.Event) string { return e.Reason }, Equal(event.ReasonValidation))))
+	})
+})
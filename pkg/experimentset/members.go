@@ -0,0 +1,122 @@
+package experimentset
+
+import (
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/k8stools"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strconv"
+)
+
+// member is the desired child experiment of a team
+type member struct {
+	Team       string
+	Experiment *hackathonv1.Experiment
+	Hash       string
+}
+
+func experimentName(set, team string) string {
+	return fmt.Sprintf("%s-%s", set, team)
+}
+
+// desiredMembers returns members in order of teams, or of index if teams not listed
+func desiredMembers(set *hackathonv1.ExperimentSet) ([]member, error) {
+	teams := set.Spec.Teams
+	if len(teams) == 0 && set.Spec.Replicas != nil {
+		for i := 0; i < int(*set.Spec.Replicas); i++ {
+			teams = append(teams, hackathonv1.ExperimentSetTeam{Name: strconv.Itoa(i)})
+		}
+	}
+
+	members := make([]member, 0, len(teams))
+	seen := map[string]bool{}
+	for i := range teams {
+		team := &teams[i]
+		if seen[team.Name] {
+			return nil, fmt.Errorf("duplicate team %s", team.Name)
+		}
+		seen[team.Name] = true
+
+		expr, hash, err := buildExperiment(set, team)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member{Team: team.Name, Experiment: expr, Hash: hash})
+	}
+	return members, nil
+}
+
+// buildExperiment merges team labels and override into template, the hash of result is recorded in annotation
+func buildExperiment(set *hackathonv1.ExperimentSet, team *hackathonv1.ExperimentSetTeam) (*hackathonv1.Experiment, string, error) {
+	tmpl := &set.Spec.Template
+	spec := tmpl.Spec.DeepCopy()
+	applyOverride(spec, team.Override)
+
+	labels := map[string]string{}
+	for k, v := range tmpl.Labels {
+		labels[k] = v
+	}
+	for k, v := range team.Labels {
+		labels[k] = v
+	}
+	labels[LabelKeyExperimentSet] = set.Name
+	labels[LabelKeyTeam] = team.Name
+	annotations := map[string]string{}
+	for k, v := range tmpl.Annotations {
+		annotations[k] = v
+	}
+
+	expr := &hackathonv1.Experiment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        experimentName(set.Name, team.Name),
+			Namespace:   set.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *spec,
+	}
+	hash, err := k8stools.HashObject(expr)
+	if err != nil {
+		return nil, "", fmt.Errorf("hash experiment of team %s failed: %s", team.Name, err.Error())
+	}
+	annotations[AnnotationKeySpecHash] = hash
+
+	if err = controllerutil.SetControllerReference(set, expr.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, "", fmt.Errorf("set experiment owner ref failed: %s", err.Error())
+	}
+	return expr, hash, nil
+}
+
+func applyOverride(spec *hackathonv1.ExperimentSpec, override *hackathonv1.ExperimentOverride) {
+	if override == nil {
+		return
+	}
+	if override.Pause != nil {
+		spec.Pause = *override.Pause
+	}
+	if override.Source != nil {
+		spec.Source = override.Source.DeepCopy()
+	}
+	if override.DataVolumeSize != nil {
+		size := override.DataVolumeSize.DeepCopy()
+		spec.DataVolumeSize = &size
+	}
+	if override.Resources != nil {
+		spec.Resources = override.Resources.DeepCopy()
+	}
+	if override.AuthorizedKeys != nil {
+		spec.AuthorizedKeys = append([]hackathonv1.AuthorizedKeySource{}, override.AuthorizedKeys...)
+	}
+	if override.Owner != nil {
+		spec.Owner = override.Owner.DeepCopy()
+	}
+	if override.Mentors != nil {
+		spec.Mentors = append([]hackathonv1.ExperimentSubject{}, override.Mentors...)
+	}
+}
+
+func upToDate(expr *hackathonv1.Experiment, m *member) bool {
+	return expr.Annotations[AnnotationKeySpecHash] == m.Hash
+}
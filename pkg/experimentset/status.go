@@ -0,0 +1,31 @@
+package experimentset
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"reflect"
+)
+
+type Status struct {
+	*event.Recorder
+	Set    *hackathonv1.ExperimentSet
+	Status *hackathonv1.ExperimentSetStatus
+}
+
+func (s *Status) Apply() ([]event.Event, *hackathonv1.ExperimentSet) {
+	pre, crt := s.Set.Status, s.Status
+	if reflect.DeepEqual(pre, crt) {
+		return s.Events, nil
+	}
+	set := s.Set
+	set.Status = *crt
+	return s.Events, set
+}
+
+func NewStatus(set *hackathonv1.ExperimentSet) *Status {
+	return &Status{
+		Recorder: event.NewEventRecorder(),
+		Set:      set,
+		Status:   set.Status.DeepCopy(),
+	}
+}
@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"net/http"
+	"strings"
+)
+
+// accessTokenParam carries the kubernetes token of user since browsers can not set
+// headers of websocket requests
+const accessTokenParam = "access_token"
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// authenticate reviews the kubernetes token of request, the token is only accepted in query
+// if allowQuery, as urls end up in logs and browser history
+func (g *Gateway) authenticate(ctx context.Context, req *http.Request, allowQuery bool) (*authenticationv1.UserInfo, error) {
+	token := ""
+	if allowQuery {
+		token = req.URL.Query().Get(accessTokenParam)
+	}
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("access token is required")
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	if err := g.Client.Create(ctx, review); err != nil {
+		return nil, fmt.Errorf("review access token failed: %s", err.Error())
+	}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("access token not authenticated: %s", review.Status.Error)
+	}
+	return &review.Status.User, nil
+}
+
+// authorize checks user of websocket request is owner or mentor of target experiment
+func (g *Gateway) authorize(ctx context.Context, req *http.Request, target *endpointTarget) (int, error) {
+	user, err := g.authenticate(ctx, req, true)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if !target.Experiment.Authorized(user.Username, user.Groups) {
+		g.Logger.Info("user is not owner or mentor of experiment", "user", user.Username,
+			"namespace", target.Experiment.Namespace, "experiment", target.Experiment.Name)
+		return http.StatusForbidden, fmt.Errorf("%s is not owner or mentor of experiment %s", user.Username, target.Experiment.Name)
+	}
+	return http.StatusOK, nil
+}
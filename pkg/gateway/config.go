@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"time"
+)
+
+const (
+	VNCPath         = "/vnc"
+	SSHPath         = "/ssh"
+	CredentialsPath = "/credentials"
+)
+
+var (
+	// Addr is the listen address of gateway, gateway is disabled if empty
+	Addr string
+	// URL is the external websocket base url of gateway, such as wss://gateway.example.com
+	URL string
+	// AllowedOrigins are comma separated origins of pages opening gateway websockets besides gateway url,
+	// such as https://hackathon.example.com
+	AllowedOrigins string
+	Secret         string
+	TokenTTL       = time.Hour
+	// TLSCertFile and TLSKeyFile let gateway serve https, otherwise tls must be terminated by a proxy in front
+	// of gateway which sets X-Forwarded-Proto, credentials are never served over plain http
+	TLSCertFile string
+	TLSKeyFile  string
+	// DialTimeout of experiment services
+	DialTimeout = 10 * time.Second
+	// SSHIdleTimeout closes terminal sessions without input
+	SSHIdleTimeout = 30 * time.Minute
+	// RequireOwner only lets owner and mentors of experiment connect, besides the signed url
+	// the kubernetes token of user is required. If disabled anyone holding a signed url can connect
+	RequireOwner = true
+)
+
+// protocolPaths are the handlers of endpoint protocols served by gateway
+var protocolPaths = map[hackathonv1.ExperimentIngressProtocol]string{
+	hackathonv1.ExperimentIngressVNC: VNCPath,
+	hackathonv1.ExperimentIngressSSH: SSHPath,
+}
+
+func Enabled() bool {
+	return Addr != "" && URL != "" && Secret != ""
+}
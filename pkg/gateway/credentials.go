@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type credentialsResponse struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Key      string `json:"key,omitempty"`
+	// URL is the signed websocket url of vnc and ssh endpoints, valid for TokenTTL
+	URL string `json:"url,omitempty"`
+}
+
+// serveCredentials returns credentials and signed gateway url of an endpoint to owner and mentors
+// of experiment, the endpoint is selected by namespace, experiment and endpoint query parameters.
+// Signed urls are only handed out here, so that they are never readable from experiment status.
+// The access token must be sent in Authorization header over https, and experiments which do not
+// exist or are not accessible to user are answered alike, so that they can not be told apart
+func (g *Gateway) serveCredentials(w http.ResponseWriter, req *http.Request) {
+	if !secureRequest(req) {
+		http.Error(w, "credentials are only served over https", http.StatusForbidden)
+		return
+	}
+	user, err := g.authenticate(req.Context(), req, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	query := req.URL.Query()
+	target, err := g.lookupEndpoint(req.Context(), &Token{
+		Namespace:  query.Get("namespace"),
+		Experiment: query.Get("experiment"),
+		Endpoint:   query.Get("endpoint"),
+	}, "")
+	if err == nil && !target.Experiment.Authorized(user.Username, user.Groups) {
+		err = fmt.Errorf("%s is not owner or mentor of experiment", user.Username)
+	}
+	if err == nil {
+		err = g.loadCredentials(req.Context(), target)
+	}
+	if err != nil {
+		g.Logger.Info("credentials request rejected", "user", user.Username, "namespace", query.Get("namespace"),
+			"experiment", query.Get("experiment"), "endpoint", query.Get("endpoint"), "error", err.Error())
+		http.Error(w, "endpoint not found", http.StatusNotFound)
+		return
+	}
+
+	resp := &credentialsResponse{
+		Username: target.Username,
+		Password: target.Password,
+		Key:      target.Key,
+	}
+	if path, ok := protocolPaths[target.Endpoint.Protocol]; ok {
+		if resp.URL, _, err = SignedURL(path, target.Experiment.Namespace, target.Experiment.Name, target.Endpoint.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// secureRequest tells whether request is sent over https, directly or through a proxy terminating tls
+func secureRequest(req *http.Request) bool {
+	return req.TLS != nil || strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https")
+}
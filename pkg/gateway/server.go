@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"golang.org/x/net/websocket"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	"net/http"
+	"net/url"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+type endpointKey struct{}
+
+type endpointTarget struct {
+	Experiment *hackathonv1.Experiment
+	Endpoint   *hackathonv1.ExperimentEndpointStatus
+	Username   string
+	Password   string
+	Key        string
+}
+
+// Gateway proxies browser websocket connections to experiment endpoints
+type Gateway struct {
+	Client client.Client
+	Logger logr.Logger
+}
+
+// NeedLeaderElection is false so that every manager replica serves gateway
+func (g *Gateway) NeedLeaderElection() bool {
+	return false
+}
+
+func (g *Gateway) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(VNCPath, g.websocketHandler(hackathonv1.ExperimentIngressVNC, g.serveVNC))
+	mux.Handle(SSHPath, g.websocketHandler(hackathonv1.ExperimentIngressSSH, g.serveSSH))
+	mux.HandleFunc(CredentialsPath, g.serveCredentials)
+
+	server := &http.Server{Addr: Addr, Handler: mux}
+	errCh := make(chan error, 1)
+	go func() {
+		if TLSCertFile != "" && TLSKeyFile != "" {
+			g.Logger.Info("starting gateway", "addr", Addr, "tls", true)
+			errCh <- server.ListenAndServeTLS(TLSCertFile, TLSKeyFile)
+			return
+		}
+		// credentials are only served to requests forwarded by a proxy terminating tls
+		g.Logger.Info("starting gateway", "addr", Addr, "tls", false)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-stop:
+		return server.Shutdown(context.Background())
+	case err := <-errCh:
+		return err
+	}
+}
+
+// websocketHandler checks origin and authorizes request by token before upgrading to websocket
+func (g *Gateway) websocketHandler(protocol hackathonv1.ExperimentIngressProtocol, handler func(*websocket.Conn)) http.Handler {
+	ws := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			// noVNC requests binary subprotocol
+			for _, p := range config.Protocol {
+				if p == "binary" {
+					config.Protocol = []string{p}
+					return nil
+				}
+			}
+			config.Protocol = nil
+			return nil
+		},
+		Handler: handler,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := checkOrigin(req.Header.Get("Origin")); err != nil {
+			g.Logger.Info("websocket origin rejected", "origin", req.Header.Get("Origin"))
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		token, err := ParseToken([]byte(Secret), req.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		target, err := g.lookupEndpoint(req.Context(), token, protocol)
+		if err != nil {
+			g.Logger.Info("lookup endpoint failed", "experiment", token.Experiment, "endpoint", token.Endpoint, "error", err.Error())
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if RequireOwner {
+			if code, err := g.authorize(req.Context(), req, target); err != nil {
+				http.Error(w, err.Error(), code)
+				return
+			}
+		}
+		if err = g.loadCredentials(req.Context(), target); err != nil {
+			g.Logger.Info("load endpoint credentials failed", "experiment", token.Experiment, "endpoint", token.Endpoint, "error", err.Error())
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		ws.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), endpointKey{}, target)))
+	})
+}
+
+// checkOrigin only lets pages of gateway url and AllowedOrigins open websockets, so that other sites can not
+// ride on the access token of user. Requests without origin are not sent by browsers and are allowed
+func checkOrigin(origin string) error {
+	if origin == "" {
+		return nil
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %s", origin)
+	}
+	if gatewayURL, err := url.Parse(URL); err == nil && strings.EqualFold(originURL.Host, gatewayURL.Host) {
+		return nil
+	}
+	for _, allowed := range strings.Split(AllowedOrigins, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// lookupEndpoint finds endpoint of token, endpoint of any protocol is returned if protocol is empty.
+// Credentials are not loaded, callers load them once the user is authorized
+func (g *Gateway) lookupEndpoint(ctx context.Context, token *Token, protocol hackathonv1.ExperimentIngressProtocol) (*endpointTarget, error) {
+	expr := &hackathonv1.Experiment{}
+	if err := g.Client.Get(ctx, types.NamespacedName{Namespace: token.Namespace, Name: token.Experiment}, expr); err != nil {
+		return nil, fmt.Errorf("query experiment failed: %s", err.Error())
+	}
+	for i := range expr.Status.Endpoints {
+		endpoint := &expr.Status.Endpoints[i]
+		if endpoint.Name != token.Endpoint {
+			continue
+		}
+		if protocol != "" && endpoint.Protocol != protocol {
+			return nil, fmt.Errorf("endpoint %s is not %s", endpoint.Name, protocol)
+		}
+		if endpoint.Service == "" || endpoint.Port == 0 {
+			return nil, fmt.Errorf("endpoint %s not ready", endpoint.Name)
+		}
+		return &endpointTarget{Experiment: expr, Endpoint: endpoint}, nil
+	}
+	return nil, fmt.Errorf("endpoint %s not found", token.Endpoint)
+}
+
+// loadCredentials reads credentials of endpoint from the secret referred in status
+func (g *Gateway) loadCredentials(ctx context.Context, target *endpointTarget) error {
+	ref := target.Endpoint.Credentials
+	if ref == nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := g.Client.Get(ctx, types.NamespacedName{Namespace: target.Experiment.Namespace, Name: ref.SecretName}, secret); err != nil {
+		return fmt.Errorf("query credentials secret failed: %s", err.Error())
+	}
+	target.Username = string(secret.Data[ref.UsernameKey])
+	target.Password = string(secret.Data[ref.PasswordKey])
+	target.Key = string(secret.Data[ref.KeyKey])
+	return nil
+}
+
+func (t *endpointTarget) dial() (net.Conn, error) {
+	addr := fmt.Sprintf("%s.%s.svc:%d", t.Endpoint.Service, t.Experiment.Namespace, t.Endpoint.Port)
+	conn, err := net.DialTimeout("tcp", addr, DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s failed: %s", addr, err.Error())
+	}
+	return conn, nil
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/websocket"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"strings"
+	"time"
+)
+
+// gatewayClient serves an experiment with its credentials secret and
+// authenticates access tokens as the user of the same name
+type gatewayClient struct {
+	client.Client
+	experiment *hackathonv1.Experiment
+	secret     *corev1.Secret
+}
+
+func (c *gatewayClient) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *hackathonv1.Experiment:
+		if c.experiment.Name == key.Name {
+			c.experiment.DeepCopyInto(o)
+			return nil
+		}
+	case *corev1.Secret:
+		if c.secret.Name == key.Name {
+			c.secret.DeepCopyInto(o)
+			return nil
+		}
+	}
+	return errors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *gatewayClient) Create(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+	review := obj.(*authenticationv1.TokenReview)
+	review.Status.Authenticated = true
+	review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token}
+	return nil
+}
+
+var _ = Describe("gateway-server", func() {
+	var g *Gateway
+	url, secret, ttl := URL, Secret, TokenTTL
+	BeforeEach(func() {
+		URL, Secret, TokenTTL = "wss://gateway.example.com", "test-secret", time.Minute
+		g = &Gateway{Logger: zap.New(), Client: &gatewayClient{
+			experiment: &hackathonv1.Experiment{
+				ObjectMeta: metav1.ObjectMeta{Name: "expr", Namespace: "default"},
+				Spec:       hackathonv1.ExperimentSpec{Owner: &hackathonv1.ExperimentSubject{Kind: hackathonv1.ExperimentSubjectUser, Name: "alice"}},
+				Status: hackathonv1.ExperimentStatus{Endpoints: []hackathonv1.ExperimentEndpointStatus{{
+					Name: "vnc", Protocol: hackathonv1.ExperimentIngressVNC, Service: "expr-vnc", Port: 5901,
+					Credentials: &hackathonv1.CredentialsReference{SecretName: "cred-expr", PasswordKey: "vnc-password"},
+				}}},
+			},
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cred-expr", Namespace: "default"},
+				Data:       map[string][]byte{"vnc-password": []byte("secret")},
+			},
+		}}
+	})
+	AfterEach(func() {
+		URL, Secret, TokenTTL = url, secret, ttl
+	})
+
+	request := func(handler http.Handler, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+
+	It("returns credentials and signed url to owner", func() {
+		handler := http.HandlerFunc(g.serveCredentials)
+		credentials := func(query, token string, secure bool) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, CredentialsPath+"?"+query, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			if secure {
+				req.Header.Set("X-Forwarded-Proto", "https")
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+		query := "namespace=default&experiment=expr&endpoint=vnc"
+
+		recorder := credentials(query, "alice", true)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Cache-Control")).To(Equal("no-store"))
+		resp := &credentialsResponse{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), resp)).To(Succeed())
+		Expect(resp.Password).To(Equal("secret"))
+		Expect(resp.URL).To(HavePrefix("wss://gateway.example.com/vnc?token="))
+
+		Expect(credentials(query, "alice", false).Code).To(Equal(http.StatusForbidden))
+		Expect(credentials(query, "", true).Code).To(Equal(http.StatusUnauthorized))
+		Expect(credentials(query+"&access_token=alice", "", true).Code).To(Equal(http.StatusUnauthorized))
+
+		// other users can not tell whether experiment exists
+		forbidden := credentials(query, "mallory", true)
+		missing := credentials("namespace=default&experiment=missing&endpoint=vnc", "mallory", true)
+		Expect(forbidden.Code).To(Equal(http.StatusNotFound))
+		Expect(missing.Code).To(Equal(http.StatusNotFound))
+		Expect(forbidden.Body.String()).To(Equal(missing.Body.String()))
+	})
+
+	It("requires owner to connect with signed url by default", func() {
+		Expect(RequireOwner).To(BeTrue())
+		signedURL, _, err := SignedURL(VNCPath, "default", "expr", "vnc")
+		Expect(err).NotTo(HaveOccurred())
+		query := signedURL[strings.Index(signedURL, "?"):]
+		connected := make(chan *endpointTarget, 1)
+		handler := g.websocketHandler(hackathonv1.ExperimentIngressVNC, func(ws *websocket.Conn) {
+			connected <- ws.Request().Context().Value(endpointKey{}).(*endpointTarget)
+			_ = ws.Close()
+		})
+
+		Expect(request(handler, VNCPath+query).Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(handler, VNCPath+query+"&access_token=mallory").Code).To(Equal(http.StatusForbidden))
+		Expect(request(handler, VNCPath+"?token=forged").Code).To(Equal(http.StatusUnauthorized))
+
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		wsURL := strings.Replace(server.URL, "http", "ws", 1) + VNCPath + query + "&access_token=alice"
+		_, err = websocket.Dial(wsURL, "", "https://evil.example.com")
+		Expect(err).To(HaveOccurred())
+		ws, err := websocket.Dial(wsURL, "", "https://gateway.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		defer ws.Close()
+		var target *endpointTarget
+		Eventually(connected).Should(Receive(&target))
+		Expect(target.Password).To(Equal("secret"))
+	})
+	It("only accepts origins of gateway and allowed pages", func() {
+		allowed := AllowedOrigins
+		defer func() { AllowedOrigins = allowed }()
+		AllowedOrigins = "https://hackathon.example.com, https://admin.example.com/"
+
+		Expect(checkOrigin("")).To(Succeed())
+		Expect(checkOrigin("https://gateway.example.com")).To(Succeed())
+		Expect(checkOrigin("https://admin.example.com")).To(Succeed())
+		Expect(checkOrigin("https://hackathon.example.com")).To(Succeed())
+		Expect(checkOrigin("http://hackathon.example.com")).NotTo(Succeed())
+		Expect(checkOrigin("https://evil.example.com")).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/websocket"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	sshTerminalType  = "xterm-256color"
+	sshDefaultCols   = 80
+	sshDefaultRows   = 24
+	sshMessageInput  = "input"
+	sshMessageResize = "resize"
+	// sshMaxTerminalSize bounds cols and rows sent by client
+	sshMaxTerminalSize = 1000
+)
+
+// sshMessage is sent by terminal client in text frames, terminal output is sent back in binary frames
+type sshMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols int    `json:"cols,omitempty"`
+	Rows int    `json:"rows,omitempty"`
+}
+
+// serveSSH opens a shell with credentials of endpoint and streams the pty to an xterm.js client
+func (g *Gateway) serveSSH(ws *websocket.Conn) {
+	defer ws.Close()
+	target := ws.Request().Context().Value(endpointKey{}).(*endpointTarget)
+	logger := g.Logger.WithValues("experiment", target.Experiment.Name, "namespace", target.Experiment.Namespace)
+	// every frame sent to client goes through output, session output is written concurrently
+	output := &wsWriter{ws: ws}
+
+	client, err := dialSSH(target)
+	if err != nil {
+		logger.Error(err, "connect ssh server failed")
+		_, _ = fmt.Fprintf(output, "connect ssh server failed: %s\r\n", err.Error())
+		return
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		logger.Error(err, "create ssh session failed")
+		return
+	}
+	defer session.Close()
+
+	query := ws.Request().URL.Query()
+	cols, rows := queryInt(query.Get("cols"), sshDefaultCols), queryInt(query.Get("rows"), sshDefaultRows)
+	if err = session.RequestPty(sshTerminalType, rows, cols, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+		logger.Error(err, "request pty failed")
+		return
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		logger.Error(err, "open ssh stdin failed")
+		return
+	}
+	session.Stdout = output
+	session.Stderr = output
+	if err = session.Shell(); err != nil {
+		logger.Error(err, "start shell failed")
+		return
+	}
+
+	logger.Info("ssh session started")
+	activity := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg sshMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			select {
+			case activity <- struct{}{}:
+			default:
+			}
+			switch msg.Type {
+			case sshMessageInput:
+				if _, err := stdin.Write([]byte(msg.Data)); err != nil {
+					return
+				}
+			case sshMessageResize:
+				if validTerminalSize(msg.Cols) && validTerminalSize(msg.Rows) {
+					_ = session.WindowChange(msg.Rows, msg.Cols)
+				}
+			}
+		}
+	}()
+	go func() {
+		_ = session.Wait()
+		_ = ws.Close()
+	}()
+
+	idle := time.NewTimer(SSHIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-done:
+			logger.Info("ssh session closed")
+			return
+		case <-activity:
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(SSHIdleTimeout)
+		case <-idle.C:
+			logger.Info("ssh session idle timeout")
+			_, _ = output.Write([]byte("\r\nsession closed for idle timeout\r\n"))
+			return
+		}
+	}
+}
+
+// dialSSH ignores host key, experiment services are only reachable in cluster
+// and their host keys are generated when pod starts
+func dialSSH(target *endpointTarget) (*ssh.Client, error) {
+	auth, err := sshAuthMethods(target.Password, target.Key)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := target.dial()
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(DialTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), &ssh.ClientConfig{
+		User: target.Username,
+		Auth: auth,
+		// the target is a cluster internal service resolved by cluster dns, there is no known host key to pin
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh handshake failed: %s", err.Error())
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+func sshAuthMethods(password, key string) ([]ssh.AuthMethod, error) {
+	methods := make([]ssh.AuthMethod, 0)
+	if key != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh key failed: %s", err.Error())
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("ssh credentials have neither password nor key")
+	}
+	return methods, nil
+}
+
+// wsWriter sends each write as a binary frame, stdout and stderr share the same writer
+type wsWriter struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (w *wsWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := websocket.Message.Send(w.ws, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// queryInt parses terminal size, defaultValue is used if value is invalid, sizes are capped at sshMaxTerminalSize
+func queryInt(value string, defaultValue int) int {
+	v, err := strconv.Atoi(value)
+	if err != nil || v <= 0 {
+		return defaultValue
+	}
+	if v > sshMaxTerminalSize {
+		return sshMaxTerminalSize
+	}
+	return v
+}
+
+func validTerminalSize(size int) bool {
+	return size > 0 && size <= sshMaxTerminalSize
+}
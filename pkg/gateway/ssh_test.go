@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/websocket"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+var _ = Describe("gateway-ssh", func() {
+	It("builds auth methods from credentials", func() {
+		_, err := sshAuthMethods("", "")
+		Expect(err).To(HaveOccurred())
+
+		methods, err := sshAuthMethods("secret", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(methods).To(HaveLen(1))
+
+		_, err = sshAuthMethods("secret", "not a key")
+		Expect(err).To(MatchError(ContainSubstring("parse ssh key")))
+	})
+
+	It("accepts private key", func() {
+		priv, err := rsa.GenerateKey(rand.Reader, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+		methods, err := sshAuthMethods("secret", string(key))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(methods).To(HaveLen(2))
+	})
+
+	It("parses terminal size", func() {
+		Expect(queryInt("120", sshDefaultCols)).To(Equal(120))
+		Expect(queryInt("", sshDefaultCols)).To(Equal(sshDefaultCols))
+		Expect(queryInt("-1", sshDefaultRows)).To(Equal(sshDefaultRows))
+		Expect(queryInt("abc", sshDefaultRows)).To(Equal(sshDefaultRows))
+		Expect(queryInt("0", sshDefaultRows)).To(Equal(sshDefaultRows))
+		Expect(queryInt("100000", sshDefaultCols)).To(Equal(sshMaxTerminalSize))
+		Expect(validTerminalSize(sshMaxTerminalSize)).To(BeTrue())
+		Expect(validTerminalSize(0)).To(BeFalse())
+		Expect(validTerminalSize(sshMaxTerminalSize + 1)).To(BeFalse())
+	})
+
+	It("serializes concurrent frames", func() {
+		const writers, frames = 8, 50
+		server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+			output := &wsWriter{ws: ws}
+			var wg sync.WaitGroup
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < frames; j++ {
+						_, _ = output.Write([]byte(strings.Repeat("x", 64)))
+					}
+				}()
+			}
+			wg.Wait()
+		}))
+		defer server.Close()
+
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer ws.Close()
+		for i := 0; i < writers*frames; i++ {
+			var frame []byte
+			Expect(websocket.Message.Receive(ws, &frame)).To(Succeed())
+			Expect(string(frame)).To(Equal(strings.Repeat("x", 64)))
+		}
+	})
+})
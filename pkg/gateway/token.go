@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Token authorizes a connection to an endpoint of experiment until it expires
+type Token struct {
+	Namespace  string `json:"ns"`
+	Experiment string `json:"expr"`
+	Endpoint   string `json:"ep"`
+	Expire     int64  `json:"exp"`
+}
+
+func NewToken(namespace, experiment, endpoint string, ttl time.Duration) *Token {
+	return &Token{
+		Namespace:  namespace,
+		Experiment: experiment,
+		Endpoint:   endpoint,
+		Expire:     time.Now().Add(ttl).Unix(),
+	}
+}
+
+func (t *Token) Expired(now time.Time) bool {
+	return now.Unix() >= t.Expire
+}
+
+// Sign encodes token as <payload>.<signature>, both are base64 url encoded
+func (t *Token) Sign(secret []byte) (string, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("encode token failed: %s", err.Error())
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(secret, encoded)), nil
+}
+
+func ParseToken(secret []byte, signed string) (*Token, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("token format invalid")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode token signature failed: %s", err.Error())
+	}
+	if !hmac.Equal(signature, sign(secret, parts[0])) {
+		return nil, fmt.Errorf("token signature mismatch")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode token failed: %s", err.Error())
+	}
+	token := &Token{}
+	if err = json.Unmarshal(payload, token); err != nil {
+		return nil, fmt.Errorf("decode token failed: %s", err.Error())
+	}
+	if token.Expired(time.Now()) {
+		return nil, fmt.Errorf("token expired")
+	}
+	return token, nil
+}
+
+// SignedURL returns the gateway url of an endpoint, path is the handler of endpoint protocol
+func SignedURL(path, namespace, experiment, endpoint string) (string, *Token, error) {
+	token := NewToken(namespace, experiment, endpoint, TokenTTL)
+	signed, err := token.Sign([]byte(Secret))
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimSuffix(URL, "/"), path, signed), token, nil
+}
+
+func sign(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+	"time"
+)
+
+var _ = Describe("gateway-token", func() {
+	secret := []byte("test-secret")
+
+	It("verifies signed token", func() {
+		token := NewToken("default", "expr", "ssh", time.Minute)
+		signed, err := token.Sign(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		parsed, err := ParseToken(secret, signed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(token))
+	})
+
+	It("rejects tampered or foreign token", func() {
+		signed, err := NewToken("default", "expr", "ssh", time.Minute).Sign(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = ParseToken([]byte("other-secret"), signed)
+		Expect(err).To(MatchError(ContainSubstring("mismatch")))
+
+		forged, err := NewToken("default", "other-expr", "ssh", time.Minute).Sign([]byte("other-secret"))
+		Expect(err).NotTo(HaveOccurred())
+		parts := strings.Split(signed, ".")
+		_, err = ParseToken(secret, strings.Split(forged, ".")[0]+"."+parts[1])
+		Expect(err).To(MatchError(ContainSubstring("mismatch")))
+
+		_, err = ParseToken(secret, parts[0])
+		Expect(err).To(MatchError(ContainSubstring("format")))
+	})
+
+	It("rejects expired token", func() {
+		token := NewToken("default", "expr", "ssh", -time.Second)
+		Expect(token.Expired(time.Now())).To(BeTrue())
+		signed, err := token.Sign(secret)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ParseToken(secret, signed)
+		Expect(err).To(MatchError(ContainSubstring("expired")))
+	})
+
+	It("signs url of endpoint", func() {
+		url, secretBackup, ttlBackup := URL, Secret, TokenTTL
+		defer func() { URL, Secret, TokenTTL = url, secretBackup, ttlBackup }()
+		URL, Secret, TokenTTL = "https://gateway.example.com/", "test-secret", time.Minute
+
+		signedURL, token, err := SignedURL(SSHPath, "default", "expr", "ssh")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signedURL).To(HavePrefix("https://gateway.example.com/ssh?token="))
+		parsed, err := ParseToken([]byte(Secret), strings.TrimPrefix(signedURL, "https://gateway.example.com/ssh?token="))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(token))
+	})
+})
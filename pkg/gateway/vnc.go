@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"bufio"
+	"crypto/des"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"io"
+	"time"
+)
+
+const (
+	rfbSecurityInvalid = 0
+	rfbSecurityNone    = 1
+	rfbSecurityVNCAuth = 2
+
+	rfbHandshakeTimeout = 30 * time.Second
+)
+
+// serveVNC authenticates to the vnc server with credentials of endpoint,
+// and offers no authentication to browser, then relays the rfb stream
+func (g *Gateway) serveVNC(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.PayloadType = websocket.BinaryFrame
+	target := ws.Request().Context().Value(endpointKey{}).(*endpointTarget)
+	logger := g.Logger.WithValues("experiment", target.Experiment.Name, "namespace", target.Experiment.Namespace)
+
+	conn, err := target.dial()
+	if err != nil {
+		logger.Error(err, "connect vnc server failed")
+		return
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(rfbHandshakeTimeout))
+	server := bufio.NewReader(conn)
+	if err = rfbServerHandshake(server, conn, target.Password); err != nil {
+		logger.Error(err, "vnc server handshake failed")
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if err = rfbClientHandshake(ws); err != nil {
+		logger.Error(err, "vnc client handshake failed")
+		return
+	}
+
+	logger.Info("vnc session started")
+	relay(ws, struct {
+		io.Reader
+		io.Writer
+	}{server, conn})
+	logger.Info("vnc session closed")
+}
+
+func rfbServerHandshake(r *bufio.Reader, w io.Writer, password string) error {
+	minor, err := readRFBVersion(r)
+	if err != nil {
+		return err
+	}
+	if minor > 8 {
+		minor = 8
+	}
+	if minor != 3 && minor != 7 && minor != 8 {
+		minor = 3
+	}
+	if _, err = fmt.Fprintf(w, "RFB 003.%03d\n", minor); err != nil {
+		return err
+	}
+
+	var security uint8
+	if minor == 3 {
+		var t uint32
+		if err = binary.Read(r, binary.BigEndian, &t); err != nil {
+			return err
+		}
+		security = uint8(t)
+	} else {
+		var count uint8
+		if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+			return err
+		}
+		types := make([]byte, count)
+		if _, err = io.ReadFull(r, types); err != nil {
+			return err
+		}
+		security = rfbSecurityInvalid
+		for _, t := range types {
+			if t == rfbSecurityVNCAuth || (t == rfbSecurityNone && security != rfbSecurityVNCAuth) {
+				security = t
+			}
+		}
+		if count > 0 && security != rfbSecurityInvalid {
+			if _, err = w.Write([]byte{security}); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch security {
+	case rfbSecurityNone:
+		if minor < 8 {
+			return nil
+		}
+	case rfbSecurityVNCAuth:
+		challenge := make([]byte, 16)
+		if _, err = io.ReadFull(r, challenge); err != nil {
+			return err
+		}
+		response, err := vncAuthResponse(challenge, password)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(response); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("vnc security type %d not supported", security)
+	}
+
+	var result uint32
+	if err = binary.Read(r, binary.BigEndian, &result); err != nil {
+		return err
+	}
+	if result != 0 {
+		return fmt.Errorf("vnc authentication failed")
+	}
+	return nil
+}
+
+// rfbClientHandshake acts as a vnc server without authentication
+func rfbClientHandshake(rw io.ReadWriter) error {
+	if _, err := io.WriteString(rw, "RFB 003.008\n"); err != nil {
+		return err
+	}
+	minor, err := readRFBVersion(rw)
+	if err != nil {
+		return err
+	}
+	if minor < 7 {
+		return binary.Write(rw, binary.BigEndian, uint32(rfbSecurityNone))
+	}
+	if _, err = rw.Write([]byte{1, rfbSecurityNone}); err != nil {
+		return err
+	}
+	choice := make([]byte, 1)
+	if _, err = io.ReadFull(rw, choice); err != nil {
+		return err
+	}
+	if choice[0] != rfbSecurityNone {
+		return fmt.Errorf("client chose security type %d", choice[0])
+	}
+	if minor >= 8 {
+		return binary.Write(rw, binary.BigEndian, uint32(0))
+	}
+	return nil
+}
+
+func readRFBVersion(r io.Reader) (int, error) {
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, fmt.Errorf("read rfb version failed: %s", err.Error())
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(string(buf), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return 0, fmt.Errorf("rfb version %q not supported", string(buf))
+	}
+	return minor, nil
+}
+
+// vncAuthResponse encrypts challenge by DES with the bit reversed password as key
+func vncAuthResponse(challenge []byte, password string) ([]byte, error) {
+	key := make([]byte, 8)
+	copy(key, password)
+	for i, b := range key {
+		var reversed byte
+		for j := 0; j < 8; j++ {
+			if b&(1<<uint(j)) != 0 {
+				reversed |= 1 << uint(7-j)
+			}
+		}
+		key[i] = reversed
+	}
+	cipher, err := des.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]byte, len(challenge))
+	for i := 0; i < len(challenge); i += des.BlockSize {
+		cipher.Encrypt(response[i:i+des.BlockSize], challenge[i:i+des.BlockSize])
+	}
+	return response, nil
+}
+
+// relay copies in both directions until one side closed,
+// callers close both connections to stop the other direction
+func relay(a io.ReadWriteCloser, b io.ReadWriter) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"time"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of request body, formatted as sha256=<hex>
+	SignatureHeader = "X-CloudEngine-Signature"
+)
+
+var (
+	// QueueSize is the number of events waiting for delivery, events are dead-lettered if queue is full
+	QueueSize = 1024
+	// DefaultMaxRetries is used if notification does not set max retries
+	DefaultMaxRetries int32 = 3
+	// RetryBackoff is the delay of first retry, it doubles on every retry
+	RetryBackoff    = 5 * time.Second
+	DeliveryTimeout = 10 * time.Second
+	// AllowInsecure permits plain http webhooks, only https webhooks are delivered by default
+	AllowInsecure = false
+	// AllowPrivateNetworks permits webhooks resolving to loopback, link-local and private addresses,
+	// such as receivers inside the cluster, they are refused by default
+	AllowPrivateNetworks = false
+	// AllowedHosts is a comma separated list of webhook hosts, a leading dot matches subdomains,
+	// all hosts are allowed if empty
+	AllowedHosts = ""
+)
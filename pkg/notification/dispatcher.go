@@ -0,0 +1,238 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/eventbus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"net"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// topics maps lifecycle topics of eventbus to notification event types
+var topics = map[eventbus.Topic]hackathonv1.NotificationEventType{
+	eventbus.ExperimentReadyTopic:    hackathonv1.NotificationExperimentReady,
+	eventbus.ExperimentErrorTopic:    hackathonv1.NotificationExperimentError,
+	eventbus.ExperimentExpiringTopic: hackathonv1.NotificationExperimentExpiring,
+	eventbus.CustomClusterLostTopic:  hackathonv1.NotificationClusterLost,
+}
+
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=notifications,verbs=get;list;watch
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=notifications/status,verbs=get;update;patch
+
+// Dispatcher delivers lifecycle events published on eventbus to the notification webhooks
+// of their namespace, undelivered events are written to dead-letter log
+type Dispatcher struct {
+	Client client.Client
+	Logger logr.Logger
+
+	queue      chan *event
+	httpClient *http.Client
+}
+
+// NeedLeaderElection is true since lifecycle events are only published by the leader
+func (d *Dispatcher) NeedLeaderElection() bool {
+	return true
+}
+
+func (d *Dispatcher) Start(stop <-chan struct{}) error {
+	d.queue = make(chan *event, QueueSize)
+	d.httpClient = newHTTPClient()
+	for topic, eventType := range topics {
+		eventType := eventType
+		eventbus.Register(topic, *eventbus.NewSimpleListener(fmt.Sprintf("notification.%s", eventType), func(args ...interface{}) error {
+			return d.enqueue(eventType, args...)
+		}))
+	}
+
+	d.Logger.Info("starting notification dispatcher")
+	for {
+		select {
+		case <-stop:
+			return nil
+		case evt := <-d.queue:
+			d.dispatch(stop, evt)
+		}
+	}
+}
+
+// enqueue never blocks the publisher, the event is dead-lettered if queue is full
+func (d *Dispatcher) enqueue(eventType hackathonv1.NotificationEventType, args ...interface{}) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no object published for %s", eventType)
+	}
+	var evt *event
+	switch obj := args[0].(type) {
+	case *hackathonv1.Experiment:
+		evt = experimentEvent(eventType, obj)
+	case *hackathonv1.CustomCluster:
+		evt = clusterEvent(eventType, obj)
+	default:
+		return fmt.Errorf("unexpected object %T published for %s", obj, eventType)
+	}
+
+	select {
+	case d.queue <- evt:
+	default:
+		d.deadLetter(nil, evt, fmt.Errorf("notification queue is full"))
+	}
+	return nil
+}
+
+func (d *Dispatcher) dispatch(stop <-chan struct{}, evt *event) {
+	notifications := &hackathonv1.NotificationList{}
+	if err := d.Client.List(context.Background(), notifications, client.InNamespace(evt.namespace)); err != nil {
+		d.deadLetter(nil, evt, fmt.Errorf("list notifications failed: %s", err.Error()))
+		return
+	}
+	for i := range notifications.Items {
+		n := &notifications.Items[i]
+		if !n.Subscribed(evt.eventType) {
+			continue
+		}
+		go d.deliver(stop, n, evt)
+	}
+}
+
+// deliver posts event to webhook, retrying with exponential backoff
+func (d *Dispatcher) deliver(stop <-chan struct{}, n *hackathonv1.Notification, evt *event) {
+	ctx := context.Background()
+	maxRetries := DefaultMaxRetries
+	if n.Spec.MaxRetries != nil {
+		maxRetries = *n.Spec.MaxRetries
+	}
+
+	body, err := json.Marshal(evt.payload)
+	if err != nil {
+		d.deadLetter(n, evt, fmt.Errorf("marshal event failed: %s", err.Error()))
+		d.recordDelivery(ctx, n, err)
+		return
+	}
+	key, err := d.signingKey(ctx, n)
+	if err != nil {
+		d.deadLetter(n, evt, err)
+		d.recordDelivery(ctx, n, err)
+		return
+	}
+
+	// refused targets are never retried
+	if err = validateTarget(n.Spec.URL); err != nil {
+		d.deadLetter(n, evt, err)
+		d.recordDelivery(ctx, n, err)
+		return
+	}
+
+	backoff := RetryBackoff
+	for attempt := int32(0); ; attempt++ {
+		if err = d.post(n.Spec.URL, body, key); err == nil || attempt >= maxRetries {
+			break
+		}
+		d.Logger.Info("deliver notification failed, retry",
+			"notification", n.Name, "namespace", n.Namespace, "id", evt.payload.ID, "attempt", attempt+1, "error", err.Error())
+		select {
+		case <-stop:
+			d.deadLetter(n, evt, fmt.Errorf("dispatcher stopped: %s", err.Error()))
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		d.deadLetter(n, evt, err)
+	}
+	d.recordDelivery(ctx, n, err)
+}
+
+// newHTTPClient checks every resolved address and never follows redirects,
+// so that webhooks can not reach the addresses refused by validateTarget
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DeliveryTimeout, Control: checkDialAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   DeliveryTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (d *Dispatcher) post(url string, body, key []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request failed: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+	if key != nil {
+		req.Header.Set(SignatureHeader, sign(key, body))
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post event failed: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// signingKey returns nil if notification payload is not signed
+func (d *Dispatcher) signingKey(ctx context.Context, n *hackathonv1.Notification) ([]byte, error) {
+	ref := n.Spec.SecretRef
+	if ref == nil {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	if err := d.Client.Get(ctx, types.NamespacedName{Namespace: n.Namespace, Name: ref.Name}, secret); err != nil {
+		return nil, fmt.Errorf("query notification secret failed: %s", err.Error())
+	}
+	key, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in secret %s", ref.Key, ref.Name)
+	}
+	return key, nil
+}
+
+func (d *Dispatcher) recordDelivery(ctx context.Context, n *hackathonv1.Notification, deliveryErr error) {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crt := &hackathonv1.Notification{}
+		if err := d.Client.Get(ctx, types.NamespacedName{Namespace: n.Namespace, Name: n.Name}, crt); err != nil {
+			return err
+		}
+		now := metav1.Now()
+		crt.Status.LastDeliveryTime = &now
+		if deliveryErr != nil {
+			crt.Status.Failed++
+			crt.Status.LastError = deliveryErr.Error()
+		} else {
+			crt.Status.Delivered++
+		}
+		return d.Client.Status().Update(ctx, crt)
+	})
+	if client.IgnoreNotFound(err) != nil {
+		d.Logger.Error(err, "update notification status failed", "notification", n.Name, "namespace", n.Namespace)
+	}
+}
+
+// deadLetter logs the whole event so that it can be replayed manually, n is nil if event is not dispatched
+func (d *Dispatcher) deadLetter(n *hackathonv1.Notification, evt *event, err error) {
+	payload, _ := json.Marshal(evt.payload)
+	values := []interface{}{"id", evt.payload.ID, "type", evt.payload.Type, "error", err.Error(), "payload", string(payload)}
+	if n != nil {
+		values = append(values, "notification", n.Name, "namespace", n.Namespace, "url", n.Spec.URL)
+	}
+	d.Logger.WithName("deadletter").Info("notification undelivered", values...)
+}
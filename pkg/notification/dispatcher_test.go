@@ -0,0 +1,268 @@
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sync"
+	"time"
+)
+
+// notificationClient serves the signing secret and records status updates of notification
+type notificationClient struct {
+	client.Client
+	mu           sync.Mutex
+	secret       *corev1.Secret
+	notification *hackathonv1.Notification
+}
+
+func (c *notificationClient) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		if c.secret == nil || c.secret.Name != key.Name {
+			return errors.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+		}
+		c.secret.DeepCopyInto(o)
+	case *hackathonv1.Notification:
+		c.notification.DeepCopyInto(o)
+	}
+	return nil
+}
+
+func (c *notificationClient) Status() client.StatusWriter {
+	return &notificationStatusWriter{c}
+}
+
+type notificationStatusWriter struct {
+	c *notificationClient
+}
+
+func (w *notificationStatusWriter) Update(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	obj.(*hackathonv1.Notification).DeepCopyInto(w.c.notification)
+	return nil
+}
+
+func (w *notificationStatusWriter) Patch(context.Context, runtime.Object, client.Patch, ...client.PatchOption) error {
+	return fmt.Errorf("not supported")
+}
+
+// deadLetterLogger records messages logged by dispatcher
+type deadLetterLogger struct {
+	mu       *sync.Mutex
+	messages *[]string
+}
+
+func newDeadLetterLogger() deadLetterLogger {
+	return deadLetterLogger{mu: &sync.Mutex{}, messages: &[]string{}}
+}
+
+func (l deadLetterLogger) Info(msg string, _ ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.messages = append(*l.messages, msg)
+}
+func (l deadLetterLogger) Enabled() bool                                { return true }
+func (l deadLetterLogger) Error(_ error, msg string, kv ...interface{}) { l.Info(msg, kv...) }
+func (l deadLetterLogger) V(int) logr.InfoLogger                        { return l }
+func (l deadLetterLogger) WithValues(...interface{}) logr.Logger        { return l }
+func (l deadLetterLogger) WithName(string) logr.Logger                  { return l }
+func (l deadLetterLogger) Messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, *l.messages...)
+}
+
+var _ = Describe("notification-dispatcher", func() {
+	var (
+		cli    *notificationClient
+		logger deadLetterLogger
+		d      *Dispatcher
+		n      *hackathonv1.Notification
+		evt    *event
+		stop   chan struct{}
+	)
+	backoff, insecure, private := RetryBackoff, AllowInsecure, AllowPrivateNetworks
+
+	BeforeEach(func() {
+		RetryBackoff, AllowInsecure, AllowPrivateNetworks = time.Millisecond, true, true
+		n = &hackathonv1.Notification{ObjectMeta: metav1.ObjectMeta{Name: "hook", Namespace: "default"}}
+		cli = &notificationClient{notification: n.DeepCopy()}
+		logger = newDeadLetterLogger()
+		d = &Dispatcher{Client: cli, Logger: logger, httpClient: newHTTPClient()}
+		evt = experimentEvent(hackathonv1.NotificationExperimentReady, &hackathonv1.Experiment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-expr", Namespace: "default"},
+			Status: hackathonv1.ExperimentStatus{
+				Status:    hackathonv1.ExperimentRunning,
+				Endpoints: []hackathonv1.ExperimentEndpointStatus{{Name: "vnc", URL: "wss://gateway/vnc?token=secret"}},
+			},
+		})
+		stop = make(chan struct{})
+	})
+	AfterEach(func() {
+		close(stop)
+		RetryBackoff, AllowInsecure, AllowPrivateNetworks = backoff, insecure, private
+	})
+
+	Context("payload", func() {
+		It("signs body with hmac sha256", func() {
+			mac := hmac.New(sha256.New, []byte("key"))
+			mac.Write([]byte("body"))
+			Expect(sign([]byte("key"), []byte("body"))).To(Equal("sha256=" + hex.EncodeToString(mac.Sum(nil))))
+		})
+
+		It("leaves endpoints out of experiment events", func() {
+			body, err := json.Marshal(evt.payload)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).NotTo(ContainSubstring("token"))
+			Expect(evt.payload.Type).To(Equal("cn.kaiyuanshe.cloudengine.experiment.ready"))
+			Expect(evt.payload.Source).To(Equal("/apis/hackathon.kaiyuanshe.cn/v1/namespaces/default/experiments/test-expr"))
+		})
+	})
+
+	Context("delivery", func() {
+		It("posts signed event", func() {
+			var signature, contentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				signature, contentType = r.Header.Get(SignatureHeader), r.Header.Get("Content-Type")
+			}))
+			defer server.Close()
+			cli.secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hook-key"}, Data: map[string][]byte{"key": []byte("secret")}}
+			n.Spec.URL = server.URL
+			n.Spec.SecretRef = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "hook-key"}, Key: "key"}
+
+			d.deliver(stop, n, evt)
+			body, _ := json.Marshal(evt.payload)
+			Expect(signature).To(Equal(sign([]byte("secret"), body)))
+			Expect(contentType).To(Equal(cloudEventsContentType))
+			Expect(cli.notification.Status.Delivered).To(BeEquivalentTo(1))
+			Expect(logger.Messages()).To(BeEmpty())
+		})
+
+		It("retries failed delivery", func() {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+			n.Spec.URL = server.URL
+
+			d.deliver(stop, n, evt)
+			Expect(attempts).To(Equal(3))
+			Expect(cli.notification.Status.Delivered).To(BeEquivalentTo(1))
+			Expect(cli.notification.Status.Failed).To(BeZero())
+		})
+
+		It("dead-letters event after max retries", func() {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+			retries := int32(1)
+			n.Spec.URL, n.Spec.MaxRetries = server.URL, &retries
+
+			d.deliver(stop, n, evt)
+			Expect(attempts).To(Equal(2))
+			Expect(cli.notification.Status.Failed).To(BeEquivalentTo(1))
+			Expect(cli.notification.Status.LastError).To(ContainSubstring("500"))
+			Expect(logger.Messages()).To(ContainElement("notification undelivered"))
+		})
+
+		It("dead-letters event if signing secret missing", func() {
+			n.Spec.URL = "https://hooks.example.com/"
+			n.Spec.SecretRef = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "key"}
+			d.deliver(stop, n, evt)
+			Expect(cli.notification.Status.LastError).To(ContainSubstring("query notification secret failed"))
+			Expect(logger.Messages()).To(ContainElement("notification undelivered"))
+		})
+
+		It("dead-letters event when queue is full", func() {
+			d.queue = make(chan *event)
+			Expect(d.enqueue(hackathonv1.NotificationExperimentReady, &hackathonv1.Experiment{})).To(Succeed())
+			Expect(logger.Messages()).To(ContainElement("notification undelivered"))
+			Expect(d.enqueue(hackathonv1.NotificationExperimentReady, "unexpected")).To(HaveOccurred())
+		})
+
+		It("does not follow redirects", func() {
+			redirected := false
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				redirected = true
+			}))
+			defer target.Close()
+			server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+			defer server.Close()
+			Expect(d.post(server.URL, []byte("{}"), nil)).To(MatchError(ContainSubstring("307")))
+			Expect(redirected).To(BeFalse())
+		})
+	})
+
+	Context("targets", func() {
+		hosts := AllowedHosts
+		AfterEach(func() {
+			AllowedHosts = hosts
+		})
+
+		It("refuses insecure and private webhooks by default", func() {
+			AllowInsecure, AllowPrivateNetworks = false, false
+			Expect(validateTarget("https://hooks.example.com/events")).To(Succeed())
+			Expect(validateTarget("http://hooks.example.com/events")).To(MatchError(ContainSubstring("scheme")))
+			Expect(validateTarget("ftp://hooks.example.com/events")).To(MatchError(ContainSubstring("scheme")))
+			for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "[::1]", "[fd00::1]", "0.0.0.0"} {
+				Expect(validateTarget("https://"+addr+"/")).To(MatchError(ContainSubstring("not allowed")), addr)
+			}
+			Expect(validateTarget("https://8.8.8.8/")).To(Succeed())
+		})
+
+		It("refuses names resolving to private addresses", func() {
+			AllowPrivateNetworks = false
+			Expect(checkDialAddress("tcp", "127.0.0.1:443", nil)).To(HaveOccurred())
+			Expect(checkDialAddress("tcp", net.JoinHostPort("169.254.169.254", "80"), nil)).To(HaveOccurred())
+			Expect(checkDialAddress("tcp", "93.184.216.34:443", nil)).To(Succeed())
+
+			n.Spec.URL = "https://localhost/"
+			AllowInsecure = false
+			err := d.post(n.Spec.URL, []byte("{}"), nil)
+			Expect(err).To(MatchError(ContainSubstring("not allowed")))
+		})
+
+		It("only delivers to allowed hosts if configured", func() {
+			AllowedHosts = "hooks.example.com, .platform.example.org"
+			Expect(validateTarget("https://hooks.example.com/")).To(Succeed())
+			Expect(validateTarget("https://a.platform.example.org/")).To(Succeed())
+			Expect(validateTarget("https://platform.example.org.evil.com/")).To(MatchError(ContainSubstring("not allowed")))
+			Expect(validateTarget("https://other.example.com/")).To(MatchError(ContainSubstring("not allowed")))
+		})
+
+		It("never retries refused webhooks", func() {
+			AllowInsecure = false
+			n.Spec.URL = "http://hooks.example.com/"
+			d.deliver(stop, n, evt)
+			Expect(cli.notification.Status.Failed).To(BeEquivalentTo(1))
+			Expect(cli.notification.Status.LastError).To(ContainSubstring("scheme"))
+		})
+	})
+})
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"time"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	eventTypePrefix        = "cn.kaiyuanshe.cloudengine."
+)
+
+// CloudEvent is the payload of CloudEvents 1.0 structured content mode
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// ExperimentEventData leaves endpoints out, receivers query connections with their own credentials
+type ExperimentEventData struct {
+	Namespace string                          `json:"namespace"`
+	Name      string                          `json:"name"`
+	Status    hackathonv1.ExperimentEnvStatus `json:"status"`
+	Cluster   string                          `json:"cluster,omitempty"`
+	Reason    string                          `json:"reason,omitempty"`
+	Message   string                          `json:"message,omitempty"`
+	URL       string                          `json:"url,omitempty"`
+}
+
+type ClusterEventData struct {
+	Namespace string                    `json:"namespace"`
+	Name      string                    `json:"name"`
+	Status    hackathonv1.ClusterStatus `json:"status"`
+	ClusterID string                    `json:"clusterId,omitempty"`
+	Reason    string                    `json:"reason,omitempty"`
+	Message   string                    `json:"message,omitempty"`
+}
+
+// event is a CloudEvent waiting for delivery to notifications of its namespace
+type event struct {
+	eventType hackathonv1.NotificationEventType
+	namespace string
+	payload   CloudEvent
+}
+
+func newEvent(eventType hackathonv1.NotificationEventType, namespace, resource, name string, data interface{}) *event {
+	return &event{
+		eventType: eventType,
+		namespace: namespace,
+		payload: CloudEvent{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              uuid.New().String(),
+			Source:          fmt.Sprintf("/apis/%s/namespaces/%s/%s/%s", hackathonv1.GroupVersion.String(), namespace, resource, name),
+			Type:            eventTypePrefix + string(eventType),
+			Subject:         name,
+			Time:            time.Now().UTC(),
+			DataContentType: "application/json",
+			Data:            data,
+		},
+	}
+}
+
+// eventConditions is the experiment condition explaining each event type
+var eventConditions = map[hackathonv1.NotificationEventType]hackathonv1.ExperimentConditionType{
+	hackathonv1.NotificationExperimentReady:    hackathonv1.ExperimentReady,
+	hackathonv1.NotificationExperimentError:    hackathonv1.ExperimentPodReady,
+	hackathonv1.NotificationExperimentExpiring: hackathonv1.ExperimentVolumeExpiring,
+}
+
+func experimentEvent(eventType hackathonv1.NotificationEventType, expr *hackathonv1.Experiment) *event {
+	data := ExperimentEventData{
+		Namespace: expr.Namespace,
+		Name:      expr.Name,
+		Status:    expr.Status.Status,
+		Cluster:   expr.Status.Cluster,
+		URL:       expr.Status.URL,
+	}
+	if cond := hackathonv1.QueryExperimentCondition(expr.Status.Conditions, eventConditions[eventType]); cond != nil {
+		data.Reason, data.Message = cond.Reason, cond.Message
+	}
+	return newEvent(eventType, expr.Namespace, "experiments", expr.Name, data)
+}
+
+func clusterEvent(eventType hackathonv1.NotificationEventType, cluster *hackathonv1.CustomCluster) *event {
+	data := ClusterEventData{
+		Namespace: cluster.Namespace,
+		Name:      cluster.Name,
+		Status:    cluster.Status.Status,
+		ClusterID: cluster.Status.ClusterID,
+	}
+	if cond := hackathonv1.QueryClusterCondition(cluster.Status.Conditions, hackathonv1.ClusterHeartbeat); cond != nil {
+		data.Reason, data.Message = cond.Reason, cond.Message
+	}
+	return newEvent(eventType, cluster.Namespace, "customclusters", cluster.Name, data)
+}
+
+// sign returns the signature header value of body
+func sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// privateNetworks are refused unless AllowPrivateNetworks, loopback and link-local addresses are checked separately
+var privateNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// validateTarget refuses webhook urls of disallowed schemes or hosts before any request is sent
+func validateTarget(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("parse webhook url failed: %s", err.Error())
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && AllowInsecure:
+	default:
+		return fmt.Errorf("webhook scheme %q is not allowed", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("webhook host is empty")
+	}
+	if !allowedHost(host) {
+		return fmt.Errorf("webhook host %s is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !allowedIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+func allowedHost(host string) bool {
+	if AllowedHosts == "" {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range strings.Split(AllowedHosts, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case allowed == "":
+		case strings.HasPrefix(allowed, "."):
+			if strings.HasSuffix(host, allowed) {
+				return true
+			}
+		case host == allowed:
+			return true
+		}
+	}
+	return false
+}
+
+func allowedIP(ip net.IP) bool {
+	if AllowPrivateNetworks {
+		return true
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDialAddress runs after host resolved, so that names resolving to private addresses are refused as well
+func checkDialAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !allowedIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+)
+
+// DefaultOwnerLabel is the experiment label key of owner if quota does not set one
+const DefaultOwnerLabel = "hackathon.kaiyuanshe.cn/owner"
+
+// ExperimentUsage is the usage accounted for an experiment
+type ExperimentUsage struct {
+	Experiment *hackathonv1.Experiment
+	Usage      *experiment.QuotaUsage
+}
+
+// ListUsage returns usages of experiments in namespace except skip,
+// deleting experiments are not accounted
+func ListUsage(ctx context.Context, k8sClient client.Client, namespace, skip string) ([]ExperimentUsage, error) {
+	exprList := &hackathonv1.ExperimentList{}
+	if err := k8sClient.List(ctx, exprList, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("list experiments failed: %s", err.Error())
+	}
+	limitRanges, err := listLimitRanges(ctx, k8sClient, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]ExperimentUsage, 0)
+	for i := range exprList.Items {
+		expr := &exprList.Items[i]
+		if expr.Name == skip || !expr.DeletionTimestamp.IsZero() {
+			continue
+		}
+		usage, err := experiment.ExperimentQuotaUsage(ctx, k8sClient, expr, limitRanges)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, ExperimentUsage{Experiment: expr, Usage: usage})
+	}
+	return usages, nil
+}
+
+func listLimitRanges(ctx context.Context, k8sClient client.Client, namespace string) ([]corev1.LimitRange, error) {
+	limitRangeList := &corev1.LimitRangeList{}
+	if err := k8sClient.List(ctx, limitRangeList, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("query limit range failed: %s", err.Error())
+	}
+	return limitRangeList.Items, nil
+}
+
+// Summarize sums usages of namespace and of each owner
+func Summarize(quota *hackathonv1.ExperimentQuota, usages []ExperimentUsage) *hackathonv1.ExperimentQuotaStatus {
+	status := &hackathonv1.ExperimentQuotaStatus{}
+	owners := map[string]*hackathonv1.ExperimentQuotaUsage{}
+	for _, u := range usages {
+		addUsage(&status.Used, u.Usage)
+		owner := ownerOf(quota, u.Experiment)
+		if owner == "" {
+			continue
+		}
+		if _, ok := owners[owner]; !ok {
+			owners[owner] = &hackathonv1.ExperimentQuotaUsage{}
+		}
+		addUsage(owners[owner], u.Usage)
+	}
+
+	for owner, used := range owners {
+		status.Owners = append(status.Owners, hackathonv1.OwnerQuotaUsage{Owner: owner, Used: *used})
+	}
+	sort.Slice(status.Owners, func(i, j int) bool {
+		return status.Owners[i].Owner < status.Owners[j].Owner
+	})
+	return status
+}
+
+// ownerOf prefers owner label to spec owner so that quota of existing experiments is kept
+func ownerOf(quota *hackathonv1.ExperimentQuota, expr *hackathonv1.Experiment) string {
+	label := quota.Spec.OwnerLabel
+	if label == "" {
+		label = DefaultOwnerLabel
+	}
+	if owner, ok := expr.Labels[label]; ok {
+		return owner
+	}
+	if expr.Spec.Owner != nil {
+		return expr.Spec.Owner.Name
+	}
+	return ""
+}
+
+func ownerUsage(status *hackathonv1.ExperimentQuotaStatus, owner string) *hackathonv1.ExperimentQuotaUsage {
+	for i := range status.Owners {
+		if status.Owners[i].Owner == owner {
+			return &status.Owners[i].Used
+		}
+	}
+	return &hackathonv1.ExperimentQuotaUsage{}
+}
+
+func addUsage(used *hackathonv1.ExperimentQuotaUsage, usage *experiment.QuotaUsage) {
+	used.Experiments++
+	used.CPU.Add(usage.CPU)
+	used.Memory.Add(usage.Memory)
+	used.DataVolume.Add(usage.DataVolume)
+}
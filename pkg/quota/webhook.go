@@ -0,0 +1,135 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"strings"
+)
+
+// ValidatePath is the path of experiment validating webhook
+const ValidatePath = "/validate-hackathon-kaiyuanshe-cn-v1-experiment"
+
+// +kubebuilder:webhook:path=/validate-hackathon-kaiyuanshe-cn-v1-experiment,mutating=false,failurePolicy=fail,groups=hackathon.kaiyuanshe.cn,resources=experiments,verbs=create;update,versions=v1,name=vexperiment.kaiyuanshe.cn
+// +kubebuilder:rbac:groups=hackathon.kaiyuanshe.cn,resources=experimentquotas,verbs=get;list;watch
+
+// Validator rejects experiments exceeding any ExperimentQuota of namespace,
+// updates which do not increase usage are always allowed so that quota never blocks cleaning up
+type Validator struct {
+	Client  client.Client
+	Logger  logr.Logger
+	decoder *admission.Decoder
+}
+
+func (v *Validator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	expr := &hackathonv1.Experiment{}
+	if err := v.decoder.Decode(req, expr); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !expr.DeletionTimestamp.IsZero() {
+		return admission.Allowed("experiment is deleting")
+	}
+
+	quotas := &hackathonv1.ExperimentQuotaList{}
+	if err := v.Client.List(ctx, quotas, client.InNamespace(req.Namespace)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("list experiment quotas failed: %s", err.Error()))
+	}
+	if len(quotas.Items) == 0 {
+		return admission.Allowed("")
+	}
+
+	limitRanges, err := listLimitRanges(ctx, v.Client, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	requested, err := experiment.ExperimentQuotaUsage(ctx, v.Client, expr, limitRanges)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	var old *hackathonv1.Experiment
+	var previous *experiment.QuotaUsage
+	if req.Operation == admissionv1beta1.Update {
+		old = &hackathonv1.Experiment{}
+		if err = v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if previous, err = experiment.ExperimentQuotaUsage(ctx, v.Client, old, limitRanges); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+
+	usages, err := ListUsage(ctx, v.Client, req.Namespace, expr.Name)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	violations := make([]string, 0)
+	for i := range quotas.Items {
+		violations = append(violations, checkQuota(&quotas.Items[i], usages, expr, requested, old, previous)...)
+	}
+	if len(violations) > 0 {
+		v.Logger.Info("experiment rejected by quota", "namespace", req.Namespace, "name", expr.Name, "violations", violations)
+		return admission.Denied(fmt.Sprintf("experiment %s exceeds quota: %s", expr.Name, strings.Join(violations, "; ")))
+	}
+	return admission.Allowed("")
+}
+
+// checkQuota checks namespace and owner limits of quota, usages do not contain the checked experiment.
+// old and previous are nil for creation.
+func checkQuota(quota *hackathonv1.ExperimentQuota, usages []ExperimentUsage, expr *hackathonv1.Experiment,
+	requested *experiment.QuotaUsage, old *hackathonv1.Experiment, previous *experiment.QuotaUsage) []string {
+	status := Summarize(quota, usages)
+	violations := exceeded(fmt.Sprintf("%s namespace", quota.Name), &quota.Spec.Hard, &status.Used, requested, previous)
+
+	owner := ownerOf(quota, expr)
+	if owner == "" {
+		return violations
+	}
+	// moving experiment to another owner is accounted as a new experiment of the owner
+	if old != nil && ownerOf(quota, old) != owner {
+		old, previous = nil, nil
+	}
+	return append(violations, exceeded(fmt.Sprintf("%s owner %s", quota.Name, owner), &quota.Spec.PerOwner,
+		ownerUsage(status, owner), requested, previous)...)
+}
+
+// exceeded reports limits exceeded by adding requested to used, previous is the usage of updated experiment,
+// only the increased resources are checked
+func exceeded(scope string, limits *hackathonv1.ExperimentQuotaLimits, used *hackathonv1.ExperimentQuotaUsage,
+	requested, previous *experiment.QuotaUsage) []string {
+	violations := make([]string, 0)
+	if limits.Experiments != nil && previous == nil && used.Experiments+1 > *limits.Experiments {
+		violations = append(violations, fmt.Sprintf("%s experiments limited to %d, %d used", scope, *limits.Experiments, used.Experiments))
+	}
+
+	check := func(name string, limit *resource.Quantity, used, requested resource.Quantity, previous *resource.Quantity) {
+		if limit == nil || (previous != nil && requested.Cmp(*previous) <= 0) {
+			return
+		}
+		total := used.DeepCopy()
+		total.Add(requested)
+		if total.Cmp(*limit) > 0 {
+			violations = append(violations, fmt.Sprintf("%s %s limited to %s, %s used, %s requested",
+				scope, name, limit.String(), used.String(), requested.String()))
+		}
+	}
+	var prevCPU, prevMemory, prevDataVolume *resource.Quantity
+	if previous != nil {
+		prevCPU, prevMemory, prevDataVolume = &previous.CPU, &previous.Memory, &previous.DataVolume
+	}
+	check("cpu", limits.CPU, used.CPU, requested.CPU, prevCPU)
+	check("memory", limits.Memory, used.Memory, requested.Memory, prevMemory)
+	check("data volume", limits.DataVolume, used.DataVolume, requested.DataVolume, prevDataVolume)
+	return violations
+}
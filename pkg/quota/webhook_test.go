@@ -0,0 +1,163 @@
+package quota
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/experiment"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newQuotaExperiment(name, owner string) *hackathonv1.Experiment {
+	expr := &hackathonv1.Experiment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	if owner != "" {
+		expr.Labels = map[string]string{DefaultOwnerLabel: owner}
+	}
+	return expr
+}
+
+func newQuotaUsage(cpu, memory, dataVolume string) *experiment.QuotaUsage {
+	return &experiment.QuotaUsage{
+		CPU:        resource.MustParse(cpu),
+		Memory:     resource.MustParse(memory),
+		DataVolume: resource.MustParse(dataVolume),
+	}
+}
+
+var _ = Describe("quota-webhook", func() {
+	Context("check quota", func() {
+		experiments, cpu, memory := int32(2), resource.MustParse("4"), resource.MustParse("8Gi")
+		ownerExperiments, ownerCPU := int32(1), resource.MustParse("2")
+		quota := &hackathonv1.ExperimentQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-quota", Namespace: "default"},
+			Spec: hackathonv1.ExperimentQuotaSpec{
+				Hard:     hackathonv1.ExperimentQuotaLimits{Experiments: &experiments, CPU: &cpu, Memory: &memory},
+				PerOwner: hackathonv1.ExperimentQuotaLimits{Experiments: &ownerExperiments, CPU: &ownerCPU},
+			},
+		}
+		// team-a uses one experiment of 2 cpu, the namespace has 1 experiment and 2 cpu left
+		usages := []ExperimentUsage{
+			{Experiment: newQuotaExperiment("a-1", "team-a"), Usage: newQuotaUsage("2", "4Gi", "10Gi")},
+		}
+
+		cases := []struct {
+			name       string
+			expr       *hackathonv1.Experiment
+			requested  *experiment.QuotaUsage
+			old        *hackathonv1.Experiment
+			previous   *experiment.QuotaUsage
+			violations []string
+		}{
+			{
+				name:      "allows creation within limits",
+				expr:      newQuotaExperiment("b-1", "team-b"),
+				requested: newQuotaUsage("2", "4Gi", "10Gi"),
+			},
+			{
+				name:      "allows creation without owner",
+				expr:      newQuotaExperiment("x-1", ""),
+				requested: newQuotaUsage("2", "4Gi", "10Gi"),
+			},
+			{
+				name:      "rejects creation exceeding namespace resources",
+				expr:      newQuotaExperiment("b-1", "team-b"),
+				requested: newQuotaUsage("2", "6Gi", "10Gi"),
+				violations: []string{
+					"team-quota namespace memory limited to 8Gi, 4Gi used, 6Gi requested",
+				},
+			},
+			{
+				name:      "rejects creation exceeding owner limits",
+				expr:      newQuotaExperiment("a-2", "team-a"),
+				requested: newQuotaUsage("1", "1Gi", "10Gi"),
+				violations: []string{
+					"team-quota owner team-a experiments limited to 1, 1 used",
+					"team-quota owner team-a cpu limited to 2, 2 used, 1 requested",
+				},
+			},
+			{
+				name:      "allows update decreasing resources",
+				expr:      newQuotaExperiment("b-1", "team-b"),
+				requested: newQuotaUsage("1", "4Gi", "10Gi"),
+				old:       newQuotaExperiment("b-1", "team-b"),
+				previous:  newQuotaUsage("4", "4Gi", "10Gi"),
+			},
+			{
+				name:      "rejects update increasing resources",
+				expr:      newQuotaExperiment("b-1", "team-b"),
+				requested: newQuotaUsage("3", "4Gi", "10Gi"),
+				old:       newQuotaExperiment("b-1", "team-b"),
+				previous:  newQuotaUsage("1", "4Gi", "10Gi"),
+				violations: []string{
+					"team-quota namespace cpu limited to 4, 2 used, 3 requested",
+					"team-quota owner team-b cpu limited to 2, 0 used, 3 requested",
+				},
+			},
+			{
+				name:      "does not count updated experiment again",
+				expr:      newQuotaExperiment("b-1", "team-b"),
+				requested: newQuotaUsage("2", "4Gi", "10Gi"),
+				old:       newQuotaExperiment("b-1", "team-b"),
+				previous:  newQuotaUsage("2", "4Gi", "10Gi"),
+			},
+			{
+				name:      "accounts owner move as new experiment of owner",
+				expr:      newQuotaExperiment("b-1", "team-a"),
+				requested: newQuotaUsage("1", "1Gi", "10Gi"),
+				old:       newQuotaExperiment("b-1", "team-b"),
+				previous:  newQuotaUsage("1", "1Gi", "10Gi"),
+				violations: []string{
+					"team-quota owner team-a experiments limited to 1, 1 used",
+					"team-quota owner team-a cpu limited to 2, 2 used, 1 requested",
+				},
+			},
+		}
+
+		for _, c := range cases {
+			c := c
+			It(c.name, func() {
+				violations := checkQuota(quota, usages, c.expr, c.requested, c.old, c.previous)
+				if len(c.violations) == 0 {
+					Expect(violations).To(BeEmpty())
+				} else {
+					Expect(violations).To(Equal(c.violations))
+				}
+			})
+		}
+	})
+
+	Context("exceeded", func() {
+		limit := int32(1)
+		dataVolume := resource.MustParse("20Gi")
+		limits := &hackathonv1.ExperimentQuotaLimits{Experiments: &limit, DataVolume: &dataVolume}
+
+		cases := []struct {
+			name       string
+			used       hackathonv1.ExperimentQuotaUsage
+			requested  *experiment.QuotaUsage
+			previous   *experiment.QuotaUsage
+			violations int
+		}{
+			{"allows usage reaching limits", hackathonv1.ExperimentQuotaUsage{DataVolume: resource.MustParse("10Gi")},
+				newQuotaUsage("0", "0", "10Gi"), nil, 0},
+			{"rejects experiment count over limit", hackathonv1.ExperimentQuotaUsage{Experiments: 1},
+				newQuotaUsage("0", "0", "1Gi"), nil, 1},
+			{"ignores experiment count of updates", hackathonv1.ExperimentQuotaUsage{Experiments: 1},
+				newQuotaUsage("0", "0", "1Gi"), newQuotaUsage("0", "0", "1Gi"), 0},
+			{"rejects increase over limit", hackathonv1.ExperimentQuotaUsage{DataVolume: resource.MustParse("15Gi")},
+				newQuotaUsage("0", "0", "10Gi"), newQuotaUsage("0", "0", "5Gi"), 1},
+			{"allows decrease already over limit", hackathonv1.ExperimentQuotaUsage{DataVolume: resource.MustParse("30Gi")},
+				newQuotaUsage("0", "0", "5Gi"), newQuotaUsage("0", "0", "10Gi"), 0},
+			{"ignores resources without limit", hackathonv1.ExperimentQuotaUsage{CPU: resource.MustParse("100")},
+				newQuotaUsage("100", "100Gi", "0"), nil, 0},
+		}
+
+		for _, c := range cases {
+			c := c
+			It(c.name, func() {
+				Expect(exceeded("scope", limits, &c.used, c.requested, c.previous)).To(HaveLen(c.violations))
+			})
+		}
+	})
+})
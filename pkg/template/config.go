@@ -0,0 +1,9 @@
+package template
+
+const (
+	LabelKeyTemplateName = "hackathon.kaiyuanshe.cn/template"
+)
+
+// RevisionHistoryLimit is the count of unreferenced revisions kept besides the current one,
+// revisions pinned or used by experiments, experiment sets and pools are never pruned
+var RevisionHistoryLimit = 10
@@ -0,0 +1,167 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/results"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+type Controller struct {
+	Client client.Client
+	Logger logr.Logger
+}
+
+func (c *Controller) Reconcile(ctx context.Context, status *Status) *results.Results {
+	result := results.NewResults(ctx)
+	tmpl := status.Template
+
+	hash, err := DataHash(&tmpl.Data)
+	if err != nil {
+		return result.WithError(err)
+	}
+	revisions, err := ListRevisions(ctx, c.Client, tmpl)
+	if err != nil {
+		return result.WithError(err)
+	}
+
+	var (
+		current *hackathonv1.TemplateRevision
+		latest  int64
+	)
+	for i := range revisions {
+		if revisions[i].Hash == hash {
+			current = &revisions[i]
+		}
+		if revisions[i].Revision > latest {
+			latest = revisions[i].Revision
+		}
+	}
+
+	if current == nil {
+		current, err = c.createRevision(ctx, tmpl, hash, latest+1)
+		if err != nil {
+			c.Logger.Error(err, "create template revision failed")
+			status.AddEvent(corev1.EventTypeWarning, event.ReasonCreated, err.Error())
+			return result.WithError(err)
+		}
+		status.AddEvent(corev1.EventTypeNormal, event.ReasonCreated, fmt.Sprintf("create template revision %d", current.Revision))
+		revisions = append(revisions, *current)
+	}
+	status.Status.CurrentRevision = current.Name
+
+	exprList := &hackathonv1.ExperimentList{}
+	if err = c.Client.List(ctx, exprList, client.InNamespace(tmpl.Namespace)); err != nil {
+		return result.WithError(fmt.Errorf("list experiments failed: %s", err.Error()))
+	}
+	counts := map[string]int32{}
+	referenced := map[string]bool{}
+	for _, expr := range exprList.Items {
+		if expr.Spec.Template != tmpl.Name {
+			continue
+		}
+		if expr.Status.TemplateRevision != "" {
+			counts[expr.Status.TemplateRevision]++
+			referenced[expr.Status.TemplateRevision] = true
+		}
+		referenced[expr.Spec.TemplateRevision] = true
+	}
+	if err = c.listTemplateRefs(ctx, tmpl, referenced); err != nil {
+		return result.WithError(err)
+	}
+
+	kept := make([]hackathonv1.TemplateRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		if !prunable(rev, current, referenced, revisions) {
+			kept = append(kept, rev)
+			continue
+		}
+		c.Logger.Info("prune template revision", "revision", rev.Name)
+		if err = client.IgnoreNotFound(c.Client.Delete(ctx, &rev)); err != nil {
+			c.Logger.Error(err, "prune template revision failed")
+			kept = append(kept, rev)
+		}
+	}
+	revisions = kept
+
+	status.Status.Revisions = make([]hackathonv1.TemplateRevisionStatus, 0, len(revisions))
+	for _, rev := range revisions {
+		status.Status.Revisions = append(status.Status.Revisions, hackathonv1.TemplateRevisionStatus{
+			Name:        rev.Name,
+			Revision:    rev.Revision,
+			Experiments: counts[rev.Name],
+		})
+	}
+	return result
+}
+
+func (c *Controller) createRevision(ctx context.Context, tmpl *hackathonv1.Template, hash string, revision int64) (*hackathonv1.TemplateRevision, error) {
+	rev := &hackathonv1.TemplateRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RevisionName(tmpl.Name, revision),
+			Namespace: tmpl.Namespace,
+			Labels: map[string]string{
+				LabelKeyTemplateName: tmpl.Name,
+			},
+		},
+		Template: tmpl.Name,
+		Revision: revision,
+		Hash:     hash,
+		Data:     *tmpl.Data.DeepCopy(),
+	}
+
+	if err := controllerutil.SetControllerReference(tmpl, rev.GetObjectMeta(), scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("set template revision owner ref failed: %s", err.Error())
+	}
+	c.Logger.Info("create template revision", "revision", rev.Name)
+	if err := c.Client.Create(ctx, rev); err != nil {
+		return nil, fmt.Errorf("create template revision failed: %s", err.Error())
+	}
+	return rev, nil
+}
+
+// listTemplateRefs marks revisions pinned by experiment sets and pools of template as referenced
+func (c *Controller) listTemplateRefs(ctx context.Context, tmpl *hackathonv1.Template, referenced map[string]bool) error {
+	setList := &hackathonv1.ExperimentSetList{}
+	if err := c.Client.List(ctx, setList, client.InNamespace(tmpl.Namespace)); err != nil {
+		return fmt.Errorf("list experiment sets failed: %s", err.Error())
+	}
+	for _, set := range setList.Items {
+		if set.Spec.Template.Spec.Template == tmpl.Name {
+			referenced[set.Spec.Template.Spec.TemplateRevision] = true
+		}
+	}
+	poolList := &hackathonv1.ExperimentPoolList{}
+	if err := c.Client.List(ctx, poolList, client.InNamespace(tmpl.Namespace)); err != nil {
+		return fmt.Errorf("list experiment pools failed: %s", err.Error())
+	}
+	for _, pool := range poolList.Items {
+		if pool.Spec.Template.Spec.Template == tmpl.Name {
+			referenced[pool.Spec.Template.Spec.TemplateRevision] = true
+		}
+	}
+	return nil
+}
+
+// prunable tells whether rev is neither current, referenced nor one of the latest RevisionHistoryLimit
+// unreferenced revisions, revisions are sorted by revision number
+func prunable(rev hackathonv1.TemplateRevision, current *hackathonv1.TemplateRevision, referenced map[string]bool,
+	revisions []hackathonv1.TemplateRevision) bool {
+	if rev.Name == current.Name || referenced[rev.Name] {
+		return false
+	}
+	newer := 0
+	for _, other := range revisions {
+		if other.Revision > rev.Revision && other.Name != current.Name && !referenced[other.Name] {
+			newer++
+		}
+	}
+	return newer >= RevisionHistoryLimit
+}
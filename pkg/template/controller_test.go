@@ -0,0 +1,50 @@
+package template
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRevisions(count int) []hackathonv1.TemplateRevision {
+	revisions := make([]hackathonv1.TemplateRevision, 0, count)
+	for i := 1; i <= count; i++ {
+		revisions = append(revisions, hackathonv1.TemplateRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: RevisionName("tmpl", int64(i)), Namespace: "default"},
+			Template:   "tmpl",
+			Revision:   int64(i),
+		})
+	}
+	return revisions
+}
+
+var _ = Describe("template-revision-history", func() {
+	limit := RevisionHistoryLimit
+	AfterEach(func() {
+		RevisionHistoryLimit = limit
+	})
+
+	It("prunes unreferenced revisions beyond history limit", func() {
+		RevisionHistoryLimit = 2
+		revisions := newRevisions(6)
+		current := &revisions[2]
+		referenced := map[string]bool{"tmpl-1": true}
+
+		var pruned []string
+		for _, rev := range revisions {
+			if prunable(rev, current, referenced, revisions) {
+				pruned = append(pruned, rev.Name)
+			}
+		}
+		// tmpl-1 is referenced, tmpl-3 is current, tmpl-5 and tmpl-6 are the latest unreferenced
+		Expect(pruned).To(ConsistOf("tmpl-2", "tmpl-4"))
+	})
+
+	It("keeps every revision within history limit", func() {
+		revisions := newRevisions(3)
+		for _, rev := range revisions {
+			Expect(prunable(rev, &revisions[2], map[string]bool{}, revisions)).To(BeFalse())
+		}
+	})
+})
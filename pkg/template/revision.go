@@ -0,0 +1,51 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/utils/k8stools"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+)
+
+// DataHash identifies template data, revisions with the same hash have the same data
+func DataHash(data *hackathonv1.TemplateData) (string, error) {
+	return k8stools.HashObject(data)
+}
+
+func RevisionName(template string, revision int64) string {
+	return fmt.Sprintf("%s-%d", template, revision)
+}
+
+// ListRevisions returns revisions of template sorted by revision number
+func ListRevisions(ctx context.Context, k8sClient client.Client, tmpl *hackathonv1.Template) ([]hackathonv1.TemplateRevision, error) {
+	revList := &hackathonv1.TemplateRevisionList{}
+	err := k8sClient.List(ctx, revList, client.InNamespace(tmpl.Namespace), client.MatchingLabels{LabelKeyTemplateName: tmpl.Name})
+	if err != nil {
+		return nil, fmt.Errorf("list template revisions failed: %s", err.Error())
+	}
+	revisions := revList.Items
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+// FindRevision returns the revision matching current template data, nil if not created yet
+func FindRevision(ctx context.Context, k8sClient client.Client, tmpl *hackathonv1.Template) (*hackathonv1.TemplateRevision, error) {
+	hash, err := DataHash(&tmpl.Data)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := ListRevisions(ctx, k8sClient, tmpl)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		if revisions[i].Hash == hash {
+			return &revisions[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,31 @@
+package template
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"github.com/kaiyuanshe/cloudengine/pkg/common/event"
+	"reflect"
+)
+
+type Status struct {
+	*event.Recorder
+	Template *hackathonv1.Template
+	Status   *hackathonv1.TemplateStatus
+}
+
+func (s *Status) Apply() ([]event.Event, *hackathonv1.Template) {
+	pre, crt := s.Template.Status, s.Status
+	if reflect.DeepEqual(pre, crt) {
+		return s.Events, nil
+	}
+	tmpl := s.Template
+	tmpl.Status = *crt
+	return s.Events, tmpl
+}
+
+func NewStatus(tmpl *hackathonv1.Template) *Status {
+	return &Status{
+		Recorder: event.NewEventRecorder(),
+		Template: tmpl,
+		Status:   tmpl.Status.DeepCopy(),
+	}
+}
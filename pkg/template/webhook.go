@@ -0,0 +1,58 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	"net/http"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// RevisionValidatePath is the path of template revision validating webhook
+const RevisionValidatePath = "/validate-hackathon-kaiyuanshe-cn-v1-templaterevision"
+
+// +kubebuilder:webhook:path=/validate-hackathon-kaiyuanshe-cn-v1-templaterevision,mutating=false,failurePolicy=fail,groups=hackathon.kaiyuanshe.cn,resources=templaterevisions,verbs=update,versions=v1,name=vtemplaterevision.kaiyuanshe.cn
+
+// RevisionValidator rejects updates changing the snapshot of a TemplateRevision,
+// metadata such as labels and owner references can still be updated
+type RevisionValidator struct {
+	Logger  logr.Logger
+	decoder *admission.Decoder
+}
+
+func (v *RevisionValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *RevisionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	rev, old := &hackathonv1.TemplateRevision{}, &hackathonv1.TemplateRevision{}
+	if err := v.decoder.Decode(req, rev); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := revisionChanged(old, rev); err != nil {
+		v.Logger.Info("template revision update rejected", "namespace", req.Namespace, "name", rev.Name, "error", err.Error())
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// revisionChanged reports the immutable field changed by update
+func revisionChanged(old, rev *hackathonv1.TemplateRevision) error {
+	switch {
+	case old.Template != rev.Template:
+		return fmt.Errorf("template of revision %s is immutable", rev.Name)
+	case old.Revision != rev.Revision:
+		return fmt.Errorf("revision number of %s is immutable", rev.Name)
+	case old.Hash != rev.Hash:
+		return fmt.Errorf("hash of revision %s is immutable", rev.Name)
+	case !reflect.DeepEqual(old.Data, rev.Data):
+		return fmt.Errorf("data of revision %s is immutable", rev.Name)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package template
+
+import (
+	hackathonv1 "github.com/kaiyuanshe/cloudengine/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("template-revision-webhook", func() {
+	var old *hackathonv1.TemplateRevision
+	BeforeEach(func() {
+		old = &hackathonv1.TemplateRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: "tmpl-1", Namespace: "default"},
+			Template:   "tmpl",
+			Revision:   1,
+			Data: hackathonv1.TemplateData{
+				PodTemplate: &hackathonv1.PodTemplate{Image: "ubuntu:20.04"},
+			},
+		}
+		hash, err := DataHash(&old.Data)
+		Expect(err).NotTo(HaveOccurred())
+		old.Hash = hash
+	})
+
+	It("allows metadata updates", func() {
+		rev := old.DeepCopy()
+		rev.Labels = map[string]string{"team": "a"}
+		Expect(revisionChanged(old, rev)).To(Succeed())
+	})
+
+	It("rejects snapshot updates", func() {
+		rev := old.DeepCopy()
+		rev.Data.PodTemplate.Image = "ubuntu:22.04"
+		Expect(revisionChanged(old, rev)).To(MatchError(ContainSubstring("data")))
+
+		rev = old.DeepCopy()
+		rev.Revision = 2
+		Expect(revisionChanged(old, rev)).To(MatchError(ContainSubstring("revision number")))
+
+		rev = old.DeepCopy()
+		rev.Template = "other"
+		Expect(revisionChanged(old, rev)).To(MatchError(ContainSubstring("template")))
+
+		rev = old.DeepCopy()
+		rev.Hash = "00000000"
+		Expect(revisionChanged(old, rev)).To(MatchError(ContainSubstring("hash")))
+	})
+})
@@ -1 +1,20 @@
 package collection
+
+func ContainsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func RemoveString(list []string, s string) []string {
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
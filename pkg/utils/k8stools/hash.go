@@ -0,0 +1,18 @@
+package k8stools
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// HashObject returns a short stable hash of the json encoded object
+func HashObject(obj interface{}) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("encode object failed: %s", err.Error())
+	}
+	hasher := fnv.New32a()
+	_, _ = hasher.Write(data)
+	return fmt.Sprintf("%08x", hasher.Sum32()), nil
+}